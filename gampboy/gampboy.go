@@ -0,0 +1,207 @@
+// Package gampboy is the public API of the emulator, it can be embedded
+// in other programs (front ends, tools, bots, ...)
+package gampboy
+
+import (
+	"io"
+	"strings"
+
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+	"github.com/giammirove/gampboy_emulator/internal/headers"
+	"github.com/giammirove/gampboy_emulator/internal/headless"
+	"github.com/giammirove/gampboy_emulator/internal/ppu"
+	"github.com/giammirove/gampboy_emulator/internal/savestate"
+	"github.com/giammirove/gampboy_emulator/internal/sound"
+)
+
+// size of the lcd in pixels
+const Width = headless.WIDTH
+const Height = headless.HEIGHT
+
+// time of a frame at real speed (59.73 Hz)
+const FrameDuration = ppu.FRAME_DURATION
+
+// audio produced by AudioSamples, stereo interleaved (left, right)
+const SampleRate = sound.SAMPLE_RATE
+const Channels = sound.CHANNELS
+
+// Button is a bit mask of the pressed buttons
+type Button uint8
+
+const (
+	ButtonA Button = 1 << iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonRight
+	ButtonLeft
+	ButtonUp
+	ButtonDown
+)
+
+// Options of a new machine
+type Options struct {
+	// where the rom was loaded from, the battery saves are stored next to it
+	Path string
+	// the MBC3 clock follows the host clock instead of the emulated one
+	RTCHostClock bool
+	// DMG or CGB boot rom, nil starts from the state it leaves
+	BootROM []byte
+	// console to emulate: dmg0, dmg, mgb, sgb, cgb or agb,
+	// empty follows the boot rom or the cartridge
+	Model string
+	// the battery ram starts empty and is never written to the disk
+	NoSaves bool
+}
+
+// GameBoy is a single machine, many of them can run side by side.
+// It is not safe for concurrent use
+type GameBoy struct {
+	machine *emulator.GameBoy
+	buttons Button
+}
+
+// New loads the rom in a new machine
+func New(rom []byte, opts Options) (*GameBoy, error) {
+	model, err := headers.ParseModel(opts.Model)
+	if err != nil {
+		return nil, err
+	}
+	machine, err := emulator.New(rom, emulator.Options{Path: opts.Path, RTCHostClock: opts.RTCHostClock, BootROM: opts.BootROM, Model: model, NoSaves: opts.NoSaves})
+	if err != nil {
+		return nil, err
+	}
+	return &GameBoy{machine: machine}, nil
+}
+
+// Machine is the machine inside gb, for the front ends of this module
+// (debugger, gdb, trace, ...), its type can't be used outside of it
+func (gb *GameBoy) Machine() *emulator.GameBoy {
+	return gb.machine
+}
+
+// Close releases what the machine started in background
+func (gb *GameBoy) Close() {
+	gb.machine.Close()
+}
+
+// Title is the title in the cartridge header
+func (gb *GameBoy) Title() string {
+	return strings.TrimRight(gb.machine.Header.GetTitle(), "\x00")
+}
+
+// Checksum is the global checksum in the cartridge header
+func (gb *GameBoy) Checksum() uint16 {
+	return gb.machine.Header.GetGlobalChecksum()
+}
+
+// Model is the console being emulated (DMG, CGB, ...)
+func (gb *GameBoy) Model() string {
+	return gb.machine.Header.GetModel().String()
+}
+
+// BootROM is the boot rom of the Options, nil without one
+func (gb *GameBoy) BootROM() []byte {
+	return gb.machine.MMU.GetBootROM()
+}
+
+// RunFrame runs the machine until the next frame has been drawn
+// (or the time of a frame has passed, while the lcd is off)
+func (gb *GameBoy) RunFrame() {
+	headless.Run(gb.machine, 1)
+}
+
+// SetSpeed paces RunFrame: 1 = real time (59.73 frames per second),
+// less is slow motion, more is faster, 0 = as fast as possible (default)
+func (gb *GameBoy) SetSpeed(speed float64) {
+	gb.machine.PPU.Speed = speed
+}
+
+// SetButtons presses the buttons in mask and releases the others
+func (gb *GameBoy) SetButtons(mask Button) {
+	// only the changes, a new press requests the joypad interrupt
+	gb.updateButtons(mask, mask^gb.buttons)
+}
+
+func (gb *GameBoy) updateButtons(mask Button, changed Button) {
+	j := gb.machine.Joypad
+	buttons := []struct {
+		button  Button
+		press   func()
+		release func()
+	}{
+		{ButtonA, j.SetJoypadA, j.ClearJoypadA},
+		{ButtonB, j.SetJoypadB, j.ClearJoypadB},
+		{ButtonSelect, j.SetJoypadSelect, j.ClearJoypadSelect},
+		{ButtonStart, j.SetJoypadStart, j.ClearJoypadStart},
+		{ButtonRight, j.SetJoypadRight, j.ClearJoypadRight},
+		{ButtonLeft, j.SetJoypadLeft, j.ClearJoypadLeft},
+		{ButtonUp, j.SetJoypadUp, j.ClearJoypadUp},
+		{ButtonDown, j.SetJoypadDown, j.ClearJoypadDown},
+	}
+	for _, b := range buttons {
+		if changed&b.button == 0 {
+			continue
+		}
+		if mask&b.button != 0 {
+			b.press()
+		} else {
+			b.release()
+		}
+	}
+	gb.buttons = mask
+}
+
+// Framebuffer returns the last frame, Width * Height pixels
+// row by row as 0xAARRGGBB
+func (gb *GameBoy) Framebuffer() []uint32 {
+	buffer := gb.machine.PPU.FetcherGetBuffer()
+	pixels := make([]uint32, Width*Height)
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			pixels[y*Width+x] = buffer[x][y]
+		}
+	}
+	return pixels
+}
+
+// AudioSamples returns the samples produced since the last call,
+// if they are not read often enough the oldest ones are dropped
+func (gb *GameBoy) AudioSamples() []int16 {
+	samples := gb.machine.APU.Samples
+	buffer := make([]int16, samples.Len())
+	n := samples.Read(buffer)
+	return buffer[:n]
+}
+
+// SaveState writes the whole machine to w
+func (gb *GameBoy) SaveState(w io.Writer) error {
+	return savestate.SaveState(gb.machine, w)
+}
+
+// LoadState restores a machine saved by SaveState with the same rom,
+// on error the machine is left untouched
+func (gb *GameBoy) LoadState(r io.Reader) error {
+	if err := savestate.LoadState(gb.machine, r); err != nil {
+		return err
+	}
+	// the state has its own buttons, the ones held now win
+	gb.updateButtons(gb.buttons, ^Button(0))
+	return nil
+}
+
+// SetSerialOutput sends to w every byte the game shifts out with its own
+// clock (test results, debug prints of homebrews), nil discards them
+func (gb *GameBoy) SetSerialOutput(w io.Writer) {
+	gb.machine.Serial.Output = w
+}
+
+// ReadMemory reads the address space as the cpu would, without spending cycles
+func (gb *GameBoy) ReadMemory(addr uint16) uint8 {
+	return uint8(gb.machine.MMU.ReadFromMemory(uint(addr)))
+}
+
+// WriteMemory writes the address space as the cpu would, without spending cycles
+func (gb *GameBoy) WriteMemory(addr uint16, value uint8) {
+	gb.machine.MMU.WriteToMemory(uint(addr), uint(value))
+}
@@ -0,0 +1,48 @@
+package gampboy
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/giammirove/gampboy_emulator/internal/testutil"
+)
+
+// a cartridge that turns the lcd on and loops, enough to draw frames
+func loopROM() []byte {
+	// LD A,$91 ; LDH ($40),A ; JR -2
+	return testutil.ROM([]byte{0x3E, 0x91, 0xE0, 0x40, 0x18, 0xFE})
+}
+
+// the machines don't share any state, they can run side by side
+func TestParallel(t *testing.T) {
+	const machines = 4
+	buffers := make([][]uint32, machines)
+	var wg sync.WaitGroup
+	for i := 0; i < machines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			gb, err := New(loopROM(), Options{NoSaves: true})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer gb.Close()
+			for frame := 0; frame < 30; frame++ {
+				gb.RunFrame()
+			}
+			buffers[i] = gb.Framebuffer()
+		}(i)
+	}
+	wg.Wait()
+	for i := 1; i < machines; i++ {
+		if len(buffers[i]) != len(buffers[0]) {
+			t.Fatalf("machine %d drew %d pixels, machine 0 %d", i, len(buffers[i]), len(buffers[0]))
+		}
+		for p := range buffers[i] {
+			if buffers[i][p] != buffers[0][p] {
+				t.Fatalf("machine %d differs from machine 0 at pixel %d", i, p)
+			}
+		}
+	}
+}
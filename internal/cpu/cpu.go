@@ -1,400 +1,213 @@
 package cpu
 
 import (
+	"encoding/gob"
 	"fmt"
 	"log"
-	"strings"
 
 	decoder "github.com/giammirove/gampboy_emulator/internal/decoder"
 	"github.com/giammirove/gampboy_emulator/internal/interrupts"
 	"github.com/giammirove/gampboy_emulator/internal/mmu"
 	"github.com/giammirove/gampboy_emulator/internal/ppu"
+
 	registers "github.com/giammirove/gampboy_emulator/internal/registers"
+	"github.com/giammirove/gampboy_emulator/internal/serial"
+	"github.com/giammirove/gampboy_emulator/internal/sound"
+	"github.com/giammirove/gampboy_emulator/internal/symbols"
 	"github.com/giammirove/gampboy_emulator/internal/timer"
 	"github.com/giammirove/gampboy_emulator/internal/utility"
 )
 
-const _LD = "LD"
-const _LDH = "LDH"
-const _PUSH = "PUSH"
-const _POP = "POP"
-const _JP = "JP"
-const _JR = "JR"
-const _CALL = "CALL"
-const _RST = "RST"
-const _RET = "RET"
-const _RETI = "RETI"
-
-// ALU
-const _AND = "AND"
-const _OR = "OR"
-const _XOR = "XOR"
-const _INC = "INC"
-const _DEC = "DEC"
-const _CP = "CP"
-const _ADD = "ADD"
-const _ADC = "ADC"
-const _SUB = "SUB"
-const _SBC = "SBC"
-
-// MISC
-const _SWAP = "SWAP"
-const _DAA = "DAA"
-const _CPL = "CPL"
-const _CCF = "CCF"
-const _SCF = "SCF"
-const _NOP = "NOP"
-const _HALT = "HALT"
-const _STOP = "STOP"
-const _DI = "DI"
-const _EI = "EI"
-
-//  ROTATE & SHIFTS
-const _RLCA = "RLCA"
-const _RLA = "RLA"
-const _RRCA = "RRCA"
-const _RRA = "RRA"
-const _RLC = "RLC"
-const _RL = "RL"
-const _RRC = "RRC"
-const _RR = "RR"
-const _SLA = "SLA"
-const _SRA = "SRA"
-const _SRL = "SRL"
-
-// BIT
-const _BIT = "BIT"
-const _SET = "SET"
-const _RES = "RES"
-
 const CLOCK_SPEED = 4194304
-const MAX_FPS = 120
-const CPS = CLOCK_SPEED / MAX_FPS
-
-var msg [1024]byte
-var msg_size = 0
-
-var halted bool
-
-func InitCPU() {
-	registers.Init()
-	msg = [1024]byte{0}
-	halted = false
-}
-func SetHalted(val bool) {
-	halted = val
-}
-func GetHalted() bool {
-	return halted
-}
-
-var ticks int = 0
-
-var DEBUG = false
-var PAUSE = false
-var MANUAL = false
 
-func ToggleDebugMode() {
-	if DEBUG {
-		DEBUG = false
+// CPU runs the instructions and clocks every other component
+type CPU struct {
+	interrupts *interrupts.Interrupts
+	mmu        *mmu.MMU
+	ppu        *ppu.PPU
+	registers  *registers.Registers
+	serial     *serial.Serial
+	sound      *sound.APU
+	timer      *timer.Timer
+
+	halted bool
+	// a debugger asked to close the emulator
+	quit  bool
+	ticks int
+	// T-Cycles executed since the start
+	cycles uint64
+	DEBUG  bool
+	// called after LD B,B, used by the test roms as a software breakpoint
+	DebugBreak func()
+	// called at the beginning of every step, used by the debugger
+	BeforeStep func()
+	// called before every instruction is fetched, used by the trace
+	Trace func()
+	// labels of the rom, they replace the addresses in the trace
+	Symbols *symbols.Table
+	opcodes [2 * _PREFIX_OFFSET]func()
+}
+
+// New creates the cpu connected to the other components
+func New(interrupts *interrupts.Interrupts, mmu *mmu.MMU, ppu *ppu.PPU, registers *registers.Registers, serial *serial.Serial, sound *sound.APU, timer *timer.Timer) *CPU {
+	c := &CPU{interrupts: interrupts, mmu: mmu, ppu: ppu, registers: registers, serial: serial, sound: sound, timer: timer}
+	c.buildOpcodes()
+	return c
+}
+
+func (c *CPU) InitCPU() {
+	c.registers.Init()
+	c.halted = false
+}
+func (c *CPU) SetHalted(val bool) {
+	c.halted = val
+}
+func (c *CPU) GetHalted() bool {
+	return c.halted
+}
+
+// RequestQuit is used by the debuggers, the step stops before the
+// instruction and the run loops return
+func (c *CPU) RequestQuit() {
+	c.quit = true
+}
+func (c *CPU) QuitRequested() bool {
+	return c.quit
+}
+func (c *CPU) GetCycles() uint64 {
+	return c.cycles
+}
+
+func (c *CPU) ToggleDebugMode() {
+	if c.DEBUG {
+		c.DEBUG = false
 	} else {
-		DEBUG = true
+		c.DEBUG = true
 	}
 }
-func TogglePauseMode() {
-	if PAUSE {
-		PAUSE = false
-	} else {
-		PAUSE = true
-		log.Printf("ticks %d\n", ticks)
-	}
-}
-func ToggleManualMode() {
-	if MANUAL {
-		MANUAL = false
-	} else {
-		MANUAL = true
-	}
-}
-
-func Run() {
-	// ticker := time.NewTicker(time.Second / time.Duration(MAX_FPS))
-	// for range ticker.C {
-	// 	for i := 0; i < CPS; i++ {
-	for {
-		if !PAUSE {
-
-			if !GetHalted() {
-				if ppu.IsGDMATransferring() {
-					Cycle(4)
-				} else {
-					// dbgUpdate()
-					// dbgPrint()
-					if interrupts.GetIF()&interrupts.GetIE() != 0 && !interrupts.GetIME() {
-						// utility.WaitHere("halt bug")
-					}
-
-					// pre_d := ppu.GetLY()
-
-					addr := registers.PC()
-					saved := addr
-					instruction := decoder.Decode(&addr)
-
-					registers.SetPC(addr)
-
-					// if ticks == 0x315BA {
-					// 	instruction.Operands[1].Value += 6
-					// }
-					if DEBUG {
-						fmt.Printf("%05X - $%05X: ", ticks, saved)
-						fmt.Printf("%-19s (%02X %02X) ", decoder.PrintInstrunction(instruction), mmu.ReadFromMemoryCPU(saved+1), mmu.ReadFromMemoryCPU(saved+2))
-						registers.Dump()
-						fmt.Printf("%-43s SP: %04X PC: %04X ROM: %02d RAM: %02d\n", "", registers.SP(), registers.PC(), mmu.GetRomBank(), mmu.GetRamBank())
-					}
-					execute(instruction)
-					if MANUAL {
-						utility.WaitHere()
-					}
-					if instruction.Mnemonic == "LD" && len(instruction.Operands) > 1 && instruction.Operands[0].Name == "B" && instruction.Operands[1].Value == 0x00 && instruction.Operands[1].Immediate {
-						// utility.WaitHere()
-					}
-					// if len(instruction.Operands) > 0 && instruction.Operands[0].Name == "B" {
-					// 	utility.WaitHere()
-					// }
-					// if ticks >= 0x2DD58 && pre_d != ppu.GetLY() {
-					// 	fmt.Printf("ly %d -> %d\n", pre_d, ppu.GetLY())
-					// 	// utility.WaitHere()
-					// }
-
-					if ticks == 245000 {
-						// utility.WaitHere()
-					}
 
-					ticks++
-
-				}
-
-			} else {
-				Cycle(4)
-				if interrupts.GetIF()&interrupts.GetIE()&0b11111 != 0 {
-					SetHalted(false)
-				}
+// executes a single instruction (or a M-Cycle while halted)
+// and handles the interrupts
+func (c *CPU) Step() {
+	if c.BeforeStep != nil {
+		c.BeforeStep()
+		// the machine stops where the debugger left it
+		if c.quit {
+			return
+		}
+	}
+	if !c.GetHalted() {
+		if c.ppu.IsGDMATransferring() {
+			c.Cycle(4)
+		} else {
+			if c.DEBUG {
+				c.printInstruction()
 			}
-			if interrupts.GetIME() {
-				if interrupts.HandleInterrupts() {
-					SetHalted(false)
-				}
+			if c.Trace != nil {
+				c.Trace()
 			}
-			// EI  is delayed by one instruction
-			// But if EI is followed immediately by DI does not allow any interrupts
-			if interrupts.GetPendingIME() {
-				interrupts.SetIME(1)
-				interrupts.SetPendingIME(0)
+			opcode := c.fetch8()
+			if opcode == decoder.OPCODE_PREFIX {
+				opcode = _PREFIX_OFFSET | c.fetch8()
 			}
-
-			if GetHalted() && (interrupts.GetIE()|interrupts.GetIF())&0b11111 == 0x0 {
-				log.Fatal("HALT")
+			c.opcodes[opcode]()
+			// LD B,B
+			if c.DebugBreak != nil && opcode == 0x40 {
+				c.DebugBreak()
 			}
+
+			c.ticks++
+
+		}
+
+	} else {
+		c.Cycle(4)
+		if c.interrupts.GetIF()&c.interrupts.GetIE()&0b11111 != 0 {
+			c.SetHalted(false)
+		}
+	}
+	if c.interrupts.GetIME() {
+		if c.interrupts.HandleInterrupts() {
+			c.SetHalted(false)
 		}
 	}
-	// 	}
-	// }
+	// EI  is delayed by one instruction
+	// But if EI is followed immediately by DI does not allow any interrupts
+	if c.interrupts.GetPendingIME() {
+		c.interrupts.SetIME(1)
+		c.interrupts.SetPendingIME(0)
+	}
+
+	if c.GetHalted() && (c.interrupts.GetIE()|c.interrupts.GetIF())&0b11111 == 0x0 {
+		log.Fatal("HALT")
+	}
 }
 
 // val -> T-Cycle = M-Cycle * 4
 // M-Cycle = cpu Cycle
-func Cycle(val uint) {
+func (c *CPU) Cycle(val uint) {
 	m_cycle := int(val / 4)
 	// M-Cycle
 	for i := 0; i < m_cycle; i++ {
+		c.cycles += 4
 		// T-Cycle
 		for j := 0; j < 4; j++ {
-			timer.Tick()
-			if ppu.IsDoubleSpeed() {
-				timer.Tick()
+			c.timer.Tick()
+			if c.ppu.IsDoubleSpeed() {
+				c.timer.Tick()
+			}
+			c.ppu.LCDTick()
+			// the apu keeps the normal speed, 2 ticks per M-Cycle
+			if !c.ppu.IsDoubleSpeed() || j%2 == 0 {
+				c.sound.Tick()
 			}
-			ppu.LCDTick()
 		}
-		ppu.DMATick()
-		if ppu.IsDoubleSpeed() {
-			ppu.DMATick()
+		c.mmu.TickMBC()
+		c.serial.Tick(c.ppu.IsDoubleSpeed())
+		c.ppu.DMATick()
+		if c.ppu.IsDoubleSpeed() {
+			c.ppu.DMATick()
 		}
 		//TODO:  faster
-		ppu.GDMATransfer()
+		c.ppu.GDMATransfer()
 	}
 }
 
-func dbgUpdate() {
-	if mmu.ReadFromMemoryCPU(0xFF02) == 0x81 {
-		// log.Fatal("DBG UPDATE")
-		c := mmu.ReadFromMemoryCPU(0xFF01)
-		msg[msg_size] = byte(c)
-		msg_size++
-		mmu.WriteToMemoryCPU(0xFF02, 0)
-	}
+func (c *CPU) SaveState(enc *gob.Encoder) error {
+	return utility.EncodeAll(enc, c.halted, c.ticks)
 }
 
-func dbgPrint() {
-	if msg[0] != 0 {
-		fmt.Printf("DBG : %s\n", msg)
-		m := string(msg[:])
-		if strings.Contains(m, "Failed") || strings.Contains(m, "Passed") {
-			// fmt.Printf("%s\n", msg)
-			// log.Fatal("TEST COMPLETE")
-		}
-		// log.Fatal("DGB RECEIVED")
-	}
+func (c *CPU) LoadState(dec *gob.Decoder) error {
+	return utility.DecodeAll(dec, &c.halted, &c.ticks)
 }
 
-func debug(instruction decoder.Instruction_t) {
-	if instruction.Opcode == 0xDE && false {
-		fmt.Println(instruction)
-		fmt.Printf("A: %02X\n", registers.A())
-		// fmt.Printf("SP: %04X HL: %04X\n", registers.SP(), registers.HL())
-		utility.WaitHere()
-	}
+// prints the instruction at PC before it is executed
+func (c *CPU) printInstruction() {
+	saved := c.registers.PC()
+	addr := saved
+	instruction := decoder.Decode(&addr, c.mmu.ReadFromMemory)
+	fmt.Printf("%05X - %s: ", c.ticks, c.Location(saved))
+	fmt.Printf("%-19s (%02X %02X) ", decoder.PrintInstrunction(instruction), c.mmu.ReadFromMemory(saved+1), c.mmu.ReadFromMemory(saved+2))
+	c.registers.Dump()
+	fmt.Printf("%-43s SP: %04X PC: %04X ROM: %02d RAM: %02d\n", "", c.registers.SP(), addr, c.mmu.GetRomBank(), c.mmu.GetRamBank())
 }
 
-func execute(instruction decoder.Instruction_t) {
-
-	switch instruction.Mnemonic {
-	case _LD, _LDH:
-		handleLD(instruction)
-		break
-	case _PUSH:
-		handlePUSH(instruction)
-		break
-	case _POP:
-		handlePOP(instruction)
-		break
-	case _JP, _JR:
-		handleJP(instruction)
-		break
-	case _CALL:
-		handleCALL(instruction)
-		break
-	case _RST:
-		handleRST(instruction)
-		break
-	case _RET:
-		handleRET(instruction)
-		break
-	case _RETI:
-		handleRETI(instruction)
-		break
-	case _AND:
-		handleAND(instruction)
-		break
-	case _OR:
-		handleOR(instruction)
-		break
-	case _XOR:
-		handleXOR(instruction)
-		break
-	case _INC:
-		handleINC(instruction)
-		break
-	case _DEC:
-		handleDEC(instruction)
-		break
-	case _CP:
-		handleCP(instruction)
-		break
-	case _ADD, _ADC:
-		handleADD(instruction)
-		break
-	case _SUB, _SBC:
-		handleSUB(instruction)
-		break
-
-	case _SWAP:
-		handleSWAP(instruction)
-		break
-	case _DAA:
-		handleDAA(instruction)
-		break
-	case _CPL:
-		handleCPL(instruction)
-		break
-	case _CCF:
-		handleCCF(instruction)
-		break
-	case _SCF:
-		handleSCF(instruction)
-		break
-	case _NOP:
-		handleNOP(instruction)
-		break
-	case _HALT:
-		handleHALT(instruction)
-		break
-	case _STOP:
-		handleSTOP(instruction)
-		break
-	case _DI:
-		handleDI(instruction)
-		break
-	case _EI:
-		handleEI(instruction)
-		break
-
-	case _RLCA:
-		handleRLCA(instruction)
-		break
-	case _RLA:
-		handleRLA(instruction)
-		break
-	case _RRCA:
-		handleRRCA(instruction)
-		break
-	case _RRA:
-		handleRRA(instruction)
-		break
-	case _RLC:
-		handleRLC(instruction)
-		break
-	case _RL:
-		handleRL(instruction)
-		break
-	case _RRC:
-		handleRRC(instruction)
-		break
-	case _RR:
-		handleRR(instruction)
-		break
-	case _SLA:
-		handleSLA(instruction)
-		break
-	case _SRA:
-		handleSRA(instruction)
-		break
-	case _SRL:
-		handleSRL(instruction)
-		break
-
-	case _BIT:
-		handleBIT(instruction)
-		break
-	case _SET:
-		handleSET(instruction)
-		break
-	case _RES:
-		handleRES(instruction)
-		break
-	default:
-		log.Fatal("Not handled (", instruction.Mnemonic, ")")
+// Location describes addr with the symbols, if there are any
+func (c *CPU) Location(addr uint) string {
+	if c.Symbols.Len() == 0 {
+		return fmt.Sprintf("$%05X", addr)
 	}
-
+	return c.Symbols.Format(c.mmu.GetBank(addr), addr)
 }
 
-func PrintStack() {
+func (c *CPU) PrintStack() {
 	for i := 0; i < 10; i++ {
-		fmt.Printf("%02X ", mmu.ReadFromMemoryCPU(registers.SP()-uint(i)))
+		fmt.Printf("%02X ", c.mmu.ReadFromMemoryCPU(c.registers.SP()-uint(i)))
 	}
 	fmt.Printf("\n")
 }
 
-func StackPush(value uint, bytes ...uint) {
+func (c *CPU) StackPush(value uint, bytes ...uint) {
 	if len(bytes) > 1 {
 		log.Fatal("Too many arguments")
 	}
@@ -404,33 +217,33 @@ func StackPush(value uint, bytes ...uint) {
 			log.Fatal("Wrong number of bytes to push")
 		}
 		if b == 1 {
-			registers.DecrementSP()
-			Cycle(4)
-			mmu.WriteToMemoryCPU(registers.SP(), uint(uint8(value)))
+			c.registers.DecrementSP()
+			c.Cycle(4)
+			c.mmu.WriteToMemoryCPU(c.registers.SP(), uint(uint8(value)))
 		} else {
 			hi, low := utility.GetHiLow(uint16(value))
-			Cycle(4)
-			registers.DecrementSP()
-			mmu.WriteToMemoryCPU(registers.SP(), uint(hi))
-			Cycle(4)
-			registers.DecrementSP()
-			mmu.WriteToMemoryCPU(registers.SP(), uint(low))
+			c.Cycle(4)
+			c.registers.DecrementSP()
+			c.mmu.WriteToMemoryCPU(c.registers.SP(), uint(hi))
+			c.Cycle(4)
+			c.registers.DecrementSP()
+			c.mmu.WriteToMemoryCPU(c.registers.SP(), uint(low))
 		}
 	} else {
-		Cycle(4)
-		registers.DecrementSP()
-		mmu.WriteToMemoryCPU(registers.SP(), uint(uint8(value)))
+		c.Cycle(4)
+		c.registers.DecrementSP()
+		c.mmu.WriteToMemoryCPU(c.registers.SP(), uint(uint8(value)))
 	}
 }
 
-func StackPOPSingle() uint {
-	Cycle(4)
-	value := mmu.ReadFromMemoryCPU(registers.SP())
-	registers.IncrementSP()
+func (c *CPU) StackPOPSingle() uint {
+	c.Cycle(4)
+	value := c.mmu.ReadFromMemoryCPU(c.registers.SP())
+	c.registers.IncrementSP()
 	return value
 }
-func StackPOP() uint {
-	low := StackPOPSingle()
-	hi := StackPOPSingle()
+func (c *CPU) StackPOP() uint {
+	low := c.StackPOPSingle()
+	hi := c.StackPOPSingle()
 	return uint(utility.SetHiLow(uint8(hi), uint8(low)))
 }
@@ -0,0 +1,136 @@
+package cpu
+
+// the CB prefixed opcodes follow the base ones in the table
+const _PREFIX_OFFSET = 0x100
+
+// builds the opcode table of the cpu, every opcode has its operands already resolved.
+// It is indexed by opcode (0x000 - 0x0FF) or 0x100 + opcode after the 0xCB prefix
+func (c *CPU) buildOpcodes() {
+	r := c.registers
+	reg_a := register(r.A, r.SetA)
+	reg_b := register(r.B, r.SetB)
+	reg_c := register(r.C, r.SetC)
+	reg_d := register(r.D, r.SetD)
+	reg_e := register(r.E, r.SetE)
+	reg_h := register(r.H, r.SetH)
+	reg_l := register(r.L, r.SetL)
+	reg_bc := register(r.BC, r.SetBC)
+	reg_de := register(r.DE, r.SetDE)
+	reg_hl := register(r.HL, r.SetHL)
+	reg_sp := register(r.SP, r.SetSP)
+	// the lower 4 bits of F are always 0
+	reg_af := register(r.AF, func(val uint) { r.SetAF(val & 0xFFF0) })
+
+	mem_bc := c.indirect(r.BC)
+	mem_de := c.indirect(r.DE)
+	mem_hl := c.indirect(r.HL)
+	absolute := c.absolute()
+
+	// d8 and d16
+	immediate8 := operand_t{get: c.fetch8}
+	immediate16 := operand_t{get: c.fetch16}
+
+	// operands in the order used by the opcode encoding
+	r8_operands := [8]operand_t{reg_b, reg_c, reg_d, reg_e, reg_h, reg_l, mem_hl, reg_a}
+	r16_operands := [4]operand_t{reg_bc, reg_de, reg_hl, reg_sp}
+	stack_operands := [4]operand_t{reg_bc, reg_de, reg_hl, reg_af}
+	conditions := [4]func() bool{c.condNZ, c.condZ, c.condNC, c.condC}
+
+	// 0x80 - 0xBF and 0xC6 - 0xFE
+	alu_handlers := [8]func(op operand_t){c.handleADD_A_n, c.handleADC_A_n, c.handleSUB_A_n, c.handleSBC_A_n, c.handleAND, c.handleXOR, c.handleOR, c.handleCP}
+
+	// 0xCB00 - 0xCB3F
+	shift_handlers := [8]func(op operand_t){c.handleRLC, c.handleRRC, c.handleRL, c.handleRR, c.handleSLA, c.handleSRA, c.handleSWAP, c.handleSRL}
+
+	opcodes := &c.opcodes
+	for i := range opcodes {
+		opcode := uint(i)
+		opcodes[i] = func() { notHandled(opcode) }
+	}
+
+	opcodes[0x00] = handleNOP
+	opcodes[0x07] = c.handleRLCA
+	opcodes[0x08] = c.handleLD_nn_SP
+	opcodes[0x0F] = c.handleRRCA
+	opcodes[0x10] = c.handleSTOP
+	opcodes[0x17] = c.handleRLA
+	opcodes[0x18] = c.handleJR_n
+	opcodes[0x1F] = c.handleRRA
+	opcodes[0x22] = c.handleLDI_HL_A
+	opcodes[0x27] = c.handleDAA
+	opcodes[0x2A] = c.handleLDI_A_HL
+	opcodes[0x2F] = c.handleCPL
+	opcodes[0x32] = c.handleLDD_HL_A
+	opcodes[0x37] = c.handleSCF
+	opcodes[0x3A] = c.handleLDD_A_HL
+	opcodes[0x3F] = c.handleCCF
+	opcodes[0x76] = c.handleHALT
+	opcodes[0xC3] = c.handleJP_nn
+	opcodes[0xC9] = c.handleRET
+	opcodes[0xCD] = c.handleCALL_nn
+	opcodes[0xD9] = c.handleRETI
+	opcodes[0xE0] = c.handleLDH_n_A
+	opcodes[0xE2] = c.handleLD_C_A
+	opcodes[0xE8] = c.handleADD_SP_n
+	opcodes[0xE9] = c.handleJP_HL
+	opcodes[0xF0] = c.handleLDH_A_n
+	opcodes[0xF2] = c.handleLD_A_C
+	opcodes[0xF3] = c.handleDI
+	opcodes[0xF8] = c.handleLDHL_SP_n
+	opcodes[0xF9] = c.handleLD_SP_HL
+	opcodes[0xFB] = c.handleEI
+
+	opcodes[0x02] = func() { handleLD(mem_bc, reg_a) }
+	opcodes[0x0A] = func() { handleLD(reg_a, mem_bc) }
+	opcodes[0x12] = func() { handleLD(mem_de, reg_a) }
+	opcodes[0x1A] = func() { handleLD(reg_a, mem_de) }
+	opcodes[0xEA] = func() { handleLD(absolute, reg_a) }
+	opcodes[0xFA] = func() { handleLD(reg_a, absolute) }
+
+	for i := uint(0); i < 4; i++ {
+		rr := r16_operands[i]
+		opcodes[0x01|i<<4] = func() { handleLD(rr, immediate16) }
+		opcodes[0x03|i<<4] = func() { c.handleINC_nn(rr) }
+		opcodes[0x09|i<<4] = func() { c.handleADD_HL_n(rr) }
+		opcodes[0x0B|i<<4] = func() { c.handleDEC_nn(rr) }
+
+		stack := stack_operands[i]
+		opcodes[0xC1|i<<4] = func() { c.handlePOP(stack) }
+		opcodes[0xC5|i<<4] = func() { c.handlePUSH(stack) }
+
+		cond := conditions[i]
+		opcodes[0x20|i<<3] = func() { c.handleJR_cc_n(cond) }
+		opcodes[0xC0|i<<3] = func() { c.handleRET_cc(cond) }
+		opcodes[0xC2|i<<3] = func() { c.handleJP_cc_nn(cond) }
+		opcodes[0xC4|i<<3] = func() { c.handleCALL_cc_nn(cond) }
+	}
+
+	for i := uint(0); i < 8; i++ {
+		r := r8_operands[i]
+		opcodes[0x04|i<<3] = func() { c.handleINC_n(r) }
+		opcodes[0x05|i<<3] = func() { c.handleDEC_n(r) }
+		opcodes[0x06|i<<3] = func() { handleLD(r, immediate8) }
+
+		vector := i << 3
+		opcodes[0xC7|i<<3] = func() { c.handleRST(vector) }
+
+		alu := alu_handlers[i]
+		opcodes[0xC6|i<<3] = func() { alu(immediate8) }
+
+		for j := uint(0); j < 8; j++ {
+			src := r8_operands[j]
+			// 0x76 would be LD (HL),(HL)
+			if i<<3|j != 0x36 {
+				opcodes[0x40|i<<3|j] = func() { handleLD(r, src) }
+			}
+			opcodes[0x80|i<<3|j] = func() { alu(src) }
+
+			shift := shift_handlers[i]
+			bit := i
+			opcodes[_PREFIX_OFFSET|i<<3|j] = func() { shift(src) }
+			opcodes[_PREFIX_OFFSET|0x40|i<<3|j] = func() { c.handleBIT(bit, src) }
+			opcodes[_PREFIX_OFFSET|0x80|i<<3|j] = func() { handleRES(bit, src) }
+			opcodes[_PREFIX_OFFSET|0xC0|i<<3|j] = func() { handleSET(bit, src) }
+		}
+	}
+}
@@ -0,0 +1,575 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/giammirove/gampboy_emulator/internal/decoder"
+	"github.com/giammirove/gampboy_emulator/internal/registers"
+)
+
+const _HELP = `numbers are hexadecimal, addresses can have a rom bank (bank:addr)
+  c, continue              run until the next stop
+  s, step [n]              execute n instructions
+  n, next                  step over calls
+  finish                   run until the current function returns
+  frame [n]                run n frames
+  line <ly>                run until the ppu enters scanline ly
+  b, break <addr> [if <cond>]
+  b, break if <cond>       stop when the condition holds, as "A == 3F"
+  watch [r|w|rw] <start> [end]
+                           stop when the cpu accesses the memory (default w)
+  delete [id]              remove a breakpoint or a watchpoint (or all)
+  info                     list breakpoints and watchpoints
+  r, regs                  print the registers
+  set <reg> <value>        change a register
+  x <addr> [len]           print the memory
+  write <addr> <value>...  change the memory
+  d, disasm [addr] [n]     disassemble around pc (or from addr)
+  detach                   remove the debugger and keep running
+  q, quit                  exit
+an empty line repeats the last command`
+
+var _CONDITION = regexp.MustCompile(`^([A-Za-z]+)\s*(==|!=|<=|>=|<|>)\s*(\S+)$`)
+
+// condition_t compares a register with a value
+type condition_t struct {
+	register string
+	op       string
+	value    uint
+}
+
+func (c *condition_t) eval(r *registers.Registers) bool {
+	get, _, _ := register(r, c.register)
+	v := get()
+	switch c.op {
+	case "==":
+		return v == c.value
+	case "!=":
+		return v != c.value
+	case "<":
+		return v < c.value
+	case ">":
+		return v > c.value
+	case "<=":
+		return v <= c.value
+	case ">=":
+		return v >= c.value
+	}
+	return false
+}
+
+func (c *condition_t) String() string {
+	return fmt.Sprintf("%s %s %X", c.register, c.op, c.value)
+}
+
+func parseCondition(s string) (*condition_t, error) {
+	match := _CONDITION.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return nil, fmt.Errorf("invalid condition %q", s)
+	}
+	name := strings.ToUpper(match[1])
+	if _, _, ok := register(nil, name); !ok {
+		return nil, fmt.Errorf("unknown register %s", match[1])
+	}
+	value, err := parseNumber(match[3])
+	if err != nil {
+		return nil, err
+	}
+	return &condition_t{register: name, op: match[2], value: value}, nil
+}
+
+// register gives the accessors of a register by name, r can be nil to
+// only check the name
+func register(r *registers.Registers, name string) (func() uint, func(uint), bool) {
+	switch name {
+	case "A":
+		return r.A, r.SetA, true
+	case "F":
+		return r.F, r.SetF, true
+	case "B":
+		return r.B, r.SetB, true
+	case "C":
+		return r.C, r.SetC, true
+	case "D":
+		return r.D, r.SetD, true
+	case "E":
+		return r.E, r.SetE, true
+	case "H":
+		return r.H, r.SetH, true
+	case "L":
+		return r.L, r.SetL, true
+	case "AF":
+		return r.AF, r.SetAF, true
+	case "BC":
+		return r.BC, r.SetBC, true
+	case "DE":
+		return r.DE, r.SetDE, true
+	case "HL":
+		return r.HL, r.SetHL, true
+	case "SP":
+		return r.SP, r.SetSP, true
+	case "PC":
+		return r.PC, r.SetPC, true
+	}
+	return nil, nil, false
+}
+
+func parseNumber(s string) (uint, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "0x"), "$")
+	value, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return uint(value), nil
+}
+
+// decimal count in args[1], def if missing
+func parseCount(args []string, def uint) (uint, error) {
+	if len(args) < 2 {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(args[1], 10, 32)
+	return uint(n), err
+}
+
+// address is a number, a label or label+offset
+func (d *Debugger) address(s string) (uint, error) {
+	label, offset := s, uint(0)
+	if i := strings.LastIndex(s, "+"); i > 0 {
+		var err error
+		if offset, err = parseNumber(s[i+1:]); err != nil {
+			return 0, err
+		}
+		label = s[:i]
+	}
+	if _, addr, ok := d.gb.CPU.Symbols.Find(label); ok {
+		return (addr + offset) & 0xFFFF, nil
+	}
+	return parseAddress(s)
+}
+
+func parseAddress(s string) (uint, error) {
+	addr, err := parseNumber(s)
+	if err == nil && addr > 0xFFFF {
+		err = fmt.Errorf("invalid address %q", s)
+	}
+	return addr, err
+}
+
+// waits for a command that resumes the machine
+func (d *Debugger) prompt(reason string) {
+	if reason != "" {
+		fmt.Fprintf(d.out, "Stopped: %s\n", reason)
+	}
+	d.printLocation()
+	for {
+		fmt.Fprintf(d.out, "(gampboy) ")
+		if !d.in.Scan() {
+			// nobody is typing, the machine goes on alone
+			fmt.Fprintf(d.out, "\n")
+			d.Detach()
+			return
+		}
+		line := strings.TrimSpace(d.in.Text())
+		if line == "" {
+			line = d.last
+		}
+		d.last = line
+		if line == "" {
+			continue
+		}
+		resume, err := d.execute(strings.Fields(line))
+		if err != nil {
+			fmt.Fprintf(d.out, "Error: %s\n", err)
+		}
+		if resume {
+			return
+		}
+	}
+}
+
+// execute runs a command, it returns true if the machine has to resume
+func (d *Debugger) execute(args []string) (bool, error) {
+	r := d.gb.Registers
+	switch args[0] {
+	case "h", "help":
+		fmt.Fprintln(d.out, _HELP)
+	case "c", "continue":
+		d.mode = _MODE_RUN
+		return true, nil
+	case "s", "step":
+		n, err := parseCount(args, 1)
+		if err != nil || n == 0 {
+			return false, fmt.Errorf("invalid count %q", args[1])
+		}
+		d.mode = _MODE_STEP
+		d.steps = int(n)
+		return true, nil
+	case "n", "next":
+		addr := r.PC()
+		instruction := decoder.Decode(&addr, d.read)
+		d.mode = _MODE_STEP
+		d.steps = 1
+		if instruction.Mnemonic == "CALL" || instruction.Mnemonic == "RST" {
+			d.mode = _MODE_NEXT
+			d.target = addr & 0xFFFF
+			d.target_sp = r.SP()
+		}
+		return true, nil
+	case "finish":
+		d.mode = _MODE_FINISH
+		d.target_sp = r.SP()
+		return true, nil
+	case "frame":
+		n, err := parseCount(args, 1)
+		if err != nil {
+			return false, fmt.Errorf("invalid count %q", args[1])
+		}
+		d.mode = _MODE_FRAME
+		d.target = uint(d.gb.PPU.GetCurrentFrame()) + n
+		return true, nil
+	case "line":
+		if len(args) < 2 {
+			return false, errors.New("line needs a scanline")
+		}
+		ly, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil || ly > 153 {
+			return false, fmt.Errorf("invalid scanline %q", args[1])
+		}
+		d.mode = _MODE_LINE
+		d.target = uint(ly)
+		d.last_ly = d.gb.MMU.ReadFromMemory(_LY)
+		return true, nil
+	case "b", "break":
+		return false, d.addBreakpoint(args[1:])
+	case "watch":
+		return false, d.addWatchpoint(args[1:])
+	case "delete":
+		return false, d.delete(args[1:])
+	case "info":
+		d.printInfo()
+	case "r", "regs":
+		d.printRegisters()
+	case "set":
+		if len(args) < 3 {
+			return false, errors.New("set needs a register and a value")
+		}
+		_, set, ok := register(r, strings.ToUpper(args[1]))
+		if !ok {
+			return false, fmt.Errorf("unknown register %s", args[1])
+		}
+		value, err := parseNumber(args[2])
+		if err != nil {
+			return false, err
+		}
+		set(value)
+		d.printRegisters()
+	case "x":
+		return false, d.dump(args[1:])
+	case "write":
+		if len(args) < 3 {
+			return false, errors.New("write needs an address and the values")
+		}
+		addr, err := d.address(args[1])
+		if err != nil {
+			return false, err
+		}
+		for i, arg := range args[2:] {
+			value, err := parseNumber(arg)
+			if err != nil || value > 0xFF {
+				return false, fmt.Errorf("invalid byte %q", arg)
+			}
+			d.gb.MMU.WriteToMemory((addr+uint(i))&0xFFFF, value)
+		}
+	case "d", "disasm":
+		return false, d.disasm(args[1:])
+	case "detach":
+		d.Detach()
+		return true, nil
+	case "q", "quit":
+		// the front end closes the emulator at the end of the step
+		d.Detach()
+		d.gb.CPU.RequestQuit()
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown command %q, try help", args[0])
+	}
+	return false, nil
+}
+
+func (d *Debugger) addBreakpoint(args []string) error {
+	b := breakpoint_t{addr: -1, bank: -1}
+	if len(args) > 0 && args[0] != "if" {
+		location := args[0]
+		if i := strings.Index(location, ":"); i >= 0 {
+			bank, err := parseNumber(location[:i])
+			if err != nil {
+				return err
+			}
+			b.bank = int(bank)
+			location = location[i+1:]
+		}
+		if bank, addr, ok := d.gb.CPU.Symbols.Find(location); ok && b.bank < 0 {
+			// the label is in a single bank
+			b.addr = int(addr)
+			if addr >= 0x4000 && addr <= 0x7FFF {
+				b.bank = int(bank)
+			}
+		} else {
+			addr, err := d.address(location)
+			if err != nil {
+				return err
+			}
+			b.addr = int(addr)
+		}
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		if args[0] != "if" || len(args) < 2 {
+			return errors.New("usage: break <addr> [if <cond>]")
+		}
+		cond, err := parseCondition(strings.Join(args[1:], " "))
+		if err != nil {
+			return err
+		}
+		b.cond = cond
+	}
+	if b.addr < 0 && b.cond == nil {
+		return errors.New("break needs an address or a condition")
+	}
+	d.ids++
+	b.id = d.ids
+	d.breakpoints = append(d.breakpoints, b)
+	fmt.Fprintf(d.out, "Breakpoint %d: %s\n", b.id, b.String())
+	return nil
+}
+
+func (b breakpoint_t) String() string {
+	s := "any"
+	if b.addr >= 0 {
+		s = fmt.Sprintf("%04X", b.addr)
+		if b.bank >= 0 {
+			s = fmt.Sprintf("%02X:%s", b.bank, s)
+		}
+	}
+	if b.cond != nil {
+		s += " if " + b.cond.String()
+	}
+	return s
+}
+
+func (d *Debugger) addWatchpoint(args []string) error {
+	w := watchpoint_t{write: true}
+	if len(args) > 0 {
+		switch args[0] {
+		case "r":
+			w.read, w.write = true, false
+			args = args[1:]
+		case "w":
+			args = args[1:]
+		case "rw":
+			w.read = true
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 {
+		return errors.New("usage: watch [r|w|rw] <start> [end]")
+	}
+	var err error
+	if w.start, err = d.address(args[0]); err != nil {
+		return err
+	}
+	w.end = w.start
+	if len(args) > 1 {
+		if w.end, err = d.address(args[1]); err != nil {
+			return err
+		}
+		if w.end < w.start {
+			return errors.New("the end comes before the start")
+		}
+	}
+	d.ids++
+	w.id = d.ids
+	d.watchpoints = append(d.watchpoints, w)
+	d.updateWatch()
+	fmt.Fprintf(d.out, "Watchpoint %d: %s\n", w.id, w.String())
+	return nil
+}
+
+func (w watchpoint_t) String() string {
+	kind := ""
+	if w.read {
+		kind += "r"
+	}
+	if w.write {
+		kind += "w"
+	}
+	if w.start == w.end {
+		return fmt.Sprintf("%s %04X", kind, w.start)
+	}
+	return fmt.Sprintf("%s %04X-%04X", kind, w.start, w.end)
+}
+
+func (d *Debugger) delete(args []string) error {
+	if len(args) == 0 {
+		d.breakpoints = nil
+		d.watchpoints = nil
+		d.updateWatch()
+		return nil
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid id %q", args[0])
+	}
+	for i, b := range d.breakpoints {
+		if b.id == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	for i, w := range d.watchpoints {
+		if w.id == id {
+			d.watchpoints = append(d.watchpoints[:i], d.watchpoints[i+1:]...)
+			d.updateWatch()
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint or watchpoint %d", id)
+}
+
+func (d *Debugger) printInfo() {
+	if len(d.breakpoints) == 0 && len(d.watchpoints) == 0 {
+		fmt.Fprintf(d.out, "No breakpoints or watchpoints\n")
+	}
+	for _, b := range d.breakpoints {
+		fmt.Fprintf(d.out, "%3d break %s\n", b.id, b.String())
+	}
+	for _, w := range d.watchpoints {
+		fmt.Fprintf(d.out, "%3d watch %s\n", w.id, w.String())
+	}
+}
+
+func (d *Debugger) printRegisters() {
+	r := d.gb.Registers
+	flags := []byte("----")
+	for i, set := range []bool{r.Z_flag(), r.N_flag(), r.H_flag(), r.C_flag()} {
+		if set {
+			flags[i] = "ZNHC"[i]
+		}
+	}
+	fmt.Fprintf(d.out, "A: %02X F: %s BC: %04X DE: %04X HL: %04X SP: %04X PC: %04X\n", r.A(), flags, r.BC(), r.DE(), r.HL(), r.SP(), r.PC())
+	fmt.Fprintf(d.out, "ROM: %02X RAM: %02X LY: %02X IME: %t HALT: %t FRAME: %d\n", d.gb.MMU.GetRomBank(), d.gb.MMU.GetRamBank(), d.gb.MMU.ReadFromMemory(_LY), d.gb.Interrupts.GetIME(), d.gb.CPU.GetHalted(), d.gb.PPU.GetCurrentFrame())
+}
+
+func (d *Debugger) printLocation() {
+	pc := d.gb.Registers.PC()
+	d.printInstructions(pc, 1)
+	d.printRegisters()
+}
+
+func (d *Debugger) dump(args []string) error {
+	if len(args) == 0 {
+		return errors.New("x needs an address")
+	}
+	addr, err := d.address(args[0])
+	if err != nil {
+		return err
+	}
+	length := uint(0x40)
+	if len(args) > 1 {
+		if length, err = parseNumber(args[1]); err != nil {
+			return err
+		}
+	}
+	for i := uint(0); i < length; i += 16 {
+		fmt.Fprintf(d.out, "%04X:", (addr+i)&0xFFFF)
+		for j := i; j < i+16 && j < length; j++ {
+			fmt.Fprintf(d.out, " %02X", d.read(addr+j))
+		}
+		fmt.Fprintf(d.out, "\n")
+	}
+	return nil
+}
+
+func (d *Debugger) disasm(args []string) error {
+	count := 10
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid count %q", args[1])
+		}
+		count = n
+	}
+	if len(args) > 0 {
+		addr, err := d.address(args[0])
+		if err != nil {
+			return err
+		}
+		d.printInstructions(addr, count)
+		return nil
+	}
+	pc := d.gb.Registers.PC()
+	start := d.before(pc, count/2)
+	d.printInstructions(start, count)
+	return nil
+}
+
+// instructions can't be decoded backwards, the start is the furthest
+// address (up to count instructions) whose instructions end exactly on pc
+func (d *Debugger) before(pc uint, count int) uint {
+	start := pc
+	for back := uint(1); back <= uint(count)*3 && back <= pc; back++ {
+		addr := pc - back
+		n := 0
+		for addr < pc {
+			decoder.Decode(&addr, d.read)
+			n++
+		}
+		if addr == pc && n <= count {
+			start = pc - back
+		}
+	}
+	return start
+}
+
+func (d *Debugger) printInstructions(addr uint, count int) {
+	pc := d.gb.Registers.PC()
+	for i := 0; i < count; i++ {
+		start := addr & 0xFFFF
+		next := start
+		instruction := decoder.Decode(&next, d.read)
+		marker := "  "
+		if start == pc {
+			marker = "=>"
+		}
+		bytes := ""
+		for a := start; a < next; a++ {
+			bytes += fmt.Sprintf("%02X ", d.read(a))
+		}
+		bank := d.bank(start)
+		// Label+$offset, only when a label is close enough
+		location := ""
+		if l := d.gb.CPU.Symbols.Format(bank, start); !strings.HasPrefix(l, "$") {
+			location = " <" + l + ">"
+		}
+		fmt.Fprintf(d.out, "%s %02X:%04X%s  %-9s %s\n", marker, bank, start, location, bytes, decoder.PrintInstrunction(instruction))
+		addr = next
+	}
+}
+
+// reads without side effects, the addresses wrap around
+func (d *Debugger) read(addr uint, bytes ...uint) uint {
+	n := uint(1)
+	if len(bytes) == 1 {
+		n = bytes[0]
+	}
+	value := uint(0)
+	for i := uint(0); i < n; i++ {
+		value |= d.gb.MMU.ReadFromMemory((addr+i)&0xFFFF) << (8 * i)
+	}
+	return value
+}
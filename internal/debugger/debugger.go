@@ -0,0 +1,213 @@
+// Package debugger is a console that stops the machine on breakpoints,
+// watchpoints and steps, it runs on the goroutine of the emulation
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/giammirove/gampboy_emulator/internal/decoder"
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+)
+
+const _LY = 0xFF44
+
+// how the machine is running between two prompts
+const (
+	_MODE_RUN = iota
+	_MODE_STEP
+	_MODE_NEXT
+	_MODE_FINISH
+	_MODE_FRAME
+	_MODE_LINE
+)
+
+type breakpoint_t struct {
+	id int
+	// -1 = any
+	addr int
+	bank int
+	// nil = always
+	cond *condition_t
+}
+
+type watchpoint_t struct {
+	id    int
+	start uint
+	end   uint
+	read  bool
+	write bool
+}
+
+// Debugger reads the commands from in and writes to out
+type Debugger struct {
+	gb  *emulator.GameBoy
+	in  *bufio.Scanner
+	out io.Writer
+
+	breakpoints []breakpoint_t
+	watchpoints []watchpoint_t
+	ids         int
+
+	mode  int
+	steps int
+	// pc and sp for next, sp for finish, frame or scanline
+	target    uint
+	target_sp uint
+	last_ly   uint
+	// for finish, a return is executed in this step and sp before it
+	returning bool
+	return_sp uint
+	// the instruction being executed, its fetches are not reads
+	pc        uint
+	fetch_end uint
+	// reason of the next stop
+	stop string
+	last string
+}
+
+// New attaches a debugger to the machine, it stops before the first
+// instruction if stopped is set
+func New(gb *emulator.GameBoy, in io.Reader, out io.Writer, stopped bool) *Debugger {
+	d := &Debugger{gb: gb, in: bufio.NewScanner(in), out: out}
+	if stopped {
+		d.stop = "started"
+	}
+	gb.CPU.BeforeStep = d.beforeStep
+	return d
+}
+
+// Break stops the machine before the next instruction
+func (d *Debugger) Break() {
+	d.stop = "interrupted"
+}
+
+// Detach removes the hooks, the machine runs as if there was no debugger
+func (d *Debugger) Detach() {
+	d.gb.CPU.BeforeStep = nil
+	d.gb.MMU.Watch = nil
+}
+
+// an instruction is fetched in this step
+func (d *Debugger) executing() bool {
+	return !d.gb.CPU.GetHalted() && !d.gb.PPU.IsGDMATransferring()
+}
+
+func (d *Debugger) beforeStep() {
+	if reason, ok := d.check(); ok {
+		d.mode = _MODE_RUN
+		d.prompt(reason)
+	}
+	if d.mode == _MODE_FINISH {
+		d.returning = d.executing() && d.returns()
+		d.return_sp = d.gb.Registers.SP()
+	}
+	if len(d.watchpoints) > 0 {
+		d.pc = d.gb.Registers.PC()
+		d.fetch_end = d.pc
+		if d.executing() {
+			decoder.Decode(&d.fetch_end, d.gb.MMU.ReadFromMemory)
+		}
+	}
+}
+
+// check tells if the machine has to stop and why
+func (d *Debugger) check() (string, bool) {
+	if d.stop != "" {
+		reason := d.stop
+		d.stop = ""
+		return reason, true
+	}
+	r := d.gb.Registers
+	executing := d.executing()
+	switch d.mode {
+	case _MODE_STEP:
+		if executing {
+			d.steps--
+			if d.steps <= 0 {
+				return "", true
+			}
+		}
+	case _MODE_NEXT:
+		if executing && r.PC() == d.target && r.SP() >= d.target_sp {
+			return "", true
+		}
+	case _MODE_FINISH:
+		// the pops of what was pushed before finish are not returns
+		if d.returning && r.SP() > d.return_sp && r.SP() > d.target_sp {
+			return "returned", true
+		}
+	case _MODE_FRAME:
+		if uint(d.gb.PPU.GetCurrentFrame()) >= d.target {
+			return fmt.Sprintf("frame %d", d.target), true
+		}
+	case _MODE_LINE:
+		ly := d.gb.MMU.ReadFromMemory(_LY)
+		entered := ly == d.target && d.last_ly != d.target
+		d.last_ly = ly
+		if entered {
+			return fmt.Sprintf("scanline %d", d.target), true
+		}
+	}
+	if !executing {
+		return "", false
+	}
+	for _, b := range d.breakpoints {
+		if d.matches(b) {
+			return fmt.Sprintf("breakpoint %d", b.id), true
+		}
+	}
+	return "", false
+}
+
+// the instruction at pc is RET, RETI or RET cc
+func (d *Debugger) returns() bool {
+	switch d.gb.MMU.ReadFromMemory(d.gb.Registers.PC()) {
+	case 0xC9, 0xD9, 0xC0, 0xC8, 0xD0, 0xD8:
+		return true
+	}
+	return false
+}
+
+func (d *Debugger) matches(b breakpoint_t) bool {
+	pc := d.gb.Registers.PC()
+	if b.addr >= 0 && uint(b.addr) != pc {
+		return false
+	}
+	if b.bank >= 0 && uint(b.bank) != d.bank(pc) {
+		return false
+	}
+	return b.cond == nil || b.cond.eval(d.gb.Registers)
+}
+
+func (d *Debugger) bank(addr uint) uint {
+	return d.gb.MMU.GetBank(addr)
+}
+
+func (d *Debugger) watch(addr uint, value uint, write bool) {
+	// operands of the current instruction
+	if !write && addr >= d.pc && addr < d.fetch_end {
+		return
+	}
+	for _, w := range d.watchpoints {
+		if addr < w.start || addr > w.end || (write && !w.write) || (!write && !w.read) {
+			continue
+		}
+		kind := "read"
+		if write {
+			kind = "write"
+		}
+		d.stop = fmt.Sprintf("watchpoint %d, %s %02X at %s (pc %s)", w.id, kind, value, d.gb.CPU.Location(addr), d.gb.CPU.Location(d.pc))
+		return
+	}
+}
+
+// the mmu calls the debugger only while there are watchpoints
+func (d *Debugger) updateWatch() {
+	if len(d.watchpoints) > 0 {
+		d.gb.MMU.Watch = d.watch
+	} else {
+		d.gb.MMU.Watch = nil
+	}
+}
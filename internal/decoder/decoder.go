@@ -1,12 +1,9 @@
 package decoder
 
 import (
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"log"
-
-	mmu "github.com/giammirove/gampboy_emulator/internal/mmu"
 )
 
 const OPCODE_JSON_PATH = "./assets/newopcodes.json"
@@ -37,45 +34,13 @@ type Instruction_t struct {
 }
 
 var instructions [2][]Instruction_t
-var data []byte
-var Cycle func(val uint)
-
-func InitDecoder() {
-	ReadOpcodes()
-}
 
-func ReadOpcodes() {
+// the table is read once and only read afterwards, so every machine shares it
+func init() {
 	err := json.Unmarshal([]byte(opcodes_json), &instructions)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-}
-
-func read_from_data(addr uint, args ...uint) uint {
-
-	if len(args) > 1 {
-		log.Fatal("Too many parameters")
-	}
-
-	length := uint(1)
-	if len(args) == 1 {
-		length = args[0]
-	}
-
-	end := int(addr + length)
-	if end < 0 || end >= len(data) {
-		log.Fatal("Out of bound")
-	}
-
-	var arr []byte
-	for i := 0; i < int(length); i++ {
-		arr = append(arr, data[int(addr)+i])
-	}
-	for i := length; i < 4; i++ {
-		arr = append(arr, 0x00)
-	}
-	return uint(binary.LittleEndian.Uint32(arr))
 }
 
 func copyInstruction(dst *Instruction_t, src Instruction_t) {
@@ -108,6 +73,11 @@ func printOperand(operand Operand_t) string {
 	return fmt.Sprintf("(%s)", s)
 }
 
+// PrintOperand formats an operand as PrintInstrunction does
+func PrintOperand(operand Operand_t) string {
+	return printOperand(operand)
+}
+
 func PrintInstrunction(ins Instruction_t) string {
 	s := fmt.Sprintf("(%02X) %s ", ins.Opcode, ins.Mnemonic)
 	for i := 0; i < len(ins.Operands); i++ {
@@ -119,17 +89,17 @@ func PrintInstrunction(ins Instruction_t) string {
 	return s
 }
 
-func Decode(addr *uint) Instruction_t {
+// Decode reads the instruction at addr through read without side effects,
+// it is only used to print the instructions (the cpu has its own opcode table)
+func Decode(addr *uint, read func(addr uint, bytes ...uint) uint) Instruction_t {
 
-	Cycle(4)
-	opcode := mmu.ReadFromMemoryCPU(*addr)
+	opcode := read(*addr)
 	(*addr)++
 
 	instruction := Instruction_t{}
 	index := 0
 	if opcode == OPCODE_PREFIX {
-		Cycle(4)
-		opcode = mmu.ReadFromMemoryCPU(*addr)
+		opcode = read(*addr)
 		(*addr)++
 		index = 1
 	}
@@ -145,8 +115,7 @@ func Decode(addr *uint) Instruction_t {
 	for i := 0; i < len(operands); i++ {
 		op := operands[i]
 		if op.Bytes > 0 {
-			Cycle(4 * uint(op.Bytes))
-			value := mmu.ReadFromMemoryCPU(*addr, op.Bytes)
+			value := read(*addr, op.Bytes)
 			(*addr) += op.Bytes
 			op.Value = value
 			op.Withvalue = true
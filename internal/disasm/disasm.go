@@ -0,0 +1,384 @@
+// Package disasm disassembles a whole rom, the code is told apart from the
+// data following the jumps and the calls from the entry points
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/giammirove/gampboy_emulator/internal/decoder"
+	"github.com/giammirove/gampboy_emulator/internal/symbols"
+)
+
+const _BANK_SIZE = 0x4000
+const _ROMX_START = 0x4000
+const _ROMX_END = 0x7FFF
+
+// writes here select the rom bank (MBC1, MBC3 and MBC5)
+const _ROM_BANK_START = 0x2000
+const _ROM_BANK_END = 0x3FFF
+
+const _LD_A_D8 = 0x3E
+const _LD_A16_A = 0xEA
+
+// bytes of data in a line
+const _DATA_LINE = 16
+
+// repeated bytes (padding) shorter than this are printed as they are
+const _MIN_FILL = 32
+
+// where the execution starts, in bank 0
+var _ENTRIES = []struct {
+	addr  uint
+	label string
+}{
+	{0x00, "rst_00"}, {0x08, "rst_08"}, {0x10, "rst_10"}, {0x18, "rst_18"},
+	{0x20, "rst_20"}, {0x28, "rst_28"}, {0x30, "rst_30"}, {0x38, "rst_38"},
+	{0x40, "int_vblank"}, {0x48, "int_stat"}, {0x50, "int_timer"},
+	{0x58, "int_serial"}, {0x60, "int_joypad"},
+	{0x100, "entry"},
+}
+
+type disassembler_t struct {
+	rom     []byte
+	banks   uint
+	symbols *symbols.Table
+	// first byte of an instruction and every byte of the code
+	starts []bool
+	code   []bool
+	// generated labels, by rom offset
+	labels map[uint]string
+	// where the jumps and calls go, by rom offset of the instruction
+	targets map[uint]uint
+	// rom offsets to follow
+	queue []uint
+}
+
+// Disassemble writes the rom as assembly to w, the labels of table (that
+// can be nil) replace the generated ones
+func Disassemble(rom []byte, table *symbols.Table, w io.Writer) error {
+	banks := uint(len(rom)+_BANK_SIZE-1) / _BANK_SIZE
+	d := &disassembler_t{
+		rom:     rom,
+		banks:   banks,
+		symbols: table,
+		starts:  make([]bool, len(rom)),
+		code:    make([]bool, len(rom)),
+		labels:  map[uint]string{},
+		targets: map[uint]uint{},
+	}
+	for _, entry := range _ENTRIES {
+		d.enqueue(entry.addr, entry.label)
+	}
+	// the labels of the rom are code or data, the data stops at the
+	// first illegal instruction
+	table.Each(func(bank uint, addr uint, label string) {
+		if addr > _ROMX_END {
+			return
+		}
+		// a rom without mbc has the switchable area in bank 0
+		if addr >= _ROMX_START && bank == 0 {
+			bank = 1
+		}
+		d.enqueue(offset(bank, addr), label)
+	})
+	for len(d.queue) > 0 {
+		offset := d.queue[len(d.queue)-1]
+		d.queue = d.queue[:len(d.queue)-1]
+		d.trace(offset)
+	}
+
+	out := bufio.NewWriter(w)
+	for bank := uint(0); bank < banks; bank++ {
+		d.writeBank(out, bank)
+	}
+	return out.Flush()
+}
+
+// location of a rom offset as the cpu sees it
+func location(offset uint) (uint, uint) {
+	bank := offset / _BANK_SIZE
+	if bank == 0 {
+		return 0, offset
+	}
+	return bank, _ROMX_START + offset%_BANK_SIZE
+}
+
+func offset(bank uint, addr uint) uint {
+	if addr < _ROMX_START {
+		return addr
+	}
+	return bank*_BANK_SIZE + addr%_BANK_SIZE
+}
+
+func (d *disassembler_t) enqueue(offset uint, label string) {
+	if offset >= uint(len(d.rom)) {
+		return
+	}
+	if _, ok := d.labels[offset]; !ok || strings.HasPrefix(d.labels[offset], "jump_") {
+		d.labels[offset] = label
+	}
+	if !d.starts[offset] {
+		d.queue = append(d.queue, offset)
+	}
+}
+
+// follows the code from offset until it jumps away or returns
+func (d *disassembler_t) trace(start uint) {
+	bank, addr := location(start)
+	// the bank selected by the code, -1 until it writes one
+	rom_bank := -1
+	// the value of A loaded by the previous instruction, -1 if unknown
+	a := -1
+	for {
+		// the code runs off the end of the bank
+		if (bank == 0 && addr >= _ROMX_START) || addr > _ROMX_END {
+			return
+		}
+		offset := offset(bank, addr)
+		if offset >= uint(len(d.rom)) || d.code[offset] {
+			return
+		}
+		next := addr
+		instruction := decoder.Decode(&next, d.reader(bank))
+		if (addr < _ROMX_START && next > _ROMX_START) || next > _ROMX_END+1 {
+			return
+		}
+		if strings.HasPrefix(instruction.Mnemonic, "ILLEGAL") {
+			return
+		}
+		for i := uint(0); i < next-addr; i++ {
+			d.code[offset+i] = true
+		}
+		d.starts[offset] = true
+
+		if target, ok := d.target(bank, addr, next, instruction, rom_bank); ok {
+			d.targets[offset] = target
+			prefix := "jump"
+			if instruction.Mnemonic == "CALL" || instruction.Mnemonic == "RST" {
+				prefix = "call"
+			}
+			target_bank, target_addr := location(target)
+			d.enqueue(target, fmt.Sprintf("%s_%02X_%04X", prefix, target_bank, target_addr))
+		}
+		if ends(instruction) {
+			return
+		}
+		a, rom_bank = d.selectBank(instruction, a, rom_bank)
+		addr = next
+	}
+}
+
+// follows LD A,n ; LD ($2000),A, the calls and jumps to the switchable
+// area that come after it go to that bank
+func (d *disassembler_t) selectBank(instruction decoder.Instruction_t, a int, rom_bank int) (int, int) {
+	if instruction.Mnemonic != "LD" {
+		return -1, rom_bank
+	}
+	switch instruction.Opcode {
+	case _LD_A_D8:
+		return int(instruction.Operands[1].Value), rom_bank
+	case _LD_A16_A:
+		dest := instruction.Operands[0].Value
+		if a < 0 || dest < _ROM_BANK_START || dest > _ROM_BANK_END {
+			return a, rom_bank
+		}
+		// 0 selects bank 1, as on MBC1 and MBC3
+		if a == 0 {
+			return a, 1
+		}
+		return a, a
+	}
+	return -1, rom_bank
+}
+
+// reads the rom as the cpu would with bank mapped
+func (d *disassembler_t) reader(bank uint) func(addr uint, bytes ...uint) uint {
+	return func(addr uint, bytes ...uint) uint {
+		n := uint(1)
+		if len(bytes) == 1 {
+			n = bytes[0]
+		}
+		value := uint(0)
+		for i := uint(0); i < n; i++ {
+			a := addr + i
+			o := offset(bank, a)
+			if a > _ROMX_END || o >= uint(len(d.rom)) {
+				continue
+			}
+			value |= uint(d.rom[o]) << (8 * i)
+		}
+		return value
+	}
+}
+
+// conditional operand, the flow can go on
+func conditional(instruction decoder.Instruction_t) bool {
+	if len(instruction.Operands) == 0 {
+		return false
+	}
+	switch instruction.Operands[0].Name {
+	case "NZ", "Z", "NC":
+		return true
+	case "C":
+		return len(instruction.Operands) > 1 || instruction.Mnemonic == "RET"
+	}
+	return false
+}
+
+// the next instruction is not reached
+func ends(instruction decoder.Instruction_t) bool {
+	switch instruction.Mnemonic {
+	case "JP", "JR", "RET":
+		return !conditional(instruction)
+	case "RETI":
+		return true
+	}
+	return false
+}
+
+// address jumped to, only the ones that can be found in the rom. From
+// bank 0 the switchable bank is the one selected before (rom_bank), or
+// the only one there is
+func (d *disassembler_t) target(bank uint, addr uint, next uint, instruction decoder.Instruction_t, rom_bank int) (uint, bool) {
+	var target uint
+	switch instruction.Mnemonic {
+	case "JP", "CALL":
+		last := instruction.Operands[len(instruction.Operands)-1]
+		if last.Name != "a16" {
+			return 0, false
+		}
+		target = last.Value
+	case "JR":
+		last := instruction.Operands[len(instruction.Operands)-1]
+		target = uint(int(next)+int(int8(last.Value))) & 0xFFFF
+	case "RST":
+		target = instruction.Opcode & 0x38
+	default:
+		return 0, false
+	}
+	if target < _ROMX_START {
+		return target, true
+	}
+	if target > _ROMX_END {
+		return 0, false
+	}
+	if rom_bank > 0 {
+		return offset(uint(rom_bank), target), true
+	}
+	if addr >= _ROMX_START {
+		return offset(bank, target), true
+	}
+	if d.banks == 2 {
+		return offset(1, target), true
+	}
+	return 0, false
+}
+
+func (d *disassembler_t) label(offset uint) (string, bool) {
+	bank, addr := location(offset)
+	if label, ok := d.symbols.Label(bank, addr); ok {
+		return label, true
+	}
+	label, ok := d.labels[offset]
+	return label, ok
+}
+
+func (d *disassembler_t) writeBank(w *bufio.Writer, bank uint) {
+	start := bank * _BANK_SIZE
+	end := start + _BANK_SIZE
+	if end > uint(len(d.rom)) {
+		end = uint(len(d.rom))
+	}
+	if bank == 0 {
+		fmt.Fprintf(w, "SECTION \"ROM Bank $%03X\", ROM0[$0000]\n\n", bank)
+	} else {
+		fmt.Fprintf(w, "\nSECTION \"ROM Bank $%03X\", ROMX[$4000], BANK[$%X]\n\n", bank, bank)
+	}
+	for offset := start; offset < end; {
+		if label, ok := d.label(offset); ok {
+			fmt.Fprintf(w, "%s:\n", label)
+		}
+		if d.starts[offset] {
+			offset = d.writeInstruction(w, offset)
+		} else {
+			offset = d.writeData(w, offset, end)
+		}
+	}
+}
+
+func (d *disassembler_t) writeInstruction(w *bufio.Writer, offset uint) uint {
+	bank, addr := location(offset)
+	next := addr
+	instruction := decoder.Decode(&next, d.reader(bank))
+	text := instruction.Mnemonic
+	for i, operand := range instruction.Operands {
+		if i == 0 {
+			text += " "
+		} else {
+			text += ","
+		}
+		text += d.operand(bank, addr, next, instruction, operand)
+	}
+	bytes := ""
+	for i := uint(0); i < next-addr; i++ {
+		bytes += fmt.Sprintf(" %02X", d.rom[offset+i])
+	}
+	fmt.Fprintf(w, "\t%-24s ; %02X:%04X %s\n", text, bank, addr, bytes)
+	return offset + next - addr
+}
+
+// jump targets are printed as labels
+func (d *disassembler_t) operand(bank uint, addr uint, next uint, instruction decoder.Instruction_t, operand decoder.Operand_t) string {
+	switch operand.Name {
+	case "a16", "r8":
+		if instruction.Mnemonic != "JP" && instruction.Mnemonic != "CALL" && instruction.Mnemonic != "JR" {
+			break
+		}
+		target, ok := d.targets[offset(bank, addr)]
+		if !ok {
+			target, ok = d.target(bank, addr, next, instruction, -1)
+		}
+		if ok {
+			if label, ok := d.label(target); ok {
+				return label
+			}
+		}
+		if operand.Name == "r8" {
+			return fmt.Sprintf("0x%X", uint(int(next)+int(int8(operand.Value)))&0xFFFF)
+		}
+	}
+	return decoder.PrintOperand(operand)
+}
+
+// data goes on until the next instruction or label
+func (d *disassembler_t) writeData(w *bufio.Writer, offset uint, end uint) uint {
+	bank, addr := location(offset)
+	length := uint(1)
+	for offset+length < end && !d.starts[offset+length] {
+		if _, ok := d.label(offset + length); ok {
+			break
+		}
+		length++
+	}
+	// padding
+	fill := uint(1)
+	for fill < length && d.rom[offset+fill] == d.rom[offset] {
+		fill++
+	}
+	if fill >= _MIN_FILL {
+		fmt.Fprintf(w, "\t%-24s ; %02X:%04X\n", fmt.Sprintf("ds $%X, $%02X", fill, d.rom[offset]), bank, addr)
+		return offset + fill
+	}
+	if length > _DATA_LINE {
+		length = _DATA_LINE
+	}
+	values := make([]string, length)
+	for i := range values {
+		values[i] = fmt.Sprintf("$%02X", d.rom[offset+uint(i)])
+	}
+	fmt.Fprintf(w, "\t%-24s ; %02X:%04X\n", "db "+strings.Join(values, ","), bank, addr)
+	return offset + length
+}
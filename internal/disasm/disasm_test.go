@@ -0,0 +1,59 @@
+package disasm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/giammirove/gampboy_emulator/internal/symbols"
+	"github.com/giammirove/gampboy_emulator/internal/testutil"
+)
+
+// a MBC1 cartridge with 4 banks, bank 0 selects the banks before
+// calling them
+func bankedROM() []byte {
+	rom := testutil.ROM([]byte{
+		// LD A,$02 ; LD ($2000),A ; CALL $4000
+		0x3E, 0x02, 0xEA, 0x00, 0x20, 0xCD, 0x00, 0x40,
+		// LD A,$03 ; LD ($2100),A ; JP $4100
+		0x3E, 0x03, 0xEA, 0x00, 0x21, 0xC3, 0x00, 0x41,
+	})
+	rom = append(rom, make([]byte, 2*_BANK_SIZE)...)
+	// bank 1, only the symbols tell that it is code: XOR A ; RET
+	copy(rom[1*_BANK_SIZE+0x200:], []byte{0xAF, 0xC9})
+	// bank 2: INC B ; RET
+	copy(rom[2*_BANK_SIZE:], []byte{0x04, 0xC9})
+	// bank 3: HALT ; JR -3
+	copy(rom[3*_BANK_SIZE+0x100:], []byte{0x76, 0x18, 0xFD})
+	rom[0x147] = 0x01
+	rom[0x148] = 0x01
+	testutil.Checksum(rom)
+	return rom
+}
+
+func TestBanks(t *testing.T) {
+	table, err := symbols.Parse(strings.NewReader("01:4200 Orphan\n02:4000 Far\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := Disassemble(bankedROM(), table, &out); err != nil {
+		t.Fatal(err)
+	}
+	asm := out.String()
+	for _, line := range []string{
+		"CALL Far",
+		"JP jump_03_4100",
+		"Far:\n\tINC B                    ; 02:4000  04\n",
+		"\tRET                      ; 02:4001  C9\n",
+		"jump_03_4100:\n\tHALT                     ; 03:4100  76\n",
+		"\tJR jump_03_4100          ; 03:4101  18 FD\n",
+		"Orphan:\n\tXOR A                    ; 01:4200  AF\n",
+	} {
+		if !strings.Contains(asm, line) {
+			t.Errorf("missing %q", line)
+		}
+	}
+	if t.Failed() {
+		t.Log(asm)
+	}
+}
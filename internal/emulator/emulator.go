@@ -0,0 +1,130 @@
+package emulator
+
+import (
+	"fmt"
+
+	"github.com/giammirove/gampboy_emulator/internal/cpu"
+	"github.com/giammirove/gampboy_emulator/internal/headers"
+	"github.com/giammirove/gampboy_emulator/internal/interrupts"
+	"github.com/giammirove/gampboy_emulator/internal/joypad"
+	"github.com/giammirove/gampboy_emulator/internal/mmu"
+	"github.com/giammirove/gampboy_emulator/internal/ppu"
+	"github.com/giammirove/gampboy_emulator/internal/registers"
+	"github.com/giammirove/gampboy_emulator/internal/serial"
+	"github.com/giammirove/gampboy_emulator/internal/sound"
+	"github.com/giammirove/gampboy_emulator/internal/timer"
+)
+
+// GameBoy owns one instance of every component,
+// many of them can run side by side
+type GameBoy struct {
+	Header     *headers.Header
+	Registers  *registers.Registers
+	Interrupts *interrupts.Interrupts
+	Timer      *timer.Timer
+	Serial     *serial.Serial
+	Joypad     *joypad.Joypad
+	PPU        *ppu.PPU
+	APU        *sound.APU
+	MMU        *mmu.MMU
+	CPU        *cpu.CPU
+}
+
+// Options of a new machine
+type Options struct {
+	// where the rom was loaded from, the battery saves are stored next to it
+	Path string
+	// the MBC3 clock follows the host clock instead of the emulated one
+	RTCHostClock bool
+	// DMG or CGB boot rom, nil starts from the state it leaves
+	BootROM []byte
+	// console to emulate, auto follows the boot rom or the cartridge
+	Model headers.Model
+	// the battery ram starts empty and is never written to the disk
+	NoSaves bool
+}
+
+// New creates the components and connects them together,
+// the front end only has to set its own hooks (gui, audio, ...)
+func New(rom []byte, opts Options) (*GameBoy, error) {
+	gb := &GameBoy{}
+	gb.Header = headers.New()
+	gb.Registers = registers.New(gb.Header)
+	gb.Interrupts = interrupts.New(gb.Registers)
+	gb.Timer = timer.New(gb.Header, gb.Interrupts)
+	gb.Serial = serial.New(gb.Interrupts)
+	gb.Joypad = joypad.New(gb.Interrupts)
+	gb.PPU = ppu.New(gb.Header, gb.Interrupts)
+	gb.APU = sound.New(gb.Header)
+	gb.MMU = mmu.New(gb.Header, gb.Interrupts, gb.Joypad, gb.PPU, gb.Serial, gb.APU, gb.Timer)
+	gb.CPU = cpu.New(gb.Interrupts, gb.MMU, gb.PPU, gb.Registers, gb.Serial, gb.APU, gb.Timer)
+	gb.MMU.RTC_HOST_CLOCK = opts.RTCHostClock
+	gb.MMU.NO_SAVES = opts.NoSaves
+	if err := gb.MMU.SetBootROM(opts.BootROM); err != nil {
+		return nil, err
+	}
+	model := opts.Model
+	if model == headers.MODEL_AUTO && len(opts.BootROM) == mmu.BOOT_DMG_SIZE {
+		model = headers.MODEL_DMG
+	}
+	if model == headers.MODEL_AUTO && len(opts.BootROM) == mmu.BOOT_CGB_SIZE {
+		model = headers.MODEL_CGB
+	}
+	if opts.BootROM != nil && model.IsColor() != (len(opts.BootROM) == mmu.BOOT_CGB_SIZE) {
+		return nil, fmt.Errorf("boot rom of %d bytes can't run on %s", len(opts.BootROM), model)
+	}
+	gb.Header.SetModel(model)
+
+	if err := gb.Init(rom, opts.Path); err != nil {
+		return nil, err
+	}
+	return gb, nil
+}
+
+// Init resets every component with the given rom
+func (gb *GameBoy) Init(rom []byte, path string) error {
+	if err := gb.Header.Init(rom); err != nil {
+		return err
+	}
+	gb.Timer.Init()
+	if err := gb.MMU.InitMMU(rom, path); err != nil {
+		return err
+	}
+	gb.CPU.InitCPU()
+	gb.Interrupts.Init()
+	gb.Interrupts.StackPush = gb.CPU.StackPush
+	gb.APU.Init()
+	gb.Serial.Init()
+	gb.PPU.ReadFromMemory = gb.MMU.ReadFromMemory
+	gb.PPU.Init()
+	gb.Joypad.Init()
+	gb.Joypad.SaveGame = gb.MMU.SaveMemory
+
+	gb.Timer.Cycle = gb.CPU.Cycle
+	gb.Interrupts.Cycle = gb.CPU.Cycle
+	gb.Interrupts.MMUWriteToMemory = gb.MMU.WriteToMemory
+	gb.Interrupts.GetHalted = gb.CPU.GetHalted
+
+	if gb.MMU.IsBootROMMapped() {
+		gb.MMU.UpdateCGBMode()
+	} else {
+		gb.skipBoot()
+	}
+	return nil
+}
+
+// skipBoot leaves every component as the boot rom would
+func (gb *GameBoy) skipBoot() {
+	gb.Registers.Reset()
+	gb.Interrupts.PostBoot()
+	gb.Timer.PostBoot()
+	gb.Serial.PostBoot(gb.Header.IsCGB())
+	gb.PPU.PostBoot()
+	gb.APU.PostBoot()
+}
+
+// Close releases what the machine started in background,
+// it must not be used afterwards
+func (gb *GameBoy) Close() {
+	gb.MMU.Close()
+}
@@ -0,0 +1,412 @@
+// Package gdbstub lets gdb (or any front end speaking the remote serial
+// protocol) debug the machine over tcp
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+)
+
+// addresses can have the rom bank in the high bits (bank << 16 | addr),
+// 0 is the bank mapped at the moment
+const _BANK_SHIFT = 16
+
+// signals of the stop replies
+const _SIGINT = 2
+const _SIGTRAP = 5
+
+const _INTERRUPT = 0x03
+
+// bytes of a m packet, the reply must fit PacketSize
+const _MAX_READ = 0x1000
+
+// registers in the order of the g packet, 16 bit little endian
+const (
+	_REG_AF = iota
+	_REG_BC
+	_REG_DE
+	_REG_HL
+	_REG_SP
+	_REG_PC
+	_REGISTERS
+)
+
+const _TARGET_XML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+<architecture>gbz80</architecture>
+<feature name="org.gnu.gdb.z80.cpu">
+<reg name="af" bitsize="16" type="int"/>
+<reg name="bc" bitsize="16" type="int"/>
+<reg name="de" bitsize="16" type="int"/>
+<reg name="hl" bitsize="16" type="data_ptr"/>
+<reg name="sp" bitsize="16" type="data_ptr"/>
+<reg name="pc" bitsize="16" type="code_ptr"/>
+</feature>
+</target>`
+
+// Server is connected to a single debugger, the machine waits for
+// its commands while stopped
+type Server struct {
+	gb   *emulator.GameBoy
+	conn net.Conn
+	// packets read in background
+	packets     chan string
+	interrupted int32
+
+	breakpoints map[uint]bool
+	stepping    bool
+	stopped     bool
+}
+
+// Listen waits for the debugger on addr, the machine is stopped
+// before the first instruction
+func Listen(gb *emulator.GameBoy, addr string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+	log.Printf("Waiting for gdb on %s\n", listener.Addr())
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{gb: gb, conn: conn, packets: make(chan string, 16), breakpoints: map[uint]bool{}, stopped: true}
+	go s.read()
+	gb.CPU.BeforeStep = s.beforeStep
+	return s, nil
+}
+
+// Break stops the machine as if the debugger asked for it
+func (s *Server) Break() {
+	atomic.StoreInt32(&s.interrupted, 1)
+}
+
+// Detach removes the hooks and closes the connection
+func (s *Server) Detach() {
+	s.gb.CPU.BeforeStep = nil
+	s.conn.Close()
+}
+
+// the packets are read in background, so ctrl-c arrives while running
+func (s *Server) read() {
+	defer close(s.packets)
+	defer s.Break()
+	r := bufio.NewReader(s.conn)
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		switch c {
+		case _INTERRUPT:
+			s.Break()
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return
+			}
+			var checksum [2]byte
+			if _, err := r.Read(checksum[:1]); err != nil {
+				return
+			}
+			if _, err := r.Read(checksum[1:]); err != nil {
+				return
+			}
+			data = data[:len(data)-1]
+			expected, err := strconv.ParseUint(string(checksum[:]), 16, 8)
+			if err != nil || uint8(expected) != sum(data) {
+				s.conn.Write([]byte{'-'})
+				continue
+			}
+			s.conn.Write([]byte{'+'})
+			s.packets <- data
+		}
+		// '+' and '-' of our packets are ignored, tcp does not lose them
+	}
+}
+
+func sum(data string) uint8 {
+	var checksum uint8
+	for i := 0; i < len(data); i++ {
+		checksum += data[i]
+	}
+	return checksum
+}
+
+func (s *Server) send(data string) {
+	fmt.Fprintf(s.conn, "$%s#%02x", data, sum(data))
+}
+
+func (s *Server) executing() bool {
+	return !s.gb.CPU.GetHalted() && !s.gb.PPU.IsGDMATransferring()
+}
+
+func (s *Server) beforeStep() {
+	if s.stopped {
+		// the debugger asks why with ?
+		s.stopped = false
+		s.serve()
+		return
+	}
+	if atomic.CompareAndSwapInt32(&s.interrupted, 1, 0) {
+		s.stepping = false
+		s.send(fmt.Sprintf("S%02x", _SIGINT))
+		s.serve()
+		return
+	}
+	if !s.executing() {
+		return
+	}
+	pc := s.gb.Registers.PC()
+	if s.stepping || s.breakpoints[pc] || s.breakpoints[s.bank(pc)<<_BANK_SHIFT|pc] {
+		s.stepping = false
+		s.send(fmt.Sprintf("S%02x", _SIGTRAP))
+		s.serve()
+	}
+}
+
+// rom bank mapped at addr, only the switchable area has one
+func (s *Server) bank(addr uint) uint {
+	if addr >= 0x4000 && addr <= 0x7FFF {
+		return s.gb.MMU.GetRomBank()
+	}
+	return 0
+}
+
+// answers the packets until the machine has to resume
+func (s *Server) serve() {
+	for packet := range s.packets {
+		if s.handle(packet) {
+			return
+		}
+	}
+	log.Printf("gdb disconnected\n")
+	s.Detach()
+}
+
+// handle answers a packet, it returns true if the machine has to resume
+func (s *Server) handle(packet string) bool {
+	if packet == "" {
+		s.send("")
+		return false
+	}
+	args := packet[1:]
+	switch packet[0] {
+	case '?':
+		s.send(fmt.Sprintf("S%02x", _SIGTRAP))
+	case 'g':
+		var registers string
+		for i := 0; i < _REGISTERS; i++ {
+			registers += encode16(s.register(i))
+		}
+		s.send(registers)
+	case 'G':
+		for i := 0; i < _REGISTERS && len(args) >= 4; i++ {
+			value, err := decode16(args[:4])
+			if err != nil {
+				s.send("E01")
+				return false
+			}
+			s.setRegister(i, value)
+			args = args[4:]
+		}
+		s.send("OK")
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || n >= _REGISTERS {
+			s.send("E01")
+			return false
+		}
+		s.send(encode16(s.register(int(n))))
+	case 'P':
+		parts := strings.SplitN(args, "=", 2)
+		n, err := strconv.ParseUint(parts[0], 16, 8)
+		if err != nil || n >= _REGISTERS || len(parts) < 2 {
+			s.send("E01")
+			return false
+		}
+		value, err := decode16(parts[1])
+		if err != nil {
+			s.send("E01")
+			return false
+		}
+		s.setRegister(int(n), value)
+		s.send("OK")
+	case 'm':
+		addr, length, err := parseRange(args)
+		if err != nil {
+			s.send("E01")
+			return false
+		}
+		// gdb splits the reads that are too long for a packet
+		if length > _MAX_READ {
+			length = _MAX_READ
+		}
+		data := make([]byte, length)
+		for i := range data {
+			data[i] = s.readMemory(addr + uint(i))
+		}
+		s.send(hex.EncodeToString(data))
+	case 'M':
+		parts := strings.SplitN(args, ":", 2)
+		addr, length, err := parseRange(parts[0])
+		if err != nil || len(parts) < 2 {
+			s.send("E01")
+			return false
+		}
+		data, err := hex.DecodeString(parts[1])
+		if err != nil || uint(len(data)) != length {
+			s.send("E01")
+			return false
+		}
+		for i, value := range data {
+			s.writeMemory(addr+uint(i), value)
+		}
+		s.send("OK")
+	case 'Z', 'z':
+		// software and hardware breakpoints are the same thing here
+		parts := strings.Split(args, ",")
+		if len(parts) < 2 || (parts[0] != "0" && parts[0] != "1") {
+			s.send("")
+			return false
+		}
+		addr, err := strconv.ParseUint(parts[1], 16, 32)
+		if err != nil {
+			s.send("E01")
+			return false
+		}
+		if packet[0] == 'Z' {
+			s.breakpoints[uint(addr)] = true
+		} else {
+			delete(s.breakpoints, uint(addr))
+		}
+		s.send("OK")
+	case 'c', 's':
+		if args != "" {
+			addr, err := strconv.ParseUint(args, 16, 32)
+			if err != nil {
+				s.send("E01")
+				return false
+			}
+			s.gb.Registers.SetPC(uint(addr) & 0xFFFF)
+		}
+		s.stepping = packet[0] == 's'
+		return true
+	case 'D':
+		s.send("OK")
+		s.Detach()
+		return true
+	case 'k':
+		// the front end closes the emulator at the end of the step
+		s.Detach()
+		s.gb.CPU.RequestQuit()
+		return true
+	case 'H', 'T':
+		s.send("OK")
+	case 'q':
+		s.query(args)
+	default:
+		// not supported
+		s.send("")
+	}
+	return false
+}
+
+func (s *Server) query(query string) {
+	switch {
+	case strings.HasPrefix(query, "Supported"):
+		s.send(fmt.Sprintf("PacketSize=%x;qXfer:features:read+", _MAX_READ*2+16))
+	case strings.HasPrefix(query, "Xfer:features:read:target.xml:"):
+		var offset, length int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(query, "Xfer:features:read:target.xml:"), "%x,%x", &offset, &length); err != nil {
+			s.send("E01")
+			return
+		}
+		if offset >= len(_TARGET_XML) {
+			s.send("l")
+			return
+		}
+		end := offset + length
+		if end >= len(_TARGET_XML) {
+			s.send("l" + _TARGET_XML[offset:])
+			return
+		}
+		s.send("m" + _TARGET_XML[offset:end])
+	case query == "Attached":
+		s.send("1")
+	case query == "C":
+		s.send("QC1")
+	case query == "fThreadInfo":
+		s.send("m1")
+	case query == "sThreadInfo":
+		s.send("l")
+	default:
+		s.send("")
+	}
+}
+
+func (s *Server) register(n int) uint {
+	r := s.gb.Registers
+	return [_REGISTERS]func() uint{r.AF, r.BC, r.DE, r.HL, r.SP, r.PC}[n]()
+}
+
+func (s *Server) setRegister(n int, value uint) {
+	r := s.gb.Registers
+	[_REGISTERS]func(uint){r.SetAF, r.SetBC, r.SetDE, r.SetHL, r.SetSP, r.SetPC}[n](value)
+}
+
+// readMemory reads without side effects, a bank in the high bits
+// reads that bank of the rom even if it is not mapped
+func (s *Server) readMemory(addr uint) uint8 {
+	bank := addr >> _BANK_SHIFT
+	addr &= 0xFFFF
+	if bank != 0 && addr >= 0x4000 && addr <= 0x7FFF {
+		return s.gb.MMU.ReadFromRomBank(bank, addr)
+	}
+	return uint8(s.gb.MMU.ReadFromMemory(addr))
+}
+
+// the rom is patched, writing there would switch the banks
+func (s *Server) writeMemory(addr uint, value uint8) {
+	bank := addr >> _BANK_SHIFT
+	addr &= 0xFFFF
+	if addr <= 0x7FFF {
+		if bank == 0 || addr < 0x4000 {
+			bank = s.bank(addr)
+		}
+		s.gb.MMU.WriteToRomBank(bank, addr, value)
+		return
+	}
+	s.gb.MMU.WriteToMemory(addr, uint(value))
+}
+
+// addr,length
+func parseRange(args string) (uint, uint, error) {
+	var addr, length uint
+	if _, err := fmt.Sscanf(args, "%x,%x", &addr, &length); err != nil {
+		return 0, 0, err
+	}
+	return addr, length, nil
+}
+
+func encode16(value uint) string {
+	return fmt.Sprintf("%02x%02x", value&0xFF, value>>8&0xFF)
+}
+
+func decode16(s string) (uint, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil || len(data) != 2 {
+		return 0, fmt.Errorf("invalid register %q", s)
+	}
+	return uint(data[0]) | uint(data[1])<<8, nil
+}
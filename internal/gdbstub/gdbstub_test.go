@@ -0,0 +1,151 @@
+package gdbstub
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+	"github.com/giammirove/gampboy_emulator/internal/testutil"
+)
+
+// the debugger side of the connection
+type client_t struct {
+	t      *testing.T
+	s      *Server
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// a MBC1 cartridge with 4 banks, every bank starts with its number
+func bankedROM() []byte {
+	rom := testutil.ROM([]byte{0x18, 0xFE})
+	rom = append(rom, make([]byte, 0x8000)...)
+	for bank := 0; bank < 4; bank++ {
+		rom[bank*0x4000+0x3FFF] = byte(bank)
+	}
+	rom[0x147] = 0x01
+	rom[0x148] = 0x01
+	testutil.Checksum(rom)
+	return rom
+}
+
+func newClient(t *testing.T) *client_t {
+	gb, err := emulator.New(bankedROM(), emulator.Options{NoSaves: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(gb.Close)
+	conn, server := net.Pipe()
+	t.Cleanup(func() { conn.Close() })
+	s := &Server{gb: gb, conn: server, packets: make(chan string, 16), breakpoints: map[uint]bool{}}
+	go s.read()
+	return &client_t{t: t, s: s, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *client_t) write(data string) {
+	if _, err := io.WriteString(c.conn, data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client_t) ack() byte {
+	b, err := c.reader.ReadByte()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return b
+}
+
+// sends a packet and returns the reply of the server
+func (c *client_t) request(packet string) string {
+	c.write(fmt.Sprintf("$%s#%02x", packet, sum(packet)))
+	if b := c.ack(); b != '+' {
+		c.t.Fatalf("%s: acknowledged with %q", packet, b)
+	}
+	go c.s.handle(<-c.s.packets)
+	if b := c.ack(); b != '$' {
+		c.t.Fatalf("%s: reply starts with %q", packet, b)
+	}
+	reply, err := c.reader.ReadString('#')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	reply = reply[:len(reply)-1]
+	checksum := []byte{c.ack(), c.ack()}
+	if string(checksum) != fmt.Sprintf("%02x", sum(reply)) {
+		c.t.Fatalf("%s: reply %q with checksum %s", packet, reply, checksum)
+	}
+	return reply
+}
+
+func TestFraming(t *testing.T) {
+	c := newClient(t)
+	// a wrong checksum is refused, the packet is dropped
+	c.write("$m0,1#00")
+	if b := c.ack(); b != '-' {
+		t.Fatalf("bad checksum acknowledged with %q", b)
+	}
+	if len(c.s.packets) != 0 {
+		t.Fatalf("bad packet queued")
+	}
+	// the acks of the debugger are ignored
+	c.write("+")
+	if reply := c.request("?"); reply != "S05" {
+		t.Fatalf("? answered %q", reply)
+	}
+	if reply := c.request("vMustReplyEmpty"); reply != "" {
+		t.Fatalf("unknown packet answered %q", reply)
+	}
+	// ctrl-c stops the machine while running
+	c.write(string([]byte{_INTERRUPT}))
+	c.write("+")
+	if atomic.LoadInt32(&c.s.interrupted) != 1 {
+		t.Fatalf("ctrl-c did not interrupt")
+	}
+}
+
+func TestPackets(t *testing.T) {
+	c := newClient(t)
+	tests := []struct {
+		packet string
+		reply  string
+	}{
+		// JR -2 at the entry point of the program
+		{"m150,2", "18fe"},
+		{"m3fff,1", "00"},
+		{"m7fff,1", "01"},
+		// banks that are not mapped
+		{"m27fff,1", "02"},
+		{"m37fff,1", "03"},
+		{"mzz", "E01"},
+		{"MC000,2:abcd", "OK"},
+		{"mc000,3", "abcd00"},
+		{"MC000,2:ab", "E01"},
+		{"MC000,1:zz", "E01"},
+		// the rom is patched, the bank stays the same
+		{"M150,1:00", "OK"},
+		{"m150,2", "00fe"},
+		{"M37fff,1:33", "OK"},
+		{"m37fff,1", "33"},
+		{"m7fff,1", "01"},
+		{"Z0,150,1", "OK"},
+		{"Z1,24000,1", "OK"},
+		{"Z2,c000,1", ""},
+		{"Z0,zz,1", "E01"},
+	}
+	for _, test := range tests {
+		if reply := c.request(test.packet); reply != test.reply {
+			t.Errorf("%s answered %q, expected %q", test.packet, reply, test.reply)
+		}
+	}
+	if !c.s.breakpoints[0x150] || !c.s.breakpoints[0x24000] || len(c.s.breakpoints) != 2 {
+		t.Fatalf("breakpoints %v", c.s.breakpoints)
+	}
+	if reply := c.request("z0,150,1"); reply != "OK" || c.s.breakpoints[0x150] {
+		t.Fatalf("z answered %q, breakpoints %v", reply, c.s.breakpoints)
+	}
+}
@@ -0,0 +1,65 @@
+package gui
+
+import (
+	"encoding/binary"
+	"log"
+
+	"github.com/giammirove/gampboy_emulator/gampboy"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// more than ~100ms of queued audio is just latency
+const _MAX_QUEUED_AUDIO = gampboy.SampleRate * gampboy.Channels * 2 / 10
+
+var AUDIO bool = true
+
+var audio_device sdl.AudioDeviceID
+var audio_bytes []byte
+
+func initAudio() {
+	if !AUDIO {
+		return
+	}
+	spec := sdl.AudioSpec{
+		Freq:     gampboy.SampleRate,
+		Format:   sdl.AUDIO_S16LSB,
+		Channels: gampboy.Channels,
+		Samples:  1024,
+	}
+	var err error
+	audio_device, err = sdl.OpenAudioDevice("", false, &spec, nil, 0)
+	if err != nil {
+		log.Printf("Audio disabled (%s)\n", err)
+		AUDIO = false
+		return
+	}
+	sdl.PauseAudioDevice(audio_device, false)
+}
+
+func closeAudio() {
+	if AUDIO {
+		sdl.CloseAudioDevice(audio_device)
+	}
+}
+
+// moves the samples produced by the APU to the SDL queue
+func updateAudio() {
+	if !AUDIO {
+		return
+	}
+	samples := gb.AudioSamples()
+	// the emulation is faster than real time, drop the samples
+	if len(samples) == 0 || sdl.GetQueuedAudioSize(audio_device) > _MAX_QUEUED_AUDIO {
+		return
+	}
+	if cap(audio_bytes) < len(samples)*2 {
+		audio_bytes = make([]byte, len(samples)*2)
+	}
+	audio_bytes = audio_bytes[:len(samples)*2]
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(audio_bytes[i*2:], uint16(sample))
+	}
+	if err := sdl.QueueAudio(audio_device, audio_bytes); err != nil {
+		log.Printf("Audio error (%s)\n", err)
+	}
+}
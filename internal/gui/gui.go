@@ -4,10 +4,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
-	"github.com/giammirove/gampboy_emulator/internal/headers"
-	"github.com/giammirove/gampboy_emulator/internal/joypad"
-	"github.com/giammirove/gampboy_emulator/internal/ppu"
+	"github.com/giammirove/gampboy_emulator/gampboy"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
@@ -18,8 +17,7 @@ const DEBUG_H = 216
 const WIDTH = uint(160)
 const HEIGHT = uint(144)
 
-var video_buffer [WIDTH][HEIGHT]uint32
-var prev_frame = 0
+var video_buffer []uint32
 
 // var context *cairo.Context
 // var is_context bool
@@ -35,11 +33,71 @@ var SERVER_MODE bool = false
 
 var SCALE = uint(3)
 
+// machine shown in the window
+var gb *gampboy.GameBoy
+var buttons gampboy.Button
+var paused bool
+
+// set when the cartbridge turned the rumble motor on since the last title update
+var rumbled bool
+
+// F1-F9 loads the slot, Shift+F1-F9 saves it
+var SaveSlot func(slot int) error
+var LoadSlot func(slot int) error
+
+// T key
+var ToggleDebugMode func()
+
+// M key, stops in the debugger console
+var Break func()
+
+// Backspace held, restores the previous snapshot (false when there is
+// nothing older)
+var Rewind func() (bool, error)
+
+// called after every frame, records the snapshots for the rewind
+var RecordFrame func() error
+var rewinding bool
+
+// called before every frame with the buttons held, it returns the ones
+// given to the machine (movies)
+var FrameInput func(buttons gampboy.Button) gampboy.Button
+
+// called after every frame (movies)
+var FrameDrawn func() error
+
+// speed of the O key, 0.5 = half speed
+var SLOW_MOTION = 0.5
+
+// Tab held, U and O toggled
+var fast_forward bool
+var uncapped bool
+var slow_motion bool
+
+var keymap = map[sdl.Scancode]gampboy.Button{
+	sdl.SCANCODE_RETURN: gampboy.ButtonStart,
+	sdl.SCANCODE_L:      gampboy.ButtonStart,
+	sdl.SCANCODE_SPACE:  gampboy.ButtonSelect,
+	sdl.SCANCODE_H:      gampboy.ButtonSelect,
+	sdl.SCANCODE_Z:      gampboy.ButtonA,
+	sdl.SCANCODE_J:      gampboy.ButtonA,
+	sdl.SCANCODE_X:      gampboy.ButtonB,
+	sdl.SCANCODE_K:      gampboy.ButtonB,
+	sdl.SCANCODE_DOWN:   gampboy.ButtonDown,
+	sdl.SCANCODE_S:      gampboy.ButtonDown,
+	sdl.SCANCODE_UP:     gampboy.ButtonUp,
+	sdl.SCANCODE_W:      gampboy.ButtonUp,
+	sdl.SCANCODE_RIGHT:  gampboy.ButtonRight,
+	sdl.SCANCODE_D:      gampboy.ButtonRight,
+	sdl.SCANCODE_LEFT:   gampboy.ButtonLeft,
+	sdl.SCANCODE_A:      gampboy.ButtonLeft,
+}
+
 func responseMap(w http.ResponseWriter, r *http.Request) {
 	(w).Header().Set("Access-Control-Allow-Origin", "*")
 	for x := 0; x < int(WIDTH); x++ {
 		for y := 0; y < int(HEIGHT); y++ {
-			fmt.Fprintf(w, "%08X", video_buffer[x][y])
+			fmt.Fprintf(w, "%08X", video_buffer[y*int(WIDTH)+x])
 			if y < int(HEIGHT)-1 {
 				fmt.Fprintf(w, " ")
 			}
@@ -47,7 +105,8 @@ func responseMap(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "\n")
 	}
 }
-func Init() {
+func Init(machine *gampboy.GameBoy) {
+	gb = machine
 	if SERVER_MODE {
 		go func() {
 			http.HandleFunc("/map", responseMap)
@@ -94,26 +153,55 @@ func Run() {
 	sdl_window2.UpdateSurface()
 	sdl_window.UpdateSurface()
 
+	initAudio()
+	defer closeAudio()
+	updateSpeed()
+
 	var fps = 0
 	running := true
 	var prev_time uint32
-	for running {
-		if prev_frame != ppu.GetCurrentFrame() {
-			prev_frame = ppu.GetCurrentFrame()
+	// the debuggers ask to quit from inside the frame
+	for running && !gb.Machine().CPU.QuitRequested() {
+		if rewinding && Rewind != nil {
+			rewindFrame()
+			fps++
+		} else if !paused {
+			runFrame()
+			if RecordFrame != nil {
+				if err := RecordFrame(); err != nil {
+					log.Printf("Error recording rewind (%s)\n", err)
+					RecordFrame = nil
+				}
+			}
 			if DEBUG_WINDOW {
 				UpdateGUI()
 			}
 			UpdateGUI3()
 			fps++
-			now := TicksGUI()
-			if now-prev_time >= 1000 {
-				// log.Printf("FPS %d\n", fps)
-				str := fmt.Sprintf("{%d} [%s]", fps, headers.GetTitle())
-				sdl_window.SetTitle(str)
-				prev_time = now
-				fps = 0
+		} else {
+			// nothing to run, just wait for the events
+			time.Sleep(gampboy.FrameDuration)
+		}
+		now := TicksGUI()
+		if now-prev_time >= 1000 {
+			// log.Printf("FPS %d\n", fps)
+			str := fmt.Sprintf("{%d} [%s]", fps, gb.Title())
+			if rewinding {
+				str += " <<"
+			} else if fast_forward || uncapped {
+				str += " >>"
+			} else if slow_motion {
+				str += fmt.Sprintf(" x%g", SLOW_MOTION)
 			}
+			if rumbled {
+				str += " ~RUMBLE~"
+				rumbled = false
+			}
+			sdl_window.SetTitle(str)
+			prev_time = now
+			fps = 0
 		}
+		updateAudio()
 		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
 			switch event.(type) {
 			case *sdl.QuitEvent:
@@ -122,79 +210,48 @@ func Run() {
 				break
 			case *sdl.KeyboardEvent:
 				ev := event.(*sdl.KeyboardEvent)
-				switch ev.Keysym.Scancode {
-				case sdl.SCANCODE_RETURN, sdl.SCANCODE_L:
+				if button, ok := keymap[ev.Keysym.Scancode]; ok {
 					if ev.Type == sdl.KEYDOWN {
-						joypad.SetJoypadStart()
+						buttons |= button
 					} else {
-						joypad.ClearJoypadStart()
+						buttons &^= button
 					}
 					break
-				case sdl.SCANCODE_SPACE, sdl.SCANCODE_H:
-					if ev.Type == sdl.KEYDOWN {
-						joypad.SetJoypadSelect()
-					} else {
-						joypad.ClearJoypadSelect()
-					}
-					break
-				case sdl.SCANCODE_Z, sdl.SCANCODE_J:
-					if ev.Type == sdl.KEYDOWN {
-						joypad.SetJoypadA()
-					} else {
-						joypad.ClearJoypadA()
-					}
-					break
-				case sdl.SCANCODE_X, sdl.SCANCODE_K:
-					if ev.Type == sdl.KEYDOWN {
-						joypad.SetJoypadB()
-					} else {
-						joypad.ClearJoypadB()
-					}
-					break
-				case sdl.SCANCODE_DOWN, sdl.SCANCODE_S:
-					if ev.Type == sdl.KEYDOWN {
-						joypad.SetJoypadDown()
-					} else {
-						joypad.ClearJoypadDown()
-					}
-					break
-				case sdl.SCANCODE_UP, sdl.SCANCODE_W:
-					if ev.Type == sdl.KEYDOWN {
-						joypad.SetJoypadUp()
-					} else {
-						joypad.ClearJoypadUp()
-					}
+				}
+				if ev.Keysym.Scancode == sdl.SCANCODE_BACKSPACE {
+					rewinding = ev.Type == sdl.KEYDOWN
 					break
-				case sdl.SCANCODE_RIGHT, sdl.SCANCODE_D:
-					if ev.Type == sdl.KEYDOWN {
-						joypad.SetJoypadRight()
-					} else {
-						joypad.ClearJoypadRight()
-					}
+				}
+				if ev.Keysym.Scancode == sdl.SCANCODE_TAB {
+					fast_forward = ev.Type == sdl.KEYDOWN
+					updateSpeed()
 					break
-				case sdl.SCANCODE_LEFT, sdl.SCANCODE_A:
-					if ev.Type == sdl.KEYDOWN {
-						joypad.SetJoypadLeft()
-					} else {
-						joypad.ClearJoypadLeft()
-					}
+				}
+				if ev.Type != sdl.KEYDOWN {
 					break
+				}
+				switch ev.Keysym.Scancode {
 				case sdl.SCANCODE_T:
-					if ev.Type == sdl.KEYDOWN {
-						joypad.ToggleDebugMode()
+					if ToggleDebugMode != nil {
+						ToggleDebugMode()
 					}
 				case sdl.SCANCODE_P:
-					if ev.Type == sdl.KEYDOWN {
-						joypad.TogglePauseMode()
-					}
+					paused = !paused
+				case sdl.SCANCODE_U:
+					uncapped = !uncapped
+					updateSpeed()
+				case sdl.SCANCODE_O:
+					slow_motion = !slow_motion
+					updateSpeed()
 				case sdl.SCANCODE_M:
-					if ev.Type == sdl.KEYDOWN {
-						joypad.ToggleManualMode()
+					if Break != nil {
+						Break()
+					}
+				default:
+					if ev.Keysym.Scancode >= sdl.SCANCODE_F1 && ev.Keysym.Scancode <= sdl.SCANCODE_F9 {
+						slot := int(ev.Keysym.Scancode-sdl.SCANCODE_F1) + 1
+						handleSlot(slot, ev.Keysym.Mod&uint16(sdl.KMOD_SHIFT) != 0)
 					}
-					// case sdl.SCANCODE_S:
-					// 	if ev.Type == sdl.KEYDOWN {
-					// 		joypad.SaveGame()
-					// 	}
 				}
 				break
 			}
@@ -221,11 +278,21 @@ func RefreshGUI2() {
 var _x uint
 var _y uint
 
+// shades of the dmg, the tiles are shown with the background palette
+var _SHADES = [4]uint32{0xFFFFFFFF, 0xFFAAAAAA, 0xFF555555, 0xFF000000}
+
+const _BGP = 0xFF47
+
 func ShowTile(base uint, base_x uint, base_y uint) {
-	tile := ppu.GetTileData(base)
-	for x := uint(0); x < uint(len(tile)); x++ {
-		for y := uint(0); y < uint(len(tile[x])); y++ {
-			ColorPixel2(base_x+x*SCALE, base_y+y*SCALE, ppu.GetBGColor(tile[x][y]))
+	palette := uint(gb.ReadMemory(_BGP))
+	// 2 bytes per row, the first one has the low bits of the color
+	for y := uint(0); y < 8; y++ {
+		low := uint(gb.ReadMemory(uint16(base + y*2)))
+		high := uint(gb.ReadMemory(uint16(base + y*2 + 1)))
+		for x := uint(0); x < 8; x++ {
+			bit := 7 - x
+			color := (low>>bit)&1 | ((high>>bit)&1)<<1
+			ColorPixel2(base_x+x*SCALE, base_y+y*SCALE, _SHADES[(palette>>(color*2))&0x3])
 		}
 	}
 }
@@ -256,7 +323,7 @@ func UpdateGUI2() {
 	for _y := uint(0); _y < 32; _y++ {
 		// ShowTile(addr+(y*16), x_d, y_d)
 		for _x = uint(0); _x < 32; _x++ {
-			tile_n = uint(ppu.ReadFromVRAMMemory(0x9800+tile_index, 0))
+			tile_n = uint(gb.ReadMemory(uint16(0x9800 + tile_index)))
 			ShowTile(addr+tile_n*16, x_d+_x*SCALE, y_d+_y*SCALE)
 			x_d += 8 * SCALE
 			tile_index++
@@ -268,18 +335,83 @@ func UpdateGUI2() {
 }
 
 func UpdateGUI3() {
-	video_buffer = ppu.FetcherGetBuffer()
-	for x := uint(0); x < 160; x++ {
-		for y := uint(0); y < 144; y++ {
-			ColorPixel(x, y, video_buffer[x][y])
+	video_buffer = gb.Framebuffer()
+	for x := uint(0); x < WIDTH; x++ {
+		for y := uint(0); y < HEIGHT; y++ {
+			ColorPixel(x, y, video_buffer[y*WIDTH+x])
 		}
 	}
 	RefreshGUI()
 }
 
-func DelayGUI(delay uint32) {
-	sdl.Delay(delay)
+func handleSlot(slot int, save bool) {
+	if save {
+		if SaveSlot == nil {
+			return
+		}
+		if err := SaveSlot(slot); err != nil {
+			log.Printf("Error saving state %d (%s)\n", slot, err)
+			return
+		}
+		log.Printf("State %d saved\n", slot)
+		return
+	}
+	if LoadSlot == nil {
+		return
+	}
+	if err := LoadSlot(slot); err != nil {
+		log.Printf("Error loading state %d (%s)\n", slot, err)
+		return
+	}
+	log.Printf("State %d loaded\n", slot)
+}
+
+func SetRumble(active bool) {
+	if active {
+		rumbled = true
+	}
 }
+
+// the buttons are given to the machine once per frame, so a movie
+// can replay them at the same time
+func runFrame() {
+	input := buttons
+	if FrameInput != nil {
+		input = FrameInput(buttons)
+	}
+	gb.SetButtons(input)
+	gb.RunFrame()
+	if FrameDrawn != nil {
+		if err := FrameDrawn(); err != nil {
+			log.Printf("Error with movie (%s)\n", err)
+			FrameDrawn = nil
+		}
+	}
+}
+
+// one step back, at the speed of the frames
+func rewindFrame() {
+	if _, err := Rewind(); err != nil {
+		log.Printf("Error rewinding (%s)\n", err)
+		rewinding = false
+		return
+	}
+	UpdateGUI3()
+	time.Sleep(gampboy.FrameDuration)
+}
+
+// real time unless fast forward, uncapped or slow motion
+func updateSpeed() {
+	speed := 1.0
+	if slow_motion {
+		speed = SLOW_MOTION
+	}
+	if fast_forward || uncapped {
+		speed = 0
+	}
+	gb.SetSpeed(speed)
+}
+
 func TicksGUI() uint32 {
 	return sdl.GetTicks()
 }
@@ -2,7 +2,6 @@ package headers
 
 import (
 	"fmt"
-	"log"
 
 	"github.com/giammirove/gampboy_emulator/internal/utility"
 )
@@ -170,8 +169,8 @@ var rom_size_map map[uint8]rom_t = map[uint8]rom_t{
 	0x54: {size: 1536, banks: 96, bits: 0},
 }
 var ram_size_map map[uint8]uint = map[uint8]uint{
-	0x0: 8,
-	0x1: 8,
+	0x0: 0,
+	0x1: 2,
 	0x2: 8,
 	0x3: 32,
 	0x4: 128,
@@ -209,82 +208,192 @@ func create_headers_struct() headers_meta_t {
 }
 
 var headers_meta = create_headers_struct()
-var headers headers_t
+
+// Header is the cartridge header of the rom and the model running it
+type Header struct {
+	headers headers_t
+	// as requested, auto is resolved by Init
+	requested Model
+	model     Model
+	// cgb mode, only the cgb boot rom changes it while running
+	cgb_mode bool
+	// a dmg rom with the palettes chosen by the cgb boot rom
+	colorized bool
+}
+
+// New creates the headers, Init resets it
+func New() *Header {
+	return &Header{}
+}
 
 func getHeaderFromRaw(raw []byte, h header_meta_t) []byte {
 	return raw[h.start : h.end+1]
 }
 
-func Init(raw []byte) {
+// Init reads the header of the rom, it fails if the rom is too short
+// or the header checksum is wrong
+func (h *Header) Init(raw []byte) error {
+	if len(raw) <= _HEADER_END {
+		return fmt.Errorf("rom of %d bytes is shorter than its header", len(raw))
+	}
 
-	headers = headers_t{}
-	headers.title = string(getHeaderFromRaw(raw, headers_meta.title))
-	headers.cgb_flag = getHeaderFromRaw(raw, headers_meta.cgb_flag)[0]
+	h.headers = headers_t{}
+	h.headers.title = string(getHeaderFromRaw(raw, headers_meta.title))
+	h.headers.cgb_flag = getHeaderFromRaw(raw, headers_meta.cgb_flag)[0]
 
 	licensee_code := getHeaderFromRaw(raw, headers_meta.new_licensee_code)
-	headers.new_licensee_code = uint16(licensee_code[1])
+	h.headers.new_licensee_code = uint16(licensee_code[1])
 
-	headers.sgb_flag = getHeaderFromRaw(raw, headers_meta.sgb_flag)[0]
-	headers.cartridge_type = getHeaderFromRaw(raw, headers_meta.cartridge_type)[0]
-	headers.rom_size = getHeaderFromRaw(raw, headers_meta.rom_size)[0]
-	headers.ram_size = getHeaderFromRaw(raw, headers_meta.ram_size)[0]
-	headers.destination_code = getHeaderFromRaw(raw, headers_meta.destination_code)[0]
+	h.headers.sgb_flag = getHeaderFromRaw(raw, headers_meta.sgb_flag)[0]
+	h.headers.cartridge_type = getHeaderFromRaw(raw, headers_meta.cartridge_type)[0]
+	h.headers.rom_size = getHeaderFromRaw(raw, headers_meta.rom_size)[0]
+	h.headers.ram_size = getHeaderFromRaw(raw, headers_meta.ram_size)[0]
+	h.headers.destination_code = getHeaderFromRaw(raw, headers_meta.destination_code)[0]
 
-	headers.header_checksum = getHeaderFromRaw(raw, headers_meta.header_checksum)[0]
+	h.headers.header_checksum = getHeaderFromRaw(raw, headers_meta.header_checksum)[0]
+	global_checksum := getHeaderFromRaw(raw, headers_meta.global_checksum)
+	h.headers.global_checksum = uint16(global_checksum[0])<<8 | uint16(global_checksum[1])
 
 	// check checksum
 	check := uint8(0)
 	for a := 0x134; a <= 0x14C; a++ {
 		check = check - raw[a] - 1
 	}
-	if check != headers.header_checksum {
-		log.Fatal("Checksum failed!")
+	if check != h.headers.header_checksum {
+		return fmt.Errorf("header checksum is %02X, expected %02X", h.headers.header_checksum, check)
 	}
 
-	fmt.Printf("%-18s: %s\n", "TITLE", headers.title)
-	if headers.cgb_flag == 0xC0 {
-		fmt.Printf("%-18s: CGB (%02X)\n", "GB TYPE", headers.cgb_flag)
-	} else if headers.cgb_flag == 0x80 {
-		fmt.Printf("%-18s: CGB but backwards compatible with NON-CGB (%02X)\n", "GB TYPE", headers.cgb_flag)
-	} else {
-		fmt.Printf("%-18s: NON-CGB (%02X)\n", "GB TYPE", headers.cgb_flag)
+	h.model = h.requested
+	if h.model == MODEL_AUTO {
+		h.model = MODEL_DMG
+		if h.headers.cgb_flag == 0xC0 || h.headers.cgb_flag == 0x80 {
+			h.model = MODEL_CGB
+		}
+	}
+	h.cgb_mode = h.model.IsColor() && h.IsCGBCartridge()
+	h.colorized = false
+	return nil
+}
+
+func (h *Header) GetTitle() string {
+	return h.headers.title
+}
+
+func (h *Header) GetCGBFlag() uint8 {
+	return h.headers.cgb_flag
+}
+
+func (h *Header) GetSGBFlag() uint8 {
+	return h.headers.sgb_flag
+}
+
+func (h *Header) GetLicenseeCode() uint16 {
+	return h.headers.new_licensee_code
+}
+func (h *Header) GetLicenseeName() string {
+	return licensee_code_map[h.headers.new_licensee_code]
+}
+
+func (h *Header) GetDestinationCode() uint8 {
+	return h.headers.destination_code
+}
+func (h *Header) GetDestinationName() string {
+	return destination_code_map[h.headers.destination_code]
+}
+
+func (h *Header) GetGlobalChecksum() uint16 {
+	return h.headers.global_checksum
+}
+
+func (h *Header) GetCartridgeType() uint8 {
+	return h.headers.cartridge_type
+}
+func (h *Header) GetCartridgeName() string {
+	name, ok := cartbridge_type_map[h.headers.cartridge_type]
+	if !ok {
+		return "UNKNOWN"
 	}
-	fmt.Printf("%-18s: %s (%02X)\n", "NEW LICENSEE CODE", licensee_code_map[headers.new_licensee_code], headers.new_licensee_code)
-	fmt.Printf("%-18s: %02X\n", "SGB Flag", headers.sgb_flag)
-	fmt.Printf("%-18s: %s (%02X)\n", "CARTBRIDGE TYPE", cartbridge_type_map[headers.cartridge_type], headers.cartridge_type)
-	fmt.Printf("%-18s: %d KiB (n. banking %d) (%d)\n", "ROM SIZE", rom_size_map[headers.rom_size].size, rom_size_map[headers.rom_size].banks, headers.rom_size)
-	fmt.Printf("%-18s: %d KiB (%d)\n", "RAM SIZE", ram_size_map[headers.ram_size], headers.ram_size)
-	fmt.Printf("%-18s: %s (%d)\n", "DESTINATION CODE", destination_code_map[headers.destination_code], headers.destination_code)
-	fmt.Printf("---------------------------------------------------------\n")
+	return name
+}
+
+func (h *Header) IsMBC1() bool {
+	return h.headers.cartridge_type == 0x1 || h.headers.cartridge_type == 0x2 || h.headers.cartridge_type == 0x3
+}
+func (h *Header) IsMBC2() bool {
+	return h.headers.cartridge_type == 0x05 || h.headers.cartridge_type == 0x06
+}
+func (h *Header) IsMBC3() bool {
+	return h.headers.cartridge_type == 0x0F || h.headers.cartridge_type == 0x10 || h.headers.cartridge_type == 0x11 || h.headers.cartridge_type == 0x12 || h.headers.cartridge_type == 0x13
+}
+func (h *Header) IsMBC5() bool {
+	return h.headers.cartridge_type >= 0x19 && h.headers.cartridge_type <= 0x1E
+}
+func (h *Header) HasRumble() bool {
+	return h.headers.cartridge_type >= 0x1C && h.headers.cartridge_type <= 0x1E
+}
+func (h *Header) HasBattery() bool {
+	return utility.Contains(cartbridge_with_battery, uint(h.headers.cartridge_type))
 }
 
-func GetTitle() string {
-	return headers.title
+func (h *Header) GetRomSizeCode() uint8 {
+	return h.headers.rom_size
+}
+func (h *Header) GetRomBankNumber() uint {
+	return rom_size_map[h.headers.rom_size].banks
+}
+func (h *Header) GetRomBankBits() uint {
+	return rom_size_map[h.headers.rom_size].bits
+}
+func (h *Header) GetRomSize() uint {
+	return rom_size_map[h.headers.rom_size].size * 1024
+}
+func (h *Header) GetRamSizeCode() uint8 {
+	return h.headers.ram_size
+}
+func (h *Header) GetRamBankNumber() uint {
+	return ram_size_map[h.headers.ram_size] / 8
+}
+func (h *Header) GetRamSize() uint {
+	return ram_size_map[h.headers.ram_size] * 1024
 }
 
-func IsMBC1() bool {
-	return headers.cartridge_type == 0x1 || headers.cartridge_type == 0x2 || headers.cartridge_type == 0x3
+func (h *Header) GetHeaderChecksum() uint8 {
+	return h.headers.header_checksum
 }
-func IsMBC3() bool {
-	return headers.cartridge_type == 0x0F || headers.cartridge_type == 0x10 || headers.cartridge_type == 0x11 || headers.cartridge_type == 0x12 || headers.cartridge_type == 0x13
+
+// SetModel chooses the console, it takes effect at the next Init
+func (h *Header) SetModel(model Model) {
+	h.requested = model
 }
-func HasBattery() bool {
-	return utility.Contains(cartbridge_with_battery, uint(headers.cartridge_type))
+func (h *Header) GetModel() Model {
+	return h.model
 }
 
-func GetRomBankNumber() uint {
-	return rom_size_map[headers.rom_size].banks
+// IsCGB tells if the rom runs in cgb mode: a cgb rom on a cgb console,
+// or any rom while the cgb boot rom runs
+func (h *Header) IsCGB() bool {
+	return h.cgb_mode
 }
-func GetRomBankBits() uint {
-	return rom_size_map[headers.rom_size].bits
+
+// IsCGBCartridge tells if the cgb flag of the rom is set
+func (h *Header) IsCGBCartridge() bool {
+	return h.headers.cgb_flag == 0xC0 || h.headers.cgb_flag == 0x80
 }
-func GetRamBankNumber() uint {
-	return ram_size_map[headers.ram_size] / 8
+
+// SetCGBMode is used by the cgb boot rom, it starts in cgb mode and then
+// switches to the mode of the cartridge. A dmg rom keeps the palettes
+// written by the boot rom if colorized is set
+func (h *Header) SetCGBMode(cgb bool, colorized bool) {
+	h.cgb_mode = h.model.IsColor() && cgb
+	h.colorized = h.model.IsColor() && !cgb && colorized
 }
 
-func IsCGB() bool {
-	return headers.cgb_flag == 0xC0 || headers.cgb_flag == 0x80
+// IsColorized tells if a dmg rom is shown with the cgb palettes
+func (h *Header) IsColorized() bool {
+	return h.colorized
 }
-func IsGB() bool {
-	return headers.cgb_flag == 0x00 //|| headers.cgb_flag != 0xC0
+
+// IsGB tells if the rom runs in dmg mode, even on a cgb console
+func (h *Header) IsGB() bool {
+	return !h.IsCGB()
 }
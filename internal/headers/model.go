@@ -0,0 +1,54 @@
+package headers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Model is the console being emulated
+type Model uint8
+
+const (
+	// chosen from the cgb flag of the cartridge
+	MODEL_AUTO Model = iota
+	MODEL_DMG0
+	MODEL_DMG
+	MODEL_MGB
+	MODEL_SGB
+	MODEL_CGB
+	MODEL_AGB
+)
+
+var model_names = map[Model]string{
+	MODEL_AUTO: "auto",
+	MODEL_DMG0: "dmg0",
+	MODEL_DMG:  "dmg",
+	MODEL_MGB:  "mgb",
+	MODEL_SGB:  "sgb",
+	MODEL_CGB:  "cgb",
+	MODEL_AGB:  "agb",
+}
+
+// ParseModel reads the name of a model (dmg0, dmg, mgb, sgb, cgb, agb, auto)
+func ParseModel(name string) (Model, error) {
+	name = strings.ToLower(name)
+	if name == "" {
+		return MODEL_AUTO, nil
+	}
+	for model, model_name := range model_names {
+		if model_name == name {
+			return model, nil
+		}
+	}
+	return MODEL_AUTO, fmt.Errorf("unknown model %q (dmg0, dmg, mgb, sgb, cgb, agb)", name)
+}
+
+func (m Model) String() string {
+	return strings.ToUpper(model_names[m])
+}
+
+// IsColor tells if the console has the cgb hardware (vram and wram
+// banks, palettes, double speed), used only by CGB roms
+func (m Model) IsColor() bool {
+	return m == MODEL_CGB || m == MODEL_AGB
+}
@@ -0,0 +1,100 @@
+package headless
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+	"github.com/giammirove/gampboy_emulator/internal/ppu"
+)
+
+var _DIFF_COLOR = color.RGBA{R: 0xFF, A: 0xFF}
+
+// RunUntilBreak is like Run but it also stops at the first LD B,B,
+// the way acid2 tells that the frame is complete.
+// It returns true if the breakpoint has been reached
+func RunUntilBreak(gb *emulator.GameBoy, frames int) bool {
+	reached := false
+	previous := gb.CPU.DebugBreak
+	gb.CPU.DebugBreak = func() {
+		reached = true
+	}
+	defer func() {
+		gb.CPU.DebugBreak = previous
+	}()
+
+	target := gb.PPU.GetCurrentFrame() + frames
+	max_cycles := gb.CPU.GetCycles() + uint64(frames)*CYCLES_PER_FRAME*2
+	for !reached && gb.PPU.GetCurrentFrame() < target && gb.CPU.GetCycles() < max_cycles && !gb.CPU.QuitRequested() {
+		gb.CPU.Step()
+	}
+	return reached
+}
+
+// the same pixel can be drawn with different rgb values
+// (dmg palette, cgb color correction), compare what the game wrote instead
+func normalize(cgb bool, c color.Color) uint32 {
+	r, g, b, _ := c.RGBA()
+	rgb := (r>>8)<<16 | (g>>8)<<8 | b>>8
+	if cgb {
+		return ppu.RawColor(rgb)
+	}
+	return uint32(ppu.Shade(rgb))
+}
+
+// Compare checks the last frame against reference pixel by pixel.
+// It returns the number of different pixels and an image where they are red
+func Compare(gb *emulator.GameBoy, reference image.Image) (int, *image.RGBA, error) {
+	bounds := reference.Bounds()
+	if bounds.Dx() != WIDTH || bounds.Dy() != HEIGHT {
+		return 0, nil, fmt.Errorf("reference is %dx%d instead of %dx%d", bounds.Dx(), bounds.Dy(), WIDTH, HEIGHT)
+	}
+	actual := Screenshot(gb)
+	cgb := gb.Header.IsCGB()
+	diff := image.NewRGBA(image.Rect(0, 0, WIDTH, HEIGHT))
+	mismatches := 0
+	for x := 0; x < WIDTH; x++ {
+		for y := 0; y < HEIGHT; y++ {
+			got := actual.RGBAAt(x, y)
+			if normalize(cgb, got) != normalize(cgb, reference.At(bounds.Min.X+x, bounds.Min.Y+y)) {
+				diff.SetRGBA(x, y, _DIFF_COLOR)
+				mismatches++
+				continue
+			}
+			// matching pixels are faded so the red ones stand out
+			gray := uint8((uint(got.R) + uint(got.G) + uint(got.B)) / 3 / 4)
+			diff.SetRGBA(x, y, color.RGBA{R: 0xC0 + gray, G: 0xC0 + gray, B: 0xC0 + gray, A: 0xFF})
+		}
+	}
+	return mismatches, diff, nil
+}
+
+// CompareFiles compares the last frame with the png at reference_path,
+// on mismatch the diff image is written to diff_path
+func CompareFiles(gb *emulator.GameBoy, reference_path string, diff_path string) (int, error) {
+	file, err := os.Open(reference_path)
+	if err != nil {
+		return 0, err
+	}
+	reference, err := png.Decode(file)
+	file.Close()
+	if err != nil {
+		return 0, err
+	}
+	mismatches, diff, err := Compare(gb, reference)
+	if err != nil || mismatches == 0 || diff_path == "" {
+		return mismatches, err
+	}
+	out, err := os.Create(diff_path)
+	if err != nil {
+		return mismatches, err
+	}
+	if err := png.Encode(out, diff); err != nil {
+		out.Close()
+		return mismatches, err
+	}
+	return mismatches, out.Close()
+}
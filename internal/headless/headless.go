@@ -0,0 +1,53 @@
+package headless
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+)
+
+const WIDTH = 160
+const HEIGHT = 144
+
+// T-Cycles needed to draw a frame
+const CYCLES_PER_FRAME = 70224
+
+// Run executes the machine on the calling goroutine until n more frames
+// have been drawn. While the lcd is off no frame is drawn, so the run is
+// also bounded by the time n frames would take (twice, for the double speed)
+func Run(gb *emulator.GameBoy, frames int) {
+	target := gb.PPU.GetCurrentFrame() + frames
+	max_cycles := gb.CPU.GetCycles() + uint64(frames)*CYCLES_PER_FRAME*2
+	for gb.PPU.GetCurrentFrame() < target && gb.CPU.GetCycles() < max_cycles && !gb.CPU.QuitRequested() {
+		gb.CPU.Step()
+	}
+}
+
+// Screenshot converts the last frame drawn by the ppu
+func Screenshot(gb *emulator.GameBoy) *image.RGBA {
+	buffer := gb.PPU.FetcherGetBuffer()
+	img := image.NewRGBA(image.Rect(0, 0, WIDTH, HEIGHT))
+	for x := 0; x < WIDTH; x++ {
+		for y := 0; y < HEIGHT; y++ {
+			// ARGB
+			c := buffer[x][y]
+			img.SetRGBA(x, y, color.RGBA{R: uint8(c >> 16), G: uint8(c >> 8), B: uint8(c), A: 0xFF})
+		}
+	}
+	return img
+}
+
+func WritePNG(gb *emulator.GameBoy, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, Screenshot(gb)); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -1,6 +1,7 @@
 package interrupts
 
 import (
+	"encoding/gob"
 	"log"
 
 	"github.com/giammirove/gampboy_emulator/internal/registers"
@@ -15,10 +16,27 @@ Bit 3: Serial   Interrupt Enable  (INT $58)  (1=Enable)
 Bit 4: Joypad   Interrupt Enable  (INT $60)  (1=Enable)
 */
 
-var _IME_enable uint
-var _IME_pending uint
-var _IE_REG uint
-var _IF_REG uint
+// Interrupts holds IE, IF and the IME flag
+type Interrupts struct {
+	registers *registers.Registers
+
+	_IME_enable  uint
+	_IME_pending uint
+	_IE_REG      uint
+	_IF_REG      uint
+	_INT         [_INT_NUM][2]uint
+
+	// connected to the cpu and the mmu by the emulator
+	StackPush        func(value uint, bytes ...uint)
+	Cycle            func(val uint)
+	GetHalted        func() bool
+	MMUWriteToMemory func(addr uint, value uint, bytes ...uint)
+}
+
+// New creates the interrupts connected to the other components
+func New(registers *registers.Registers) *Interrupts {
+	return &Interrupts{registers: registers}
+}
 
 const _IE_ADDR = 0xFFFF
 const _IF_ADDR = 0xFF0F
@@ -37,15 +55,11 @@ const _TIMER_ADDR = 0x50
 const _SERIAL_ADDR = 0x58
 const _JOYPAD_ADDR = 0x60
 
-var _INT [_INT_NUM][2]uint
-
-var StackPush func(value uint, bytes ...uint)
-
-func Init() {
-	_IME_enable = 0
-	_IE_REG = 0
-	_IF_REG = 0xE1
-	_INT = [_INT_NUM][2]uint{
+func (in *Interrupts) Init() {
+	in._IME_enable = 0
+	in._IE_REG = 0
+	in._IF_REG = 0xE0
+	in._INT = [_INT_NUM][2]uint{
 		{_VBLANK, _VBLANK_ADDR},
 		{_LCD_STAT, _LCD_STAT_ADDR},
 		{_TIMER, _TIMER_ADDR},
@@ -54,108 +68,108 @@ func Init() {
 	}
 }
 
-var Cycle func(val uint)
+// PostBoot is the state left by the boot rom, the vblank is requested
+func (in *Interrupts) PostBoot() {
+	in._IF_REG = 0xE1
+}
 
-func HandleInterrupts() bool {
+func (in *Interrupts) HandleInterrupts() bool {
 	// order matter
 	for i := 0; i < _INT_NUM; i++ {
-		if checkInterrupt(_INT[i][1], _INT[i][0]) {
+		if in.checkInterrupt(in._INT[i][1], in._INT[i][0]) {
 			return true
 		}
 	}
 	return false
 }
 
-func checkInterrupt(addr uint, bit uint) bool {
-	if GetBitIE(bit) && GetBitIF(bit) {
+func (in *Interrupts) checkInterrupt(addr uint, bit uint) bool {
+	if in.GetBitIE(bit) && in.GetBitIF(bit) {
 		// if cpu is halted it takes 4 cycle more
-		if GetHalted() {
+		if in.GetHalted() {
 			return true
 		}
-		return handleInterrupt(addr, bit)
+		return in.handleInterrupt(addr, bit)
 	}
 	return false
 }
 
-var GetHalted func() bool
-var MMUWriteToMemory func(addr uint, value uint, bytes ...uint)
-
-func handleInterrupt(addr uint, bit uint) bool {
+func (in *Interrupts) handleInterrupt(addr uint, bit uint) bool {
 	// prev := registers.SP()
-	hi, low := utility.GetHiLow(uint16(registers.PC()))
-	Cycle(4)
-	registers.DecrementSP()
-	Cycle(4)
-	MMUWriteToMemory(registers.SP(), uint(hi))
+	hi, low := utility.GetHiLow(uint16(in.registers.PC()))
+	in.Cycle(4)
+	in.registers.DecrementSP()
+	in.Cycle(4)
+	in.MMUWriteToMemory(in.registers.SP(), uint(hi))
 	// check if IE of IF have been overwritten
-	if !(GetBitIE(bit) && GetBitIF(bit)) {
+	if !(in.GetBitIE(bit) && in.GetBitIF(bit)) {
 		// TOOD: check this one
-		registers.SetPC(0x0000)
+		in.registers.SetPC(0x0000)
 		return false
 	}
-	Cycle(4)
-	registers.DecrementSP()
-	Cycle(4)
-	MMUWriteToMemory(registers.SP(), uint(low))
-	SetIME(0)
-	DisableBitIF(bit)
-	Cycle(4)
-	registers.SetPC(addr)
+	in.Cycle(4)
+	in.registers.DecrementSP()
+	in.Cycle(4)
+	in.MMUWriteToMemory(in.registers.SP(), uint(low))
+	in.SetIME(0)
+	in.DisableBitIF(bit)
+	in.Cycle(4)
+	in.registers.SetPC(addr)
 	return true
 }
 
-func RequestInterruptTimer() {
-	SetBitIF(_TIMER)
+func (in *Interrupts) RequestInterruptTimer() {
+	in.SetBitIF(_TIMER)
 }
-func RequestInterruptSTAT() {
-	SetBitIF(_LCD_STAT)
+func (in *Interrupts) RequestInterruptSTAT() {
+	in.SetBitIF(_LCD_STAT)
 }
-func RequestInterruptVBlank() {
-	SetBitIF(_VBLANK)
+func (in *Interrupts) RequestInterruptVBlank() {
+	in.SetBitIF(_VBLANK)
 }
-func RequestInterruptSerial() {
-	SetBitIF(_SERIAL)
+func (in *Interrupts) RequestInterruptSerial() {
+	in.SetBitIF(_SERIAL)
 }
-func RequestInterruptJoypad() {
-	SetBitIF(_JOYPAD)
+func (in *Interrupts) RequestInterruptJoypad() {
+	in.SetBitIF(_JOYPAD)
 }
 
 // interrupts to be enable need one cpu cycle
-func EnableInterrupts() {
-	_IME_pending = 1
+func (in *Interrupts) EnableInterrupts() {
+	in._IME_pending = 1
 }
-func EnableInterruptsImmediately() {
-	_IME_pending = 0
-	_IME_enable = 1
+func (in *Interrupts) EnableInterruptsImmediately() {
+	in._IME_pending = 0
+	in._IME_enable = 1
 }
 
-func DisableInterrupts() {
-	_IME_enable = 0
-	_IME_pending = 0
+func (in *Interrupts) DisableInterrupts() {
+	in._IME_enable = 0
+	in._IME_pending = 0
 }
 
 func IsInterruptAddr(addr uint) bool {
 	return addr == _IE_ADDR || addr == _IF_ADDR
 }
 
-func ReadFromMemory(addr uint) uint {
+func (in *Interrupts) ReadFromMemory(addr uint) uint {
 	if addr == _IE_ADDR {
-		return GetIE()
+		return in.GetIE()
 	} else if addr == _IF_ADDR {
-		return GetIF()
+		return in.GetIF()
 	}
 
 	log.Fatalf("Invalid interrupt address (Read) (0x%08X)\n", addr)
 	return 0
 }
-func WriteToMemory(addr uint, value uint) {
+func (in *Interrupts) WriteToMemory(addr uint, value uint) {
 	if addr == _IE_ADDR {
-		SetIE(value)
+		in.SetIE(value)
 		// log.Printf("IE -> %04X\n", value)
 		// utility.WaitHere()
 		return
 	} else if addr == _IF_ADDR {
-		SetIF(value)
+		in.SetIF(value)
 		// log.Printf("IF -> %04X\n", value)
 		// utility.WaitHere()
 		return
@@ -164,142 +178,150 @@ func WriteToMemory(addr uint, value uint) {
 	log.Fatalf("Invalid interrupt address (Write) (0x%08X)\n", addr)
 }
 
-func GetIME() bool {
-	return _IME_enable == 1
+func (in *Interrupts) GetIME() bool {
+	return in._IME_enable == 1
 }
-func SetIME(val uint) {
-	_IME_enable = val
+func (in *Interrupts) SetIME(val uint) {
+	in._IME_enable = val
 }
-func GetPendingIME() bool {
-	return _IME_pending == 1
+func (in *Interrupts) GetPendingIME() bool {
+	return in._IME_pending == 1
 }
-func SetPendingIME(val uint) {
-	_IME_pending = val
+func (in *Interrupts) SetPendingIME(val uint) {
+	in._IME_pending = val
 }
 
-func GetIE() uint {
-	return _IE_REG
+func (in *Interrupts) GetIE() uint {
+	return in._IE_REG
 }
-func GetIF() uint {
-	return _IF_REG
+func (in *Interrupts) GetIF() uint {
+	return in._IF_REG
 }
-func SetIE(value uint) {
-	_IE_REG = value | 0b11100000
+func (in *Interrupts) SetIE(value uint) {
+	in._IE_REG = value | 0b11100000
 }
-func SetIF(value uint) {
-	_IF_REG = value | 0b11100000
+func (in *Interrupts) SetIF(value uint) {
+	in._IF_REG = value | 0b11100000
 }
 
-func GetBitIE(bit uint) bool {
-	return utility.GetBit(_IE_REG, bit) == 1
+func (in *Interrupts) GetBitIE(bit uint) bool {
+	return utility.GetBit(in._IE_REG, bit) == 1
 }
-func GetBitIF(bit uint) bool {
-	return utility.GetBit(_IF_REG, bit) == 1
+func (in *Interrupts) GetBitIF(bit uint) bool {
+	return utility.GetBit(in._IF_REG, bit) == 1
 }
-func SetBitIE(bit uint) {
-	SetIE(utility.SetBit(_IE_REG, bit))
+func (in *Interrupts) SetBitIE(bit uint) {
+	in.SetIE(utility.SetBit(in._IE_REG, bit))
 }
-func SetBitIF(bit uint) {
-	SetIF(utility.SetBit(_IF_REG, bit))
+func (in *Interrupts) SetBitIF(bit uint) {
+	in.SetIF(utility.SetBit(in._IF_REG, bit))
 }
-func DisableBitIE(bit uint) {
-	SetIE(utility.ClearBit(_IE_REG, bit))
+func (in *Interrupts) DisableBitIE(bit uint) {
+	in.SetIE(utility.ClearBit(in._IE_REG, bit))
 }
-func DisableBitIF(bit uint) {
-	SetIF(utility.ClearBit(_IF_REG, bit))
+func (in *Interrupts) DisableBitIF(bit uint) {
+	in.SetIF(utility.ClearBit(in._IF_REG, bit))
 }
 
-func GetVBlankIE() bool {
-	return utility.GetBit(_IE_REG, _VBLANK) == 1
+func (in *Interrupts) GetVBlankIE() bool {
+	return utility.GetBit(in._IE_REG, _VBLANK) == 1
 }
-func EnableVBlankIE() {
-	SetBitIE(_VBLANK)
+func (in *Interrupts) EnableVBlankIE() {
+	in.SetBitIE(_VBLANK)
 }
-func DisableVBlankIE() {
-	DisableBitIE(_VBLANK)
+func (in *Interrupts) DisableVBlankIE() {
+	in.DisableBitIE(_VBLANK)
 }
-func GetVBlankIF() bool {
-	return utility.GetBit(_IF_REG, _VBLANK) == 1
+func (in *Interrupts) GetVBlankIF() bool {
+	return utility.GetBit(in._IF_REG, _VBLANK) == 1
 }
-func EnableVBlankIF() {
-	SetBitIF(_VBLANK)
+func (in *Interrupts) EnableVBlankIF() {
+	in.SetBitIF(_VBLANK)
 }
-func DisableVBlankIF() {
-	DisableBitIF(_VBLANK)
+func (in *Interrupts) DisableVBlankIF() {
+	in.DisableBitIF(_VBLANK)
 }
 
-func GetLCDSTATIE() bool {
-	return utility.GetBit(_IE_REG, _LCD_STAT) == 1
+func (in *Interrupts) GetLCDSTATIE() bool {
+	return utility.GetBit(in._IE_REG, _LCD_STAT) == 1
 }
-func EnableLCDSTATIE() {
-	SetBitIE(_LCD_STAT)
+func (in *Interrupts) EnableLCDSTATIE() {
+	in.SetBitIE(_LCD_STAT)
 }
-func DisableLCDSTATIE() {
-	DisableBitIE(_LCD_STAT)
+func (in *Interrupts) DisableLCDSTATIE() {
+	in.DisableBitIE(_LCD_STAT)
 }
-func GetLCDSTATIF() bool {
-	return utility.GetBit(_IF_REG, _LCD_STAT) == 1
+func (in *Interrupts) GetLCDSTATIF() bool {
+	return utility.GetBit(in._IF_REG, _LCD_STAT) == 1
 }
-func EnableLCDSTATIF() {
-	SetBitIF(_LCD_STAT)
+func (in *Interrupts) EnableLCDSTATIF() {
+	in.SetBitIF(_LCD_STAT)
 }
-func DisableLCDSTATIF() {
-	DisableBitIF(_LCD_STAT)
+func (in *Interrupts) DisableLCDSTATIF() {
+	in.DisableBitIF(_LCD_STAT)
 }
 
-func GetTimerIE() bool {
-	return utility.GetBit(_IE_REG, _TIMER) == 1
+func (in *Interrupts) GetTimerIE() bool {
+	return utility.GetBit(in._IE_REG, _TIMER) == 1
 }
-func EnableTimerIE() {
-	SetBitIE(_TIMER)
+func (in *Interrupts) EnableTimerIE() {
+	in.SetBitIE(_TIMER)
 }
-func DisableTimerIE() {
-	DisableBitIE(_TIMER)
+func (in *Interrupts) DisableTimerIE() {
+	in.DisableBitIE(_TIMER)
 }
-func GetTimerIF() bool {
-	return utility.GetBit(_IF_REG, _TIMER) == 1
+func (in *Interrupts) GetTimerIF() bool {
+	return utility.GetBit(in._IF_REG, _TIMER) == 1
 }
-func EnableTimerIF() {
-	SetBitIF(_TIMER)
+func (in *Interrupts) EnableTimerIF() {
+	in.SetBitIF(_TIMER)
 }
-func DisableTimerIF() {
-	DisableBitIF(_TIMER)
+func (in *Interrupts) DisableTimerIF() {
+	in.DisableBitIF(_TIMER)
 }
 
-func GetSerialIE() bool {
-	return utility.GetBit(_IE_REG, _SERIAL) == 1
+func (in *Interrupts) GetSerialIE() bool {
+	return utility.GetBit(in._IE_REG, _SERIAL) == 1
 }
-func EnableSerialIE() {
-	SetBitIE(_SERIAL)
+func (in *Interrupts) EnableSerialIE() {
+	in.SetBitIE(_SERIAL)
 }
-func DisableSerialIE() {
-	DisableBitIE(_SERIAL)
+func (in *Interrupts) DisableSerialIE() {
+	in.DisableBitIE(_SERIAL)
 }
-func GetSerialIF() bool {
-	return utility.GetBit(_IF_REG, _SERIAL) == 1
+func (in *Interrupts) GetSerialIF() bool {
+	return utility.GetBit(in._IF_REG, _SERIAL) == 1
 }
-func EnableSerialIF() {
-	SetBitIF(_SERIAL)
+func (in *Interrupts) EnableSerialIF() {
+	in.SetBitIF(_SERIAL)
 }
-func DisableSerialIF() {
-	DisableBitIF(_SERIAL)
+func (in *Interrupts) DisableSerialIF() {
+	in.DisableBitIF(_SERIAL)
 }
 
-func GetJoypadIE() bool {
-	return utility.GetBit(_IE_REG, _JOYPAD) == 1
+func (in *Interrupts) GetJoypadIE() bool {
+	return utility.GetBit(in._IE_REG, _JOYPAD) == 1
+}
+func (in *Interrupts) EnableJoypadIE() {
+	in.SetBitIE(_JOYPAD)
 }
-func EnableJoypadIE() {
-	SetBitIE(_JOYPAD)
+func (in *Interrupts) DisableJoypadIE() {
+	in.DisableBitIE(_JOYPAD)
 }
-func DisableJoypadIE() {
-	DisableBitIE(_JOYPAD)
+func (in *Interrupts) GetJoypadIF() bool {
+	return utility.GetBit(in._IF_REG, _JOYPAD) == 1
 }
-func GetJoypadIF() bool {
-	return utility.GetBit(_IF_REG, _JOYPAD) == 1
+func (in *Interrupts) EnableJoypadIF() {
+	in.SetBitIF(_JOYPAD)
 }
-func EnableJoypadIF() {
-	SetBitIF(_JOYPAD)
+func (in *Interrupts) DisableJoypadIF() {
+	in.DisableBitIF(_JOYPAD)
 }
-func DisableJoypadIF() {
-	DisableBitIF(_JOYPAD)
+
+func (in *Interrupts) SaveState(enc *gob.Encoder) error {
+	return utility.EncodeAll(enc, in._IME_enable, in._IME_pending, in._IE_REG, in._IF_REG)
+}
+
+func (in *Interrupts) LoadState(dec *gob.Decoder) error {
+	return utility.DecodeAll(dec, &in._IME_enable, &in._IME_pending, &in._IE_REG, &in._IF_REG)
 }
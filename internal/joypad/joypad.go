@@ -1,6 +1,7 @@
 package joypad
 
 import (
+	"encoding/gob"
 	"log"
 
 	"github.com/giammirove/gampboy_emulator/internal/interrupts"
@@ -15,60 +16,73 @@ const _JOYPAD_UP_SELECT_BIT = 2
 const _JOYPAD_LEFT_B_BIT = 1
 const _JOYPAD_RIGHT_A_BIT = 0
 
-var actions uint
-var directions uint
-var btn_start uint
-var btn_select uint
-var btn_b uint
-var btn_a uint
-var btn_down uint
-var btn_up uint
-var btn_left uint
-var btn_right uint
-
-func Init() {
+// Joypad holds the buttons and the P1 register
+type Joypad struct {
+	interrupts *interrupts.Interrupts
+
+	actions    uint
+	directions uint
+	btn_start  uint
+	btn_select uint
+	btn_b      uint
+	btn_a      uint
+	btn_down   uint
+	btn_up     uint
+	btn_left   uint
+	btn_right  uint
+
+	// connected to the mmu by the emulator
+	SaveGame func()
+}
+
+// New creates the joypad connected to the other components
+func New(interrupts *interrupts.Interrupts) *Joypad {
+	return &Joypad{interrupts: interrupts}
+}
+
+func (j *Joypad) Init() {
 	// default is all 1 == all not pressed
-	Reset()
+	j.Reset()
 }
 
-func Reset() {
-	actions = 1
-	directions = 1
-	btn_start = 1
-	btn_select = 1
-	btn_a = 1
-	btn_b = 1
-	btn_down = 1
-	btn_up = 1
-	btn_left = 1
-	btn_right = 1
+func (j *Joypad) Reset() {
+	j.actions = 1
+	j.directions = 1
+	j.btn_start = 1
+	j.btn_select = 1
+	j.btn_a = 1
+	j.btn_b = 1
+	j.btn_down = 1
+	j.btn_up = 1
+	j.btn_left = 1
+	j.btn_right = 1
 }
 
 func IsJoypadAddr(addr uint) bool {
 	return addr == _JOYPAD_ADDR
 }
 
-func ReadFromMemory(addr uint) uint {
+func (j *Joypad) ReadFromMemory(addr uint) uint {
 	if addr != _JOYPAD_ADDR {
 		log.Fatalf("Invalid sound address (0x%8X)", addr)
 	}
 	r := uint(0xCF)
-	if actions == 0x0 {
-		r = utility.WriteBit(r, _JOYPAD_DOWN_START_BIT, btn_start)
-		r = utility.WriteBit(r, _JOYPAD_UP_SELECT_BIT, btn_select)
-		r = utility.WriteBit(r, _JOYPAD_LEFT_B_BIT, btn_b)
-		r = utility.WriteBit(r, _JOYPAD_RIGHT_A_BIT, btn_a)
+	if j.actions == 0x0 {
+		r = utility.WriteBit(r, _JOYPAD_DOWN_START_BIT, j.btn_start)
+		r = utility.WriteBit(r, _JOYPAD_UP_SELECT_BIT, j.btn_select)
+		r = utility.WriteBit(r, _JOYPAD_LEFT_B_BIT, j.btn_b)
+		r = utility.WriteBit(r, _JOYPAD_RIGHT_A_BIT, j.btn_a)
 	}
-	if directions == 0x0 {
-		r = utility.WriteBit(r, _JOYPAD_DOWN_START_BIT, btn_down)
-		r = utility.WriteBit(r, _JOYPAD_UP_SELECT_BIT, btn_up)
-		r = utility.WriteBit(r, _JOYPAD_LEFT_B_BIT, btn_left)
-		r = utility.WriteBit(r, _JOYPAD_RIGHT_A_BIT, btn_right)
+	if j.directions == 0x0 {
+		r = utility.WriteBit(r, _JOYPAD_DOWN_START_BIT, j.btn_down)
+		r = utility.WriteBit(r, _JOYPAD_UP_SELECT_BIT, j.btn_up)
+		r = utility.WriteBit(r, _JOYPAD_LEFT_B_BIT, j.btn_left)
+		r = utility.WriteBit(r, _JOYPAD_RIGHT_A_BIT, j.btn_right)
 	}
 	return uint(r)
 }
 
-func WriteToMemory(addr uint, value uint) {
+func (j *Joypad) WriteToMemory(addr uint, value uint) {
 	if addr != _JOYPAD_ADDR {
 		log.Fatalf("Invalid sound address (0x%8X)", addr)
 	}
@@ -76,74 +90,78 @@ func WriteToMemory(addr uint, value uint) {
 	new_actions := utility.GetBit(uint(value), _JOYPAD_ACTIONS_BIT)
 	new_directions := utility.GetBit(uint(value), _JOYPAD_DIRECTIONS_BIT)
 
-	if (new_actions == 0x0 && actions == 0x1) || (new_directions == 0x0 && directions == 0x1) {
-		interrupts.RequestInterruptJoypad()
+	if (new_actions == 0x0 && j.actions == 0x1) || (new_directions == 0x0 && j.directions == 0x1) {
+		j.interrupts.RequestInterruptJoypad()
 	}
-	actions = new_actions
-	directions = new_directions
+	j.actions = new_actions
+	j.directions = new_directions
 }
 
 // ACTIONS
-func SetJoypadStart() {
-	btn_start = 0
-	interrupts.RequestInterruptJoypad()
+func (j *Joypad) SetJoypadStart() {
+	j.btn_start = 0
+	j.interrupts.RequestInterruptJoypad()
 }
-func ClearJoypadStart() {
-	btn_start = 1
+func (j *Joypad) ClearJoypadStart() {
+	j.btn_start = 1
 }
-func SetJoypadSelect() {
-	btn_select = 0
-	interrupts.RequestInterruptJoypad()
+func (j *Joypad) SetJoypadSelect() {
+	j.btn_select = 0
+	j.interrupts.RequestInterruptJoypad()
 }
-func ClearJoypadSelect() {
-	btn_select = 1
+func (j *Joypad) ClearJoypadSelect() {
+	j.btn_select = 1
 }
-func SetJoypadA() {
-	btn_a = 0
-	interrupts.RequestInterruptJoypad()
+func (j *Joypad) SetJoypadA() {
+	j.btn_a = 0
+	j.interrupts.RequestInterruptJoypad()
 }
-func ClearJoypadA() {
-	btn_a = 1
+func (j *Joypad) ClearJoypadA() {
+	j.btn_a = 1
 }
-func SetJoypadB() {
-	btn_b = 0
-	interrupts.RequestInterruptJoypad()
+func (j *Joypad) SetJoypadB() {
+	j.btn_b = 0
+	j.interrupts.RequestInterruptJoypad()
 }
-func ClearJoypadB() {
-	btn_b = 1
+func (j *Joypad) ClearJoypadB() {
+	j.btn_b = 1
 }
 
 // DIRECTIONS
-func SetJoypadDown() {
-	btn_down = 0
-	interrupts.RequestInterruptJoypad()
+func (j *Joypad) SetJoypadDown() {
+	j.btn_down = 0
+	j.interrupts.RequestInterruptJoypad()
+}
+func (j *Joypad) ClearJoypadDown() {
+	j.btn_down = 1
 }
-func ClearJoypadDown() {
-	btn_down = 1
+func (j *Joypad) SetJoypadUp() {
+	j.btn_up = 0
+	j.interrupts.RequestInterruptJoypad()
 }
-func SetJoypadUp() {
-	btn_up = 0
-	interrupts.RequestInterruptJoypad()
+func (j *Joypad) ClearJoypadUp() {
+	j.btn_up = 1
 }
-func ClearJoypadUp() {
-	btn_up = 1
+func (j *Joypad) SetJoypadRight() {
+	j.btn_right = 0
+	j.interrupts.RequestInterruptJoypad()
 }
-func SetJoypadRight() {
-	btn_right = 0
-	interrupts.RequestInterruptJoypad()
+func (j *Joypad) ClearJoypadRight() {
+	j.btn_right = 1
 }
-func ClearJoypadRight() {
-	btn_right = 1
+func (j *Joypad) SetJoypadLeft() {
+	j.btn_left = 0
+	j.interrupts.RequestInterruptJoypad()
 }
-func SetJoypadLeft() {
-	btn_left = 0
-	interrupts.RequestInterruptJoypad()
+func (j *Joypad) ClearJoypadLeft() {
+	j.btn_left = 1
 }
-func ClearJoypadLeft() {
-	btn_left = 1
+
+// the buttons are not part of the state, they follow the keyboard
+func (j *Joypad) SaveState(enc *gob.Encoder) error {
+	return utility.EncodeAll(enc, j.actions, j.directions)
 }
 
-var ToggleDebugMode func()
-var TogglePauseMode func()
-var ToggleManualMode func()
-var SaveGame func()
+func (j *Joypad) LoadState(dec *gob.Decoder) error {
+	return utility.DecodeAll(dec, &j.actions, &j.directions)
+}
@@ -0,0 +1,177 @@
+package link
+
+import (
+	"io"
+	"log"
+	"net"
+
+	"github.com/giammirove/gampboy_emulator/internal/serial"
+)
+
+// every message is 2 bytes, the kind and the value
+const (
+	// the other side reached the next sync point
+	_MSG_SYNC = 'S'
+	// byte of the master, normal or CGB fast clock
+	_MSG_TRANSFER      = 'T'
+	_MSG_TRANSFER_FAST = 'F'
+	// byte of the slave
+	_MSG_REPLY = 'R'
+)
+
+// 2 MHz ticks between two sync points (~1 ms),
+// a side never runs more than two of them ahead of the other
+const _SYNC_TICKS = 2048
+
+const _NO_DEVICE = 0xFF
+
+type message_t struct {
+	kind  byte
+	value byte
+}
+
+// TCP is a link cable to another emulator over a tcp connection,
+// the two machines are kept in lockstep
+type TCP struct {
+	conn     net.Conn
+	messages chan message_t
+	closed   bool
+	ticks    uint
+	// sync points sent and received
+	sent     uint64
+	received uint64
+}
+
+// Host waits for the other emulator to join on addr
+func Host(addr string) (*TCP, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+	log.Printf("Waiting for the link cable on %s\n", listener.Addr())
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newTCP(conn), nil
+}
+
+// Join connects to the emulator hosting on addr
+func Join(addr string) (*TCP, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return newTCP(conn), nil
+}
+
+func newTCP(conn net.Conn) *TCP {
+	t := &TCP{conn: conn, messages: make(chan message_t, 64)}
+	go t.read()
+	return t
+}
+
+func (t *TCP) Close() error {
+	return t.conn.Close()
+}
+
+// the messages are read in background, so the emulation blocks only when it has to
+func (t *TCP) read() {
+	defer close(t.messages)
+	var buffer [2]byte
+	for {
+		if _, err := io.ReadFull(t.conn, buffer[:]); err != nil {
+			return
+		}
+		t.messages <- message_t{kind: buffer[0], value: buffer[1]}
+	}
+}
+
+func (t *TCP) send(kind byte, value byte) {
+	if t.closed {
+		return
+	}
+	if _, err := t.conn.Write([]byte{kind, value}); err != nil {
+		t.disconnect()
+	}
+}
+
+func (t *TCP) disconnect() {
+	if !t.closed {
+		log.Printf("Link cable disconnected\n")
+		t.closed = true
+		t.conn.Close()
+	}
+}
+
+// next message, it blocks only if wait is set
+func (t *TCP) next(wait bool) (message_t, bool) {
+	if t.closed {
+		return message_t{}, false
+	}
+	var msg message_t
+	var ok bool
+	if wait {
+		msg, ok = <-t.messages
+	} else {
+		select {
+		case msg, ok = <-t.messages:
+		default:
+			return message_t{}, false
+		}
+	}
+	if !ok {
+		t.disconnect()
+	}
+	return msg, ok
+}
+
+func (t *TCP) Transfer(value uint8, fast bool) uint8 {
+	kind := byte(_MSG_TRANSFER)
+	if fast {
+		kind = _MSG_TRANSFER_FAST
+	}
+	t.send(kind, value)
+	for {
+		msg, ok := t.next(true)
+		if !ok {
+			return _NO_DEVICE
+		}
+		switch msg.kind {
+		case _MSG_SYNC:
+			t.received++
+		case _MSG_TRANSFER, _MSG_TRANSFER_FAST:
+			// both sides are the master, nobody drives the other clock
+			t.send(_MSG_REPLY, _NO_DEVICE)
+		case _MSG_REPLY:
+			return msg.value
+		}
+	}
+}
+
+func (t *TCP) Tick(ticks uint) (serial.Transfer_t, bool) {
+	t.ticks += ticks
+	if t.ticks >= _SYNC_TICKS {
+		t.ticks -= _SYNC_TICKS
+		t.send(_MSG_SYNC, 0)
+		t.sent++
+	}
+	for {
+		// too far ahead, wait for the other side
+		msg, ok := t.next(t.sent > t.received+1)
+		if !ok {
+			return serial.Transfer_t{}, false
+		}
+		switch msg.kind {
+		case _MSG_SYNC:
+			t.received++
+		case _MSG_TRANSFER, _MSG_TRANSFER_FAST:
+			return serial.Transfer_t{Value: msg.value, Fast: msg.kind == _MSG_TRANSFER_FAST}, true
+		}
+	}
+}
+
+func (t *TCP) Reply(value uint8) {
+	t.send(_MSG_REPLY, value)
+}
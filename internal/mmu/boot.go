@@ -0,0 +1,73 @@
+package mmu
+
+import "fmt"
+
+// writing a value other than 0 unmaps the boot rom, until the next reset
+const _BOOT = 0xFF50
+
+// sizes of the boot roms, the cgb one has a hole for the cartridge header
+const BOOT_DMG_SIZE = 0x100
+const BOOT_CGB_SIZE = 0x900
+
+// written by the cgb boot rom, bit 2 set = dmg compatibility mode
+const _KEY0 = 0xFF4C
+const _KEY0_DMG_MODE = 0b1100
+
+const _BOOT_HEADER_START = 0x100
+const _BOOT_HEADER_END = 0x1FF
+
+// SetBootROM maps boot over the cartridge, nil runs without boot rom
+func (m *MMU) SetBootROM(boot []byte) error {
+	if boot != nil && len(boot) != BOOT_DMG_SIZE && len(boot) != BOOT_CGB_SIZE {
+		return fmt.Errorf("boot rom of %d bytes, expected %d (DMG) or %d (CGB)", len(boot), BOOT_DMG_SIZE, BOOT_CGB_SIZE)
+	}
+	m.boot = boot
+	m.boot_mapped = boot != nil
+	return nil
+}
+
+// GetBootROM is the boot rom given to SetBootROM, also after it is unmapped
+func (m *MMU) GetBootROM() []byte {
+	return m.boot
+}
+
+// IsBootROMMapped tells if the boot rom is still running
+func (m *MMU) IsBootROMMapped() bool {
+	return m.boot_mapped
+}
+
+func (m *MMU) inBootROM(addr uint) bool {
+	if !m.boot_mapped || addr >= uint(len(m.boot)) {
+		return false
+	}
+	return addr < _BOOT_HEADER_START || addr > _BOOT_HEADER_END
+}
+
+func (m *MMU) writeBoot(value byte) {
+	if value != 0 {
+		m.boot_mapped = false
+		m.UpdateCGBMode()
+	}
+}
+
+// KEY0 is locked once the boot rom is unmapped
+func (m *MMU) writeKey0(value byte) {
+	if !m.boot_mapped {
+		return
+	}
+	m.ppu.WriteToLCDMemory(_KEY0, uint(value))
+	m.UpdateCGBMode()
+}
+
+// UpdateCGBMode follows the cgb boot rom: it runs in cgb mode until it
+// writes KEY0, then the cartridge keeps the mode it picked
+func (m *MMU) UpdateCGBMode() {
+	if m.boot == nil {
+		return
+	}
+	cgb := m.headers.IsCGBCartridge()
+	if m.boot_mapped {
+		cgb = m.ppu.ReadFromLCDMemory(_KEY0)&_KEY0_DMG_MODE == 0
+	}
+	m.headers.SetCGBMode(cgb, true)
+}
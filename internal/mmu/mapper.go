@@ -0,0 +1,119 @@
+package mmu
+
+import (
+	"encoding/gob"
+	"fmt"
+
+	"github.com/giammirove/gampboy_emulator/internal/utility"
+)
+
+// Mapper is the memory bank controller of the cartridge, it owns the rom,
+// the external ram and every register used to switch between banks
+type Mapper interface {
+	// 0x0000 - 0x7FFF
+	ReadROM(addr uint) uint8
+	WriteROM(addr uint, value uint8)
+	// 0xA000 - 0xBFFF
+	ReadRAM(addr uint) uint8
+	WriteRAM(addr uint, value uint8)
+	// battery backed memory, as stored in the .saves file
+	Save() []byte
+	Load(data []byte)
+	// called every M-Cycle
+	Tick()
+	// registers and ram for the save states
+	SaveState(enc *gob.Encoder) error
+	LoadState(dec *gob.Decoder) error
+	// current rom and ram bank, only for debugging
+	Banks() (uint, uint)
+}
+
+// NewMapper picks the memory bank controller from the cartridge type
+func (m *MMU) NewMapper(rom []byte) (Mapper, error) {
+	ram_size := m.headers.GetRamSize()
+	switch m.headers.GetCartridgeType() {
+	case 0x00, 0x08, 0x09:
+		return newRomOnly(rom, ram_size), nil
+	case 0x01, 0x02, 0x03:
+		return newMBC1(rom, ram_size), nil
+	case 0x05, 0x06:
+		return newMBC2(rom), nil
+	case 0x0F, 0x10:
+		return newMBC3(m, rom, ram_size, true), nil
+	case 0x11, 0x12, 0x13:
+		return newMBC3(m, rom, ram_size, false), nil
+	case 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 0x1E:
+		return newMBC5(m, rom, ram_size, m.headers.HasRumble()), nil
+	}
+	return nil, fmt.Errorf("unsupported cartridge type %s (%02X)", m.headers.GetCartridgeName(), m.headers.GetCartridgeType())
+}
+
+// state shared by every memory bank controller
+type banks_t struct {
+	rom         []byte
+	ram         []byte
+	rom_bank    uint
+	ram_bank    uint
+	ram_enabled bool
+}
+
+func newBanks(rom []byte, ram_size uint) banks_t {
+	return banks_t{
+		rom:      rom,
+		ram:      make([]byte, ram_size),
+		rom_bank: 1,
+	}
+}
+
+// banks that are not present are mirrored
+func (b *banks_t) romOffset(bank uint, addr uint) uint {
+	return (bank*_ROM_BANK_SIZE + addr&(_ROM_BANK_SIZE-1)) % uint(len(b.rom))
+}
+
+func (b *banks_t) ramOffset(bank uint, addr uint) uint {
+	return (bank*_RAM_BANK_SIZE + addr - _ERAM_START) % uint(len(b.ram))
+}
+
+func (b *banks_t) ReadROM(addr uint) uint8 {
+	if addr <= _ROM0_END {
+		return b.rom[b.romOffset(0, addr)]
+	}
+	return b.rom[b.romOffset(b.rom_bank, addr)]
+}
+
+func (b *banks_t) ReadRAM(addr uint) uint8 {
+	if !b.ram_enabled || len(b.ram) == 0 {
+		return 0xFF
+	}
+	return b.ram[b.ramOffset(b.ram_bank, addr)]
+}
+
+func (b *banks_t) WriteRAM(addr uint, value uint8) {
+	if !b.ram_enabled || len(b.ram) == 0 {
+		return
+	}
+	b.ram[b.ramOffset(b.ram_bank, addr)] = value
+}
+
+func (b *banks_t) Save() []byte {
+	return b.ram
+}
+
+// the size is fixed by the cartridge, extra bytes are ignored
+func (b *banks_t) Load(data []byte) {
+	copy(b.ram, data)
+}
+
+func (b *banks_t) Tick() {}
+
+func (b *banks_t) Banks() (uint, uint) {
+	return b.rom_bank, b.ram_bank
+}
+
+func (b *banks_t) SaveState(enc *gob.Encoder) error {
+	return utility.EncodeAll(enc, b.ram, b.rom_bank, b.ram_bank, b.ram_enabled)
+}
+
+func (b *banks_t) LoadState(dec *gob.Decoder) error {
+	return utility.DecodeAll(dec, &b.ram, &b.rom_bank, &b.ram_bank, &b.ram_enabled)
+}
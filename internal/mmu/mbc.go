@@ -5,21 +5,15 @@ import (
 	"io/ioutil"
 	"log"
 	"time"
-
-	"github.com/giammirove/gampboy_emulator/internal/headers"
-	"github.com/giammirove/gampboy_emulator/internal/ppu"
 )
 
-// same for MBC1 , MBC3 (also for timer)
+// same for every MBC
 const _RAM_ENABLE_END = 0x1FFF
 const _RAM_ENABLE_VALUE = 0xA
-const _RAM_DISABLE_VALUE = 0x0
 
-// same for MBC1 , MBC3
 const _ROM_BANK_NUMBER_START = 0x2000
 const _ROM_BANK_NUMBER_END = 0x3FFF
 
-// same for MBC1 , MBC3
 const _RAM_BANK_NUMBER_START = 0x4000
 const _RAM_BANK_NUMBER_END = 0x5FFF
 
@@ -29,240 +23,163 @@ const _BANKING_MODE_END = 0x7FFF
 const _ROM_BANK_SIZE = 16 * 1024
 const _RAM_BANK_SIZE = 8 * 1024
 
-const _RTC_REGISTERS_NUM = 5
-
-// manage rom banks and external ram
-var WRAM [_RAM_END - _RAM_START + 1]byte
-var WRAM_CGB [8][_RAM_CGB_END - _RAM_CGB_START + 1]byte
-var ERAM [_ERAM_END - _ERAM_START + 1]byte
-
-// 8 KiB each
-var ERAM_BANKS []byte
-
-// false = default, true = advanced banking mode
-var banking_mode bool
-var ram_enabled bool
-var rom_bank uint
-var ram_bank uint
-
-var rtc uint8
-var rtc_active bool
-var rtc_registers [_RTC_REGISTERS_NUM]uint8
-var rtc_latched bool
-var rtc_registers_latched [_RTC_REGISTERS_NUM]uint8
-
-var rom_memory_path string
-var save_needed bool
-
-func InitMBC() {
-
-	// ERAM_BANKS = make([]byte, headers.GetRamBankNumber())
-
-	banking_mode = false
-	ram_enabled = false
-	rom_bank = 1
-	ram_bank = 0
+// mbc state, part of MMU
+type mbc_t struct {
+	// manage rom banks and external ram
+	WRAM            [_RAM_END - _RAM_START + 1]byte
+	WRAM_CGB        [8][_RAM_CGB_END - _RAM_CGB_START + 1]byte
+	cart            Mapper
+	rom_memory_path string
+	save_needed     bool
+	saves_ticker    *time.Ticker
+}
 
-	rtc = 0
-	rtc_active = false
-	rtc_registers = [_RTC_REGISTERS_NUM]uint8{}
-	rtc_latched = false
-	rtc_registers_latched = [_RTC_REGISTERS_NUM]uint8{}
+func (m *MMU) InitMBC() error {
+	var err error
+	m.cart, err = m.NewMapper(m.ROM)
+	if err != nil {
+		return err
+	}
 
-	rom_memory_path = rom_path + ".saves"
-	save_needed = true
-	ERAM_BANKS = make([]byte, _RAM_BANK_SIZE*headers.GetRamBankNumber())
+	m.rom_memory_path = m.rom_path + ".saves"
+	m.save_needed = true
 
-	if headers.HasBattery() {
-		loadMemory()
+	if m.headers.HasBattery() && !m.NO_SAVES {
+		m.loadMemory()
 
-		savesTimer := time.Tick(time.Second)
-		go func() {
-			for range savesTimer {
-				SaveMemory()
-			}
-		}()
+		if m.saves_ticker == nil {
+			m.saves_ticker = time.NewTicker(time.Second)
+			go func() {
+				for range m.saves_ticker.C {
+					m.SaveMemory()
+				}
+			}()
+		}
 	}
+	return nil
 }
 
-func loadMemory() {
-	memory, err := ioutil.ReadFile(rom_memory_path)
+func (m *MMU) loadMemory() {
+	memory, err := ioutil.ReadFile(m.rom_memory_path)
 	if err != nil || len(memory) == 0 {
 		fmt.Printf("Error during loading previous games")
 		return
 	}
-	ERAM_BANKS = memory
+	m.cart.Load(memory)
 	fmt.Printf("!!! Saves successfully loaded\n")
 }
-func SaveMemory() {
-	if save_needed {
+func (m *MMU) SaveMemory() {
+	if m.save_needed && !m.NO_SAVES {
 		// fmt.Printf("!! Saving ... \n")
-		err := ioutil.WriteFile(rom_memory_path, ERAM_BANKS, 0666)
+		err := ioutil.WriteFile(m.rom_memory_path, m.cart.Save(), 0666)
 		if err != nil {
 			fmt.Printf("Error during saving games")
 			return
 		}
-		save_needed = false
+		m.save_needed = false
 		// fmt.Printf("!! Successfully saved \n")
 	}
 
 }
 
-func WriteToRomMemory(addr uint, value uint8) {
-
-	if addr >= 0 && addr <= _RAM_ENABLE_END {
-		if value == _RAM_ENABLE_VALUE {
-			ram_enabled = true
-		}
-		if value == _RAM_DISABLE_VALUE {
-			ram_enabled = false
-		}
-		return
-	}
-
-	if addr >= _ROM_BANK_NUMBER_START && addr <= _ROM_BANK_NUMBER_END {
-		rom_bank = uint(value) % headers.GetRomBankNumber()
-		if rom_bank == 0 {
-			rom_bank = 1
-		}
-		if headers.IsMBC1() && headers.GetRomBankBits() > 5 {
-			rom_bank = ram_bank<<5 + rom_bank
-		}
-
-		return
-	}
-
-	if addr >= _RAM_BANK_NUMBER_START && addr <= _RAM_BANK_NUMBER_END {
-		ram_bank = uint(value)
-
-		if headers.IsMBC3() {
-			rtc_active = value >= 0x8
-			if rtc_active {
-				rtc = value - 0x8
-			}
-		}
-		return
-	}
-
-	if addr >= _BANKING_MODE_START && addr <= _BANKING_MODE_END {
-		if headers.IsMBC3() {
-			// check for latch : 0x0 -> 0x1
-			if value == 0x1 {
-				rtc_latched = true
-				copy(rtc_registers_latched[:], rtc_registers[:])
-			} else if value == 0x0 {
-				rtc_latched = false
-			}
-			return
-		}
-
-		banking_mode = (value & 0b1) == 0x1
-		if banking_mode == false {
-			ram_bank = 0
-		}
-		return
+// Close stops the periodic saves of the battery ram
+func (m *MMU) Close() {
+	if m.saves_ticker != nil {
+		m.saves_ticker.Stop()
+		m.saves_ticker = nil
 	}
-
-	log.Fatalf("Read only memory %04X\n", addr)
 }
 
-func ReadFromRomMemory(addr uint) uint8 {
-	if addr <= _ROM0_END {
-		return ROM[addr]
-	}
-	// has to be at least MBC1 to use banks
-	// if !headers.IsMBC1() {
-	// 	return 0xFF
-	// }
+func (m *MMU) WriteToRomMemory(addr uint, value uint8) {
+	m.cart.WriteROM(addr, value)
+}
 
-	if addr >= _ROM1_START && addr <= _ROM1_END {
-		return ROM[addr+(rom_bank-1)*_ROM_BANK_SIZE]
+func (m *MMU) ReadFromRomMemory(addr uint) uint8 {
+	if m.inBootROM(addr) {
+		return m.boot[addr]
 	}
+	return m.cart.ReadROM(addr)
+}
 
-	log.Fatalf("Not handled %04X (ROM)\n", addr)
-	return 0
+// advances the cartridge hardware (e.g. the real time clock) by one M-Cycle
+func (m *MMU) TickMBC() {
+	m.cart.Tick()
 }
 
-func WriteToRamMemory(addr uint, value uint8) {
+func (m *MMU) WriteToRamMemory(addr uint, value uint8) {
 
 	if addr >= _RAM_START && addr <= _RAM_END {
 		// switchable bank
-		if headers.IsCGB() && addr >= _RAM_CGB_START && addr <= _RAM_CGB_END {
-			WRAM_CGB[ppu.GetWRAMBank()][addr] = value
+		if m.headers.IsCGB() && addr >= _RAM_CGB_START && addr <= _RAM_CGB_END {
+			m.WRAM_CGB[m.ppu.GetWRAMBank()][addr] = value
 			return
 		}
-		WRAM[addr-_RAM_START] = value
+		m.WRAM[addr-_RAM_START] = value
 		return
 	}
 
-	// has to be at least MBC1 to use banks
-	// if !headers.IsMBC1() {
-	// 	return
-	// }
-
 	if addr >= _ERAM_START && addr <= _ERAM_END {
-		if headers.IsMBC3() {
-			if ram_bank >= 0x8 {
-				rtc_registers[rtc] = value
-				return
-			}
-			off := addr - _ERAM_START + ram_bank*_RAM_BANK_SIZE
-			ERAM_BANKS[off] = value
-			save_needed = true
-			return
-		}
-		if ram_enabled {
-			off := addr - _ERAM_START + ram_bank*_RAM_BANK_SIZE
-			ERAM_BANKS[off] = value
-			save_needed = true
-			return
-		}
+		m.cart.WriteRAM(addr, value)
+		m.save_needed = true
 		return
 	}
 
 	log.Fatalf("Not handled %04X (RAM)\n", addr)
 }
 
-func ReadFromRamMemory(addr uint) uint8 {
+func (m *MMU) ReadFromRamMemory(addr uint) uint8 {
 	if addr >= _RAM_START && addr <= _RAM_END {
 		// switchable bank
-		if headers.IsCGB() && addr >= _RAM_CGB_START && addr <= _RAM_CGB_END {
-			return WRAM_CGB[ppu.GetWRAMBank()][addr]
+		if m.headers.IsCGB() && addr >= _RAM_CGB_START && addr <= _RAM_CGB_END {
+			return m.WRAM_CGB[m.ppu.GetWRAMBank()][addr]
 		}
-		return WRAM[addr-_RAM_START]
+		return m.WRAM[addr-_RAM_START]
 	}
-	// has to be at least MBC1 to use banks
-	// if !headers.IsMBC1() || !ram_enabled {
-	// 	return 0xFF
-	// }
-
 	if addr >= _ERAM_START && addr <= _ERAM_END {
-		if headers.IsMBC3() {
-			// if rtc_active {
-			if ram_bank >= 0x8 {
-				if rtc_latched {
-					return rtc_registers_latched[rtc]
-				} else {
-					return rtc_registers[rtc]
-				}
-			}
-			return ERAM_BANKS[addr-_ERAM_START+ram_bank*_RAM_BANK_SIZE]
-		}
-
-		if ram_enabled {
-			return ERAM_BANKS[addr-_ERAM_START+ram_bank*_RAM_BANK_SIZE]
-		} else {
-			return 0xFF
-		}
+		return m.cart.ReadRAM(addr)
 	}
 
 	log.Fatalf("Not handled %04X\n", addr)
 	return 0
 }
 
-func GetRomBank() uint {
+// GetBank is the bank mapped at addr (rom, vram, external ram or work ram),
+// as the symbol files number them
+func (m *MMU) GetBank(addr uint) uint {
+	switch {
+	case addr >= _ROM1_START && addr <= _ROM1_END:
+		return m.GetRomBank()
+	case addr >= _VRAM_START && addr <= _VRAM_END:
+		return m.ppu.GetVRAMBank()
+	case addr >= _ERAM_START && addr <= _ERAM_END:
+		return m.GetRamBank()
+	case addr >= _RAM_CGB_START && addr <= _RAM_END && m.headers.IsCGB():
+		return m.ppu.GetWRAMBank()
+	}
+	return 0
+}
+
+// ReadFromRomBank reads addr as if bank was mapped, only for debugging
+func (m *MMU) ReadFromRomBank(bank uint, addr uint) uint8 {
+	return m.ROM[(bank*_ROM_BANK_SIZE+addr&(_ROM_BANK_SIZE-1))%uint(len(m.ROM))]
+}
+
+// WriteToRomBank patches the rom where ReadFromRomBank reads, only for debugging
+func (m *MMU) WriteToRomBank(bank uint, addr uint, value uint8) {
+	m.ROM[(bank*_ROM_BANK_SIZE+addr&(_ROM_BANK_SIZE-1))%uint(len(m.ROM))] = value
+}
+
+func (m *MMU) GetRomBank() uint {
+	rom_bank, _ := m.cart.Banks()
 	return rom_bank
 }
-func GetRamBank() uint {
+func (m *MMU) GetRamBank() uint {
+	_, ram_bank := m.cart.Banks()
 	return ram_bank
 }
+func (m *MMU) GetRumble() bool {
+	if mbc, ok := m.cart.(*mbc5_t); ok {
+		return mbc.rumble
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package mmu
+
+import (
+	"encoding/gob"
+
+	"github.com/giammirove/gampboy_emulator/internal/utility"
+)
+
+const _MBC1_ROM_BANK_MASK = 0x1F
+
+type mbc1_t struct {
+	banks_t
+	// false = default, true = advanced banking mode
+	banking_mode bool
+	// lower 5 bits of the rom bank
+	bank1 uint
+	// upper 2 bits of the rom bank or ram bank
+	bank2 uint
+}
+
+func newMBC1(rom []byte, ram_size uint) *mbc1_t {
+	return &mbc1_t{banks_t: newBanks(rom, ram_size), bank1: 1}
+}
+
+func (m *mbc1_t) WriteROM(addr uint, value uint8) {
+	switch {
+	case addr <= _RAM_ENABLE_END:
+		m.ram_enabled = value&0xF == _RAM_ENABLE_VALUE
+	case addr <= _ROM_BANK_NUMBER_END:
+		m.bank1 = uint(value) & _MBC1_ROM_BANK_MASK
+		if m.bank1 == 0 {
+			m.bank1 = 1
+		}
+	case addr <= _RAM_BANK_NUMBER_END:
+		m.bank2 = uint(value) & 0b11
+	default:
+		m.banking_mode = (value & 0b1) == 0x1
+	}
+	m.rom_bank = m.bank2<<5 | m.bank1
+	m.ram_bank = 0
+	if m.banking_mode {
+		m.ram_bank = m.bank2
+	}
+}
+
+func (m *mbc1_t) ReadROM(addr uint) uint8 {
+	// in advanced banking mode the upper bits also apply to 0x0000 - 0x3FFF
+	if addr <= _ROM0_END && m.banking_mode {
+		return m.rom[m.romOffset(m.bank2<<5, addr)]
+	}
+	return m.banks_t.ReadROM(addr)
+}
+
+func (m *mbc1_t) SaveState(enc *gob.Encoder) error {
+	if err := m.banks_t.SaveState(enc); err != nil {
+		return err
+	}
+	return utility.EncodeAll(enc, m.banking_mode, m.bank1, m.bank2)
+}
+
+func (m *mbc1_t) LoadState(dec *gob.Decoder) error {
+	if err := m.banks_t.LoadState(dec); err != nil {
+		return err
+	}
+	return utility.DecodeAll(dec, &m.banking_mode, &m.bank1, &m.bank2)
+}
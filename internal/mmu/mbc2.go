@@ -0,0 +1,47 @@
+package mmu
+
+import "github.com/giammirove/gampboy_emulator/internal/utility"
+
+// MBC2 has 512 half bytes of ram built in the chip
+const _MBC2_RAM_SIZE = 512
+
+// on MBC2 bit 8 of the address selects ram enable (0) or rom bank (1)
+const _MBC2_REGISTER_SELECT_BIT = 8
+
+type mbc2_t struct {
+	banks_t
+}
+
+func newMBC2(rom []byte) *mbc2_t {
+	return &mbc2_t{banks_t: newBanks(rom, _MBC2_RAM_SIZE)}
+}
+
+func (m *mbc2_t) WriteROM(addr uint, value uint8) {
+	// 0x4000 - 0x7FFF is not used by MBC2
+	if addr > _ROM_BANK_NUMBER_END {
+		return
+	}
+	if !utility.TestBit(addr, _MBC2_REGISTER_SELECT_BIT) {
+		m.ram_enabled = value&0xF == _RAM_ENABLE_VALUE
+		return
+	}
+	m.rom_bank = uint(value & 0xF)
+	if m.rom_bank == 0 {
+		m.rom_bank = 1
+	}
+}
+
+func (m *mbc2_t) ReadRAM(addr uint) uint8 {
+	if !m.ram_enabled {
+		return 0xFF
+	}
+	// upper 4 bits are not connected and read as 1
+	return m.ram[(addr-_ERAM_START)%_MBC2_RAM_SIZE] | 0xF0
+}
+
+func (m *mbc2_t) WriteRAM(addr uint, value uint8) {
+	// only the lower 4 bits are stored, mirrored in the whole area
+	if m.ram_enabled {
+		m.ram[(addr-_ERAM_START)%_MBC2_RAM_SIZE] = value & 0xF
+	}
+}
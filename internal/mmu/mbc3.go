@@ -0,0 +1,268 @@
+package mmu
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"time"
+
+	"github.com/giammirove/gampboy_emulator/internal/utility"
+)
+
+const _RTC_REGISTERS_NUM = 5
+
+// ram bank numbers 0x08 - 0x0C select a rtc register
+const _MBC3_RTC_SELECT = 0x08
+
+const _MBC3_ROM_BANK_MASK = 0x7F
+
+const (
+	_RTC_S = iota
+	_RTC_M
+	_RTC_H
+	_RTC_DL
+	_RTC_DH
+)
+
+// unused bits are not stored
+var _RTC_MASKS = [_RTC_REGISTERS_NUM]uint8{0x3F, 0x3F, 0x1F, 0xFF, 0xC1}
+
+const _RTC_DAY_HIGH_BIT = 0
+const _RTC_HALT_BIT = 6
+const _RTC_DAY_CARRY_BIT = 7
+
+// the day counter is 9 bits wide
+const _RTC_MAX_DAYS = 512
+const _RTC_SECONDS_PER_DAY = 24 * 60 * 60
+
+// the clock is counted in double speed M-Cycles (2 MHz),
+// so it runs at the same pace in both speed modes
+const _RTC_TICKS_PER_SECOND = 2097152
+
+// footer appended to the saves by most emulators:
+// 5 live registers, 5 latched registers (4 bytes each) and the unix timestamp
+const _RTC_FOOTER_SIZE = 48
+
+// older emulators store the timestamp in 4 bytes
+const _RTC_FOOTER_SIZE_SHORT = 44
+
+// every ram size is a multiple of 2 KiB
+const _RTC_RAM_ALIGN = 2 * 1024
+
+type mbc3_t struct {
+	banks_t
+	mmu       *MMU
+	has_timer bool
+
+	rtc                   uint8
+	rtc_registers         [_RTC_REGISTERS_NUM]uint8
+	rtc_registers_latched [_RTC_REGISTERS_NUM]uint8
+	latch_value           uint8
+
+	// sub second counter, emulated clock only
+	rtc_ticks uint
+	// last time the registers were synchronized with the host clock
+	rtc_sync time.Time
+}
+
+func newMBC3(mmu *MMU, rom []byte, ram_size uint, has_timer bool) *mbc3_t {
+	return &mbc3_t{
+		banks_t:     newBanks(rom, ram_size),
+		mmu:         mmu,
+		has_timer:   has_timer,
+		latch_value: 0xFF,
+		rtc_sync:    time.Now(),
+	}
+}
+
+func (m *mbc3_t) WriteROM(addr uint, value uint8) {
+	switch {
+	case addr <= _RAM_ENABLE_END:
+		m.ram_enabled = value&0xF == _RAM_ENABLE_VALUE
+	case addr <= _ROM_BANK_NUMBER_END:
+		m.rom_bank = uint(value) & _MBC3_ROM_BANK_MASK
+		if m.rom_bank == 0 {
+			m.rom_bank = 1
+		}
+	case addr <= _RAM_BANK_NUMBER_END:
+		m.ram_bank = uint(value)
+		if m.rtcSelected() {
+			m.rtc = value - _MBC3_RTC_SELECT
+		}
+	default:
+		// check for latch : 0x0 -> 0x1
+		if m.latch_value == 0x0 && value == 0x1 {
+			m.syncHostClock()
+			copy(m.rtc_registers_latched[:], m.rtc_registers[:])
+		}
+		m.latch_value = value
+	}
+}
+
+func (m *mbc3_t) rtcSelected() bool {
+	return m.has_timer && m.ram_bank >= _MBC3_RTC_SELECT && m.ram_bank < _MBC3_RTC_SELECT+_RTC_REGISTERS_NUM
+}
+
+func (m *mbc3_t) ReadRAM(addr uint) uint8 {
+	if !m.rtcSelected() {
+		return m.banks_t.ReadRAM(addr)
+	}
+	if !m.ram_enabled {
+		return 0xFF
+	}
+	// the registers are only visible once latched
+	return m.rtc_registers_latched[m.rtc]
+}
+
+func (m *mbc3_t) WriteRAM(addr uint, value uint8) {
+	if !m.rtcSelected() {
+		m.banks_t.WriteRAM(addr, value)
+		return
+	}
+	if !m.ram_enabled {
+		return
+	}
+	m.syncHostClock()
+	// writing the seconds resets the sub second counter
+	if m.rtc == _RTC_S {
+		m.rtc_ticks = 0
+		m.rtc_sync = time.Now()
+	}
+	m.rtc_registers[m.rtc] = value & _RTC_MASKS[m.rtc]
+}
+
+func (m *mbc3_t) Tick() {
+	if !m.has_timer || m.mmu.RTC_HOST_CLOCK || m.halted() {
+		return
+	}
+	if m.mmu.ppu.IsDoubleSpeed() {
+		m.rtc_ticks++
+	} else {
+		m.rtc_ticks += 2
+	}
+	if m.rtc_ticks >= _RTC_TICKS_PER_SECOND {
+		m.rtc_ticks -= _RTC_TICKS_PER_SECOND
+		m.advance(1)
+	}
+}
+
+func (m *mbc3_t) halted() bool {
+	return utility.TestBit(uint(m.rtc_registers[_RTC_DH]), _RTC_HALT_BIT)
+}
+
+// moves the clock forward by the seconds elapsed on the host
+func (m *mbc3_t) syncHostClock() {
+	if !m.has_timer || !m.mmu.RTC_HOST_CLOCK {
+		return
+	}
+	elapsed := time.Since(m.rtc_sync) / time.Second
+	if elapsed <= 0 {
+		return
+	}
+	m.rtc_sync = m.rtc_sync.Add(elapsed * time.Second)
+	if !m.halted() {
+		m.advance(uint64(elapsed))
+	}
+}
+
+func (m *mbc3_t) advance(seconds uint64) {
+	r := &m.rtc_registers
+	// the day counter overflows anyway, skip the whole cycles
+	if seconds >= _RTC_MAX_DAYS*_RTC_SECONDS_PER_DAY {
+		seconds %= _RTC_MAX_DAYS * _RTC_SECONDS_PER_DAY
+		r[_RTC_DH] = uint8(utility.SetBit(uint(r[_RTC_DH]), _RTC_DAY_CARRY_BIT))
+	}
+	for ; seconds > 0; seconds-- {
+		// invalid values keep counting until the register wraps around
+		r[_RTC_S] = (r[_RTC_S] + 1) & _RTC_MASKS[_RTC_S]
+		if r[_RTC_S] != 60 {
+			continue
+		}
+		r[_RTC_S] = 0
+		r[_RTC_M] = (r[_RTC_M] + 1) & _RTC_MASKS[_RTC_M]
+		if r[_RTC_M] != 60 {
+			continue
+		}
+		r[_RTC_M] = 0
+		r[_RTC_H] = (r[_RTC_H] + 1) & _RTC_MASKS[_RTC_H]
+		if r[_RTC_H] != 24 {
+			continue
+		}
+		r[_RTC_H] = 0
+		m.advanceDay()
+	}
+}
+
+func (m *mbc3_t) advanceDay() {
+	r := &m.rtc_registers
+	day := uint(r[_RTC_DL]) | uint(r[_RTC_DH]&0x1)<<8
+	day++
+	if day == _RTC_MAX_DAYS {
+		day = 0
+		r[_RTC_DH] = uint8(utility.SetBit(uint(r[_RTC_DH]), _RTC_DAY_CARRY_BIT))
+	}
+	r[_RTC_DL] = uint8(day)
+	r[_RTC_DH] = r[_RTC_DH]&^0x1 | uint8(day>>8)
+}
+
+// the ram followed by the rtc footer
+func (m *mbc3_t) Save() []byte {
+	if !m.has_timer {
+		return m.banks_t.Save()
+	}
+	m.syncHostClock()
+	data := make([]byte, len(m.ram)+_RTC_FOOTER_SIZE)
+	copy(data, m.ram)
+	footer := data[len(m.ram):]
+	for i := 0; i < _RTC_REGISTERS_NUM; i++ {
+		binary.LittleEndian.PutUint32(footer[i*4:], uint32(m.rtc_registers[i]))
+		binary.LittleEndian.PutUint32(footer[(i+_RTC_REGISTERS_NUM)*4:], uint32(m.rtc_registers_latched[i]))
+	}
+	binary.LittleEndian.PutUint64(footer[_RTC_REGISTERS_NUM*8:], uint64(time.Now().Unix()))
+	return data
+}
+
+func (m *mbc3_t) Load(data []byte) {
+	footer_size := len(data) % _RTC_RAM_ALIGN
+	if footer_size != _RTC_FOOTER_SIZE && footer_size != _RTC_FOOTER_SIZE_SHORT {
+		footer_size = 0
+	}
+	m.banks_t.Load(data[:len(data)-footer_size])
+	if !m.has_timer || footer_size == 0 {
+		return
+	}
+
+	footer := data[len(data)-footer_size:]
+	for i := 0; i < _RTC_REGISTERS_NUM; i++ {
+		m.rtc_registers[i] = uint8(binary.LittleEndian.Uint32(footer[i*4:])) & _RTC_MASKS[i]
+		m.rtc_registers_latched[i] = uint8(binary.LittleEndian.Uint32(footer[(i+_RTC_REGISTERS_NUM)*4:])) & _RTC_MASKS[i]
+	}
+	var saved int64
+	if footer_size == _RTC_FOOTER_SIZE {
+		saved = int64(binary.LittleEndian.Uint64(footer[_RTC_REGISTERS_NUM*8:]))
+	} else {
+		saved = int64(binary.LittleEndian.Uint32(footer[_RTC_REGISTERS_NUM*8:]))
+	}
+
+	// the clock kept running while the emulator was closed
+	m.rtc_sync = time.Now()
+	elapsed := m.rtc_sync.Unix() - saved
+	if elapsed > 0 && !m.halted() {
+		m.advance(uint64(elapsed))
+	}
+}
+
+func (m *mbc3_t) SaveState(enc *gob.Encoder) error {
+	if err := m.banks_t.SaveState(enc); err != nil {
+		return err
+	}
+	m.syncHostClock()
+	return utility.EncodeAll(enc, m.rtc, m.rtc_registers, m.rtc_registers_latched, m.latch_value, m.rtc_ticks)
+}
+
+func (m *mbc3_t) LoadState(dec *gob.Decoder) error {
+	if err := m.banks_t.LoadState(dec); err != nil {
+		return err
+	}
+	m.rtc_sync = time.Now()
+	return utility.DecodeAll(dec, &m.rtc, &m.rtc_registers, &m.rtc_registers_latched, &m.latch_value, &m.rtc_ticks)
+}
@@ -0,0 +1,180 @@
+package mmu
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+const _TEST_RAM_SIZE = 8 * 1024
+
+func newTestMBC3() *mbc3_t {
+	return newMBC3(&MMU{}, make([]byte, 0x8000), _TEST_RAM_SIZE, true)
+}
+
+// s, m, h, dl, dh
+type rtc_t = [_RTC_REGISTERS_NUM]uint8
+
+func TestRTCAdvance(t *testing.T) {
+	tests := []struct {
+		name    string
+		start   rtc_t
+		seconds uint64
+		want    rtc_t
+	}{
+		{"second", rtc_t{0, 0, 0, 0, 0}, 1, rtc_t{1, 0, 0, 0, 0}},
+		{"minute", rtc_t{59, 0, 0, 0, 0}, 1, rtc_t{0, 1, 0, 0, 0}},
+		{"hour", rtc_t{59, 59, 0, 0, 0}, 1, rtc_t{0, 0, 1, 0, 0}},
+		{"day", rtc_t{59, 59, 23, 0, 0}, 1, rtc_t{0, 0, 0, 1, 0}},
+		{"day high bit", rtc_t{59, 59, 23, 0xFF, 0}, 1, rtc_t{0, 0, 0, 0, 0x01}},
+		{"day overflow", rtc_t{59, 59, 23, 0xFF, 0x01}, 1, rtc_t{0, 0, 0, 0, 0x80}},
+		{"carry is kept", rtc_t{59, 59, 23, 0, 0x80}, 1, rtc_t{0, 0, 0, 1, 0x80}},
+		{"whole cycles", rtc_t{5, 0, 0, 3, 0}, _RTC_MAX_DAYS * _RTC_SECONDS_PER_DAY, rtc_t{5, 0, 0, 3, 0x80}},
+		// invalid values wrap around without carrying
+		{"invalid seconds", rtc_t{63, 0, 0, 0, 0}, 1, rtc_t{0, 0, 0, 0, 0}},
+		{"invalid hours", rtc_t{59, 59, 31, 0, 0}, 1, rtc_t{0, 0, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestMBC3()
+			m.rtc_registers = test.start
+			m.advance(test.seconds)
+			if m.rtc_registers != test.want {
+				t.Errorf("% X, expected % X", m.rtc_registers, test.want)
+			}
+		})
+	}
+}
+
+// selects a rtc register and enables the ram
+func selectRTC(m *mbc3_t, register uint8) {
+	m.WriteROM(0x0000, _RAM_ENABLE_VALUE)
+	m.WriteROM(0x4000, _MBC3_RTC_SELECT+register)
+}
+
+func latch(m *mbc3_t) {
+	m.WriteROM(0x6000, 0)
+	m.WriteROM(0x6000, 1)
+}
+
+func TestRTCLatch(t *testing.T) {
+	m := newTestMBC3()
+	selectRTC(m, _RTC_M)
+	m.WriteRAM(0xA000, 0xFF)
+	if got := m.ReadRAM(0xA000); got != 0 {
+		t.Fatalf("minutes read %02X before the latch", got)
+	}
+	latch(m)
+	if got := m.ReadRAM(0xA000); got != 0x3F {
+		t.Fatalf("minutes read %02X, expected the unused bits cleared", got)
+	}
+	m.WriteRAM(0xA000, 10)
+	if got := m.ReadRAM(0xA000); got != 0x3F {
+		t.Fatalf("minutes read %02X, the latched value must not change", got)
+	}
+	// 1 -> 1 is not a latch
+	m.WriteROM(0x6000, 1)
+	if got := m.ReadRAM(0xA000); got != 0x3F {
+		t.Fatalf("minutes read %02X after writing 1 twice", got)
+	}
+	latch(m)
+	if got := m.ReadRAM(0xA000); got != 10 {
+		t.Fatalf("minutes read %02X, expected 0A", got)
+	}
+	m.WriteROM(0x0000, 0)
+	if got := m.ReadRAM(0xA000); got != 0xFF {
+		t.Fatalf("minutes read %02X with the ram disabled", got)
+	}
+}
+
+func TestRTCHalt(t *testing.T) {
+	m := newTestMBC3()
+	selectRTC(m, _RTC_DH)
+	m.WriteRAM(0xA000, 1<<_RTC_HALT_BIT)
+	if !m.halted() {
+		t.Fatal("the clock is not halted")
+	}
+	selectRTC(m, _RTC_S)
+	m.WriteRAM(0xA000, 30)
+	m.rtc_ticks = _RTC_TICKS_PER_SECOND - 1
+	m.Tick()
+	if m.rtc_registers[_RTC_S] != 30 {
+		t.Fatalf("seconds %d while halted", m.rtc_registers[_RTC_S])
+	}
+}
+
+// a footer as written by the other emulators
+func footer(size int, live rtc_t, latched rtc_t, saved int64) []byte {
+	data := make([]byte, _TEST_RAM_SIZE+size)
+	data[0] = 0x42
+	f := data[_TEST_RAM_SIZE:]
+	for i := 0; i < _RTC_REGISTERS_NUM; i++ {
+		binary.LittleEndian.PutUint32(f[i*4:], uint32(live[i]))
+		binary.LittleEndian.PutUint32(f[(i+_RTC_REGISTERS_NUM)*4:], uint32(latched[i]))
+	}
+	if size == _RTC_FOOTER_SIZE {
+		binary.LittleEndian.PutUint64(f[_RTC_REGISTERS_NUM*8:], uint64(saved))
+	} else {
+		binary.LittleEndian.PutUint32(f[_RTC_REGISTERS_NUM*8:], uint32(saved))
+	}
+	return data
+}
+
+func TestRTCFooter(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		name    string
+		data    []byte
+		live    rtc_t
+		latched rtc_t
+	}{
+		{"48 bytes", footer(_RTC_FOOTER_SIZE, rtc_t{1, 2, 3, 4, 0x41}, rtc_t{5, 6, 7, 8, 0}, now), rtc_t{1, 2, 3, 4, 0x41}, rtc_t{5, 6, 7, 8, 0}},
+		{"44 bytes", footer(_RTC_FOOTER_SIZE_SHORT, rtc_t{1, 2, 3, 4, 0x41}, rtc_t{5, 6, 7, 8, 0}, now), rtc_t{1, 2, 3, 4, 0x41}, rtc_t{5, 6, 7, 8, 0}},
+		// the clock ran for an hour and a second while closed
+		{"elapsed", footer(_RTC_FOOTER_SIZE, rtc_t{59, 59, 22, 0xFF, 0x01}, rtc_t{}, now-3601), rtc_t{0, 0, 0, 0, 0x80}, rtc_t{}},
+		// halted clocks don't move
+		{"halted", footer(_RTC_FOOTER_SIZE, rtc_t{59, 59, 22, 0, 0x40}, rtc_t{}, now-3601), rtc_t{59, 59, 22, 0, 0x40}, rtc_t{}},
+		{"unused bits", footer(_RTC_FOOTER_SIZE, rtc_t{0xFF, 0xFF, 0xFF, 0xFF, 0x40 | 0x3E}, rtc_t{}, now), rtc_t{0x3F, 0x3F, 0x1F, 0xFF, 0x40}, rtc_t{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestMBC3()
+			m.Load(test.data)
+			if m.ram[0] != 0x42 {
+				t.Errorf("ram not loaded")
+			}
+			if m.rtc_registers != test.live {
+				t.Errorf("registers % X, expected % X", m.rtc_registers, test.live)
+			}
+			if m.rtc_registers_latched != test.latched {
+				t.Errorf("latched % X, expected % X", m.rtc_registers_latched, test.latched)
+			}
+		})
+	}
+}
+
+func TestRTCFooterRoundTrip(t *testing.T) {
+	m := newTestMBC3()
+	m.ram[0x1234] = 0x99
+	// halted, so no time passes between Save and Load
+	m.rtc_registers = rtc_t{12, 34, 5, 0x67, 0x41}
+	m.rtc_registers_latched = rtc_t{1, 2, 3, 4, 0x80}
+	data := m.Save()
+	if len(data) != _TEST_RAM_SIZE+_RTC_FOOTER_SIZE {
+		t.Fatalf("saved %d bytes", len(data))
+	}
+	loaded := newTestMBC3()
+	loaded.Load(data)
+	if loaded.ram[0x1234] != 0x99 {
+		t.Errorf("ram not restored")
+	}
+	if loaded.rtc_registers != m.rtc_registers || loaded.rtc_registers_latched != m.rtc_registers_latched {
+		t.Errorf("registers % X % X, expected % X % X", loaded.rtc_registers, loaded.rtc_registers_latched, m.rtc_registers, m.rtc_registers_latched)
+	}
+
+	// a cartridge without timer saves only the ram
+	plain := newMBC3(&MMU{}, make([]byte, 0x8000), _TEST_RAM_SIZE, false)
+	if len(plain.Save()) != _TEST_RAM_SIZE {
+		t.Errorf("saved %d bytes without timer", len(plain.Save()))
+	}
+}
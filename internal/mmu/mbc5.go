@@ -0,0 +1,78 @@
+package mmu
+
+import (
+	"encoding/gob"
+
+	"github.com/giammirove/gampboy_emulator/internal/utility"
+)
+
+// MBC5 splits the rom bank number in two registers
+const _MBC5_ROM_BANK_LOW_END = 0x2FFF
+
+// on rumble cartbridges bit 3 of the ram bank register drives the motor
+const _MBC5_RUMBLE_BIT = 3
+
+type mbc5_t struct {
+	banks_t
+	mmu        *MMU
+	has_rumble bool
+	rumble     bool
+}
+
+func newMBC5(mmu *MMU, rom []byte, ram_size uint, has_rumble bool) *mbc5_t {
+	return &mbc5_t{banks_t: newBanks(rom, ram_size), mmu: mmu, has_rumble: has_rumble}
+}
+
+func (m *mbc5_t) WriteROM(addr uint, value uint8) {
+	if addr <= _RAM_ENABLE_END {
+		m.ram_enabled = value&0xF == _RAM_ENABLE_VALUE
+		return
+	}
+	// lower 8 bits of the 9-bit rom bank, here bank 0 is allowed
+	if addr <= _MBC5_ROM_BANK_LOW_END {
+		m.rom_bank = m.rom_bank&0x100 | uint(value)
+		return
+	}
+	if addr <= _ROM_BANK_NUMBER_END {
+		m.rom_bank = m.rom_bank&0xFF | uint(value&0x1)<<8
+		return
+	}
+	if addr <= _RAM_BANK_NUMBER_END {
+		if m.has_rumble {
+			m.setRumble(utility.TestBit(uint(value), _MBC5_RUMBLE_BIT))
+			value &= 0x7
+		}
+		m.ram_bank = uint(value & 0xF)
+		return
+	}
+	// 0x6000 - 0x7FFF is not used by MBC5
+}
+
+func (m *mbc5_t) setRumble(active bool) {
+	if m.rumble == active {
+		return
+	}
+	m.rumble = active
+	if m.mmu.RumbleChanged != nil {
+		m.mmu.RumbleChanged(active)
+	}
+}
+
+func (m *mbc5_t) SaveState(enc *gob.Encoder) error {
+	if err := m.banks_t.SaveState(enc); err != nil {
+		return err
+	}
+	return enc.Encode(m.rumble)
+}
+
+func (m *mbc5_t) LoadState(dec *gob.Decoder) error {
+	if err := m.banks_t.LoadState(dec); err != nil {
+		return err
+	}
+	var rumble bool
+	if err := dec.Decode(&rumble); err != nil {
+		return err
+	}
+	m.setRumble(rumble)
+	return nil
+}
@@ -3,6 +3,7 @@ package mmu
 import (
 	"log"
 
+	"github.com/giammirove/gampboy_emulator/internal/headers"
 	"github.com/giammirove/gampboy_emulator/internal/interrupts"
 	"github.com/giammirove/gampboy_emulator/internal/joypad"
 	"github.com/giammirove/gampboy_emulator/internal/ppu"
@@ -38,33 +39,65 @@ const _OAM_END = 0xFE9F
 const _HRAM_START = 0xFF80
 const _HRAM_END = 0xFFFE
 
-var ROM []byte
-var HRAM [_HRAM_END - _HRAM_START + 1]byte
+// MMU maps the address space to the cartridge, the memories and the io registers
+type MMU struct {
+	mbc_t
+
+	headers    *headers.Header
+	interrupts *interrupts.Interrupts
+	joypad     *joypad.Joypad
+	ppu        *ppu.PPU
+	serial     *serial.Serial
+	sound      *sound.APU
+	timer      *timer.Timer
+
+	ROM      []byte
+	HRAM     [_HRAM_END - _HRAM_START + 1]byte
+	rom_path string
+	// mapped over the cartridge until 0xFF50 is written
+	boot        []byte
+	boot_mapped bool
+	// true = the rtc follows the host clock instead of the emulated one
+	RTC_HOST_CLOCK bool
+	// true = the battery ram is neither loaded from nor saved to the disk
+	NO_SAVES bool
+	// called every time the rumble motor is turned on or off
+	RumbleChanged func(active bool)
+	// called with every byte read or written by the cpu, used by the debugger
+	Watch func(addr uint, value uint, write bool)
+}
 
-var rom_path string
+// New creates the mmu connected to the other components
+func New(headers *headers.Header, interrupts *interrupts.Interrupts, joypad *joypad.Joypad, ppu *ppu.PPU, serial *serial.Serial, sound *sound.APU, timer *timer.Timer) *MMU {
+	return &MMU{headers: headers, interrupts: interrupts, joypad: joypad, ppu: ppu, serial: serial, sound: sound, timer: timer}
+}
 
-func InitMMU(rom []byte, path string) {
-	ROM = rom
-	rom_path = path
+func (m *MMU) InitMMU(rom []byte, path string) error {
+	m.ROM = rom
+	m.rom_path = path
+	m.boot_mapped = m.boot != nil
 
-	InitMBC()
+	return m.InitMBC()
+}
 
+func (m *MMU) GetRomPath() string {
+	return m.rom_path
 }
 
-func readFromHighRAM(addr uint) byte {
+func (m *MMU) readFromHighRAM(addr uint) byte {
 	if addr < _HRAM_START || addr > _HRAM_END {
 		log.Fatal("Address not in HRAM boundary (Read)")
 	}
-	return HRAM[addr-_HRAM_START]
+	return m.HRAM[addr-_HRAM_START]
 }
-func writeToHighRAM(addr uint, value byte) {
+func (m *MMU) writeToHighRAM(addr uint, value byte) {
 	if addr < _HRAM_START || addr > _HRAM_END {
 		log.Fatal("Address not in HRAM boundary (Write)")
 	}
-	HRAM[addr-_HRAM_START] = value
+	m.HRAM[addr-_HRAM_START] = value
 }
 
-func readByteMemory(addr uint) byte {
+func (m *MMU) readByteMemory(addr uint) byte {
 	switch addr & 0xF000 {
 	case 0x0000:
 		fallthrough
@@ -73,7 +106,7 @@ func readByteMemory(addr uint) byte {
 	case 0x2000:
 		fallthrough
 	case 0x3000:
-		return ReadFromRomMemory(addr)
+		return m.ReadFromRomMemory(addr)
 	case 0x4000:
 		fallthrough
 	case 0x5000:
@@ -81,68 +114,68 @@ func readByteMemory(addr uint) byte {
 	case 0x6000:
 		fallthrough
 	case 0x7000:
-		return ReadFromRomMemory(addr)
+		return m.ReadFromRomMemory(addr)
 	case 0x8000:
 		fallthrough
 	case 0x9000:
-		return ppu.ReadFromVRAMMemory(addr)
+		return m.ppu.ReadFromVRAMMemory(addr)
 	case 0xA000:
 		fallthrough
 	case 0xB000:
-		return ReadFromRamMemory(addr)
+		return m.ReadFromRamMemory(addr)
 	case 0xC000:
 		fallthrough
 	case 0xD000:
-		return ReadFromRamMemory(addr)
+		return m.ReadFromRamMemory(addr)
 	}
 
 	if interrupts.IsInterruptAddr(addr) {
-		return byte(interrupts.ReadFromMemory(addr))
+		return byte(m.interrupts.ReadFromMemory(addr))
 	} else if addr <= _ECHORAM_END {
-		return ReadFromRamMemory(addr - (_ECHORAM_START - _RAM_START))
+		return m.ReadFromRamMemory(addr - (_ECHORAM_START - _RAM_START))
 	} else if addr <= _OAM_END {
 		// TODO: re-add
 		// if ppu.GetDMATransferring() {
 		// 	return 0xFF
 		// }
-		return ppu.ReadFromOAMMemory(addr)
+		return m.ppu.ReadFromOAMMemory(addr)
 	} else if addr <= 0xFEFF {
 		log.Printf("Use of this area is prohibited %04X\n", addr)
 		return 0xFF
 	} else if addr <= 0xFF7F {
 		if joypad.IsJoypadAddr(addr) {
-			return byte(joypad.ReadFromMemory(addr))
+			return byte(m.joypad.ReadFromMemory(addr))
 		}
 		if serial.IsSerialAddr(addr) {
-			return byte(serial.ReadFromMemory(addr))
+			return byte(m.serial.ReadFromMemory(addr))
 		}
 		if interrupts.IsInterruptAddr(addr) {
-			return byte(interrupts.ReadFromMemory(addr))
+			return byte(m.interrupts.ReadFromMemory(addr))
 		}
 		if timer.IsTimerAddr(addr) {
-			return byte(timer.ReadFromMemory(addr))
+			return byte(m.timer.ReadFromMemory(addr))
 		}
 		if ppu.IsLCDAddr(addr) {
-			return byte(ppu.ReadFromLCDMemory(addr))
+			return byte(m.ppu.ReadFromLCDMemory(addr))
 		}
 		if sound.IsSoundAddr(addr) {
-			return byte(sound.ReadFromMemory(addr))
+			return byte(m.sound.ReadFromMemory(addr))
 		}
 		// log.Printf("I/O not handled (Read) (0x%02X)", addr)
 		return 0xFF
 	} else if addr <= _HRAM_END {
-		return readFromHighRAM(addr)
+		return m.readFromHighRAM(addr)
 	}
 
 	log.Fatalf("Invalid address (Read) (0x%08X)", addr)
 	return 0xFF
 }
 
-func readWordMemory(addr uint) uint16 {
-	return uint16(readByteMemory(addr)) + uint16(readByteMemory(addr+1))<<_BYTE_SIZE
+func (m *MMU) readWordMemory(addr uint) uint16 {
+	return uint16(m.readByteMemory(addr)) + uint16(m.readByteMemory(addr+1))<<_BYTE_SIZE
 }
 
-func ReadFromMemory(addr uint, bytes ...uint) uint {
+func (m *MMU) ReadFromMemory(addr uint, bytes ...uint) uint {
 	if len(bytes) > 1 {
 		log.Fatal("Too many arguments")
 	}
@@ -152,16 +185,16 @@ func ReadFromMemory(addr uint, bytes ...uint) uint {
 			log.Fatal("Too many bytes to read")
 		}
 		if bytes[0] == 1 {
-			return uint(readByteMemory(addr))
+			return uint(m.readByteMemory(addr))
 		} else {
-			return uint(readWordMemory(addr))
+			return uint(m.readWordMemory(addr))
 		}
 	}
 
-	return uint(readByteMemory(addr))
+	return uint(m.readByteMemory(addr))
 }
 
-func readByteMemoryCPU(addr uint) byte {
+func (m *MMU) readByteMemoryCPU(addr uint) byte {
 	if addr > 0xFFFF {
 		return 0x00
 	}
@@ -178,7 +211,7 @@ func readByteMemoryCPU(addr uint) byte {
 	case 0x2000:
 		fallthrough
 	case 0x3000:
-		return ReadFromRomMemory(addr)
+		return m.ReadFromRomMemory(addr)
 	case 0x4000:
 		fallthrough
 	case 0x5000:
@@ -186,90 +219,95 @@ func readByteMemoryCPU(addr uint) byte {
 	case 0x6000:
 		fallthrough
 	case 0x7000:
-		return ReadFromRomMemory(addr)
+		return m.ReadFromRomMemory(addr)
 	case 0x8000:
 		fallthrough
 	case 0x9000:
-		if !ppu.CanAccessVRAM() || ppu.GetDMATransferring() {
+		if !m.ppu.CanAccessVRAM() || m.ppu.GetDMATransferring() {
 			return 0xFF
 		}
-		return ppu.ReadFromVRAMMemory(addr)
+		return m.ppu.ReadFromVRAMMemory(addr)
 	case 0xA000:
 		fallthrough
 	case 0xB000:
-		return ReadFromRamMemory(addr)
+		return m.ReadFromRamMemory(addr)
 	case 0xC000:
 		fallthrough
 	case 0xD000:
-		return ReadFromRamMemory(addr)
+		return m.ReadFromRamMemory(addr)
 	}
 
 	if interrupts.IsInterruptAddr(addr) {
-		return byte(interrupts.ReadFromMemory(addr))
+		return byte(m.interrupts.ReadFromMemory(addr))
 	} else if addr <= _ECHORAM_END {
-		return ReadFromRamMemory(addr - (_ECHORAM_START - _RAM_START))
+		return m.ReadFromRamMemory(addr - (_ECHORAM_START - _RAM_START))
 	} else if addr <= _OAM_END {
 		// TODO: re-add
-		if !ppu.CanAccessOAM() || ppu.GetDMATransferring() {
+		if !m.ppu.CanAccessOAM() || m.ppu.GetDMATransferring() {
 			return 0xFF
 		}
-		return ppu.ReadFromOAMMemory(addr)
+		return m.ppu.ReadFromOAMMemory(addr)
 	} else if addr <= 0xFEFF {
 		log.Printf("Use of this area is prohibited %04X\n", addr)
 		return 0xFF
 	} else if addr <= 0xFF7F {
 		if joypad.IsJoypadAddr(addr) {
-			return byte(joypad.ReadFromMemory(addr))
+			return byte(m.joypad.ReadFromMemory(addr))
 		}
 		if serial.IsSerialAddr(addr) {
-			return byte(serial.ReadFromMemory(addr))
+			return byte(m.serial.ReadFromMemory(addr))
 		}
 		if interrupts.IsInterruptAddr(addr) {
-			return byte(interrupts.ReadFromMemory(addr))
+			return byte(m.interrupts.ReadFromMemory(addr))
 		}
 		if timer.IsTimerAddr(addr) {
-			return byte(timer.ReadFromMemory(addr))
+			return byte(m.timer.ReadFromMemory(addr))
 		}
 		if ppu.IsLCDAddr(addr) {
-			return byte(ppu.ReadFromLCDMemory(addr))
+			return byte(m.ppu.ReadFromLCDMemory(addr))
 		}
 		if sound.IsSoundAddr(addr) {
-			return byte(sound.ReadFromMemory(addr))
+			return byte(m.sound.ReadFromMemory(addr))
 		}
 		// log.Printf("I/O not handled (Read) (0x%02X)", addr)
 		return 0xFF
 	} else if addr <= _HRAM_END {
-		return readFromHighRAM(addr)
+		return m.readFromHighRAM(addr)
 	}
 
 	log.Fatalf("Invalid address (Read) (0x%08X)", addr)
 	return 0xFF
 }
 
-func readWordMemoryCPU(addr uint) uint16 {
-	return uint16(readByteMemoryCPU(addr)) + uint16(readByteMemoryCPU(addr+1))<<_BYTE_SIZE
+func (m *MMU) readWordMemoryCPU(addr uint) uint16 {
+	return uint16(m.readByteMemoryCPU(addr)) + uint16(m.readByteMemoryCPU(addr+1))<<_BYTE_SIZE
 }
 
-func ReadFromMemoryCPU(addr uint, bytes ...uint) uint {
+func (m *MMU) ReadFromMemoryCPU(addr uint, bytes ...uint) uint {
 	if len(bytes) > 1 {
 		log.Fatal("Too many arguments")
 	}
 
+	var value uint
 	if len(bytes) == 1 {
 		if bytes[0] > 2 {
 			log.Fatal("Too many bytes to read")
 		}
 		if bytes[0] == 1 {
-			return uint(readByteMemoryCPU(addr))
+			value = uint(m.readByteMemoryCPU(addr))
 		} else {
-			return uint(readWordMemoryCPU(addr))
+			value = uint(m.readWordMemoryCPU(addr))
 		}
+	} else {
+		value = uint(m.readByteMemoryCPU(addr))
 	}
-
-	return uint(readByteMemoryCPU(addr))
+	if m.Watch != nil {
+		m.watch(addr, value, bytes, false)
+	}
+	return value
 }
 
-func writeByteMemory(addr uint, value byte) {
+func (m *MMU) writeByteMemory(addr uint, value byte) {
 	if addr > 0xFFFF {
 		return
 	}
@@ -281,7 +319,7 @@ func writeByteMemory(addr uint, value byte) {
 	case 0x2000:
 		fallthrough
 	case 0x3000:
-		WriteToRomMemory(addr, value)
+		m.WriteToRomMemory(addr, value)
 		return
 	case 0x4000:
 		fallthrough
@@ -290,87 +328,95 @@ func writeByteMemory(addr uint, value byte) {
 	case 0x6000:
 		fallthrough
 	case 0x7000:
-		WriteToRomMemory(addr, value)
+		m.WriteToRomMemory(addr, value)
 		return
 	case 0x8000:
 		fallthrough
 	case 0x9000:
-		if !ppu.CanAccessVRAM() {
+		if !m.ppu.CanAccessVRAM() {
 			return
 		}
-		ppu.WriteToVRAMMemory(addr, value)
+		m.ppu.WriteToVRAMMemory(addr, value)
 		return
 	case 0xA000:
 		fallthrough
 	case 0xB000:
-		WriteToRamMemory(addr, value)
+		m.WriteToRamMemory(addr, value)
 		return
 	case 0xC000:
 		fallthrough
 	case 0xD000:
-		WriteToRamMemory(addr, value)
+		m.WriteToRamMemory(addr, value)
 		return
 	}
 
 	if interrupts.IsInterruptAddr(addr) {
-		interrupts.WriteToMemory(addr, uint(value))
+		m.interrupts.WriteToMemory(addr, uint(value))
 		return
 	} else if addr <= _ECHORAM_END {
 		// writeToEchoRAM(addr, value)
-		WriteToRamMemory(addr-(_ECHORAM_START-_RAM_START), value)
+		m.WriteToRamMemory(addr-(_ECHORAM_START-_RAM_START), value)
 		return
 	} else if addr <= _OAM_END {
 		// TODO: re-add
 		// if ppu.GetDMATransferring() {
 		// 	return
 		// }
-		if !ppu.CanAccessOAM() {
+		if !m.ppu.CanAccessOAM() {
 			return
 		}
-		ppu.WriteToOAMMemory(addr, value)
+		m.ppu.WriteToOAMMemory(addr, value)
 		return
 	} else if addr <= 0xFEFF {
 		log.Printf("Use of this area is prohibited %04X\n", addr)
 		return
 	} else if addr <= 0xFF7F {
+		if addr == _BOOT {
+			m.writeBoot(value)
+			return
+		}
+		if addr == _KEY0 {
+			m.writeKey0(value)
+			return
+		}
 		if joypad.IsJoypadAddr(addr) {
-			joypad.WriteToMemory(addr, uint(value))
+			m.joypad.WriteToMemory(addr, uint(value))
 			return
 		}
 		if serial.IsSerialAddr(addr) {
-			serial.WriteToMemory(addr, uint(value))
+			m.serial.WriteToMemory(addr, uint(value))
 			return
 		}
 		if timer.IsTimerAddr(addr) {
-			timer.WriteToMemory(addr, uint(value))
+			m.timer.WriteToMemory(addr, uint(value))
 			return
 		}
 		if ppu.IsLCDAddr(addr) {
-			ppu.WriteToLCDMemory(addr, uint(value))
+			m.ppu.WriteToLCDMemory(addr, uint(value))
 			return
 		}
 		if sound.IsSoundAddr(addr) {
-			sound.WriteToMemory(addr, uint(value))
+			m.sound.WriteToMemory(addr, uint(value))
 			return
 		}
 		// log.Printf("I/O not handled (0x%02X)", addr)
 		return
 	} else if addr <= _HRAM_END {
-		writeToHighRAM(addr, value)
+		m.writeToHighRAM(addr, value)
 		return
 	} else if interrupts.IsInterruptAddr(addr) {
-		interrupts.WriteToMemory(addr, uint(value))
+		m.interrupts.WriteToMemory(addr, uint(value))
 		return
 	}
 
 	log.Fatalf("Invalid address (Write) (0x%08X)", addr)
 }
-func writeWordMemory(addr uint, bytes []byte) {
-	writeByteMemory(addr, bytes[0])
-	writeByteMemory(addr+1, bytes[1])
+func (m *MMU) writeWordMemory(addr uint, bytes []byte) {
+	m.writeByteMemory(addr, bytes[0])
+	m.writeByteMemory(addr+1, bytes[1])
 }
 
-func WriteToMemory(addr uint, value uint, bytes ...uint) {
+func (m *MMU) WriteToMemory(addr uint, value uint, bytes ...uint) {
 	if len(bytes) > 1 {
 		log.Fatal("Too many arguments")
 	}
@@ -381,17 +427,17 @@ func WriteToMemory(addr uint, value uint, bytes ...uint) {
 		}
 		if bytes[0] == 2 {
 			hi, low := utility.GetHiLow(uint16(value))
-			writeWordMemory(addr, []byte{low, hi})
+			m.writeWordMemory(addr, []byte{low, hi})
 		} else {
-			writeByteMemory(addr, byte(value))
+			m.writeByteMemory(addr, byte(value))
 		}
 	} else {
-		writeByteMemory(addr, byte(value))
+		m.writeByteMemory(addr, byte(value))
 	}
 
 }
 
-func writeByteMemoryCPU(addr uint, value byte) {
+func (m *MMU) writeByteMemoryCPU(addr uint, value byte) {
 	switch addr & 0xF000 {
 	case 0x0:
 		fallthrough
@@ -400,7 +446,7 @@ func writeByteMemoryCPU(addr uint, value byte) {
 	case 0x2000:
 		fallthrough
 	case 0x3000:
-		WriteToRomMemory(addr, value)
+		m.WriteToRomMemory(addr, value)
 		return
 	case 0x4000:
 		fallthrough
@@ -409,87 +455,98 @@ func writeByteMemoryCPU(addr uint, value byte) {
 	case 0x6000:
 		fallthrough
 	case 0x7000:
-		WriteToRomMemory(addr, value)
+		m.WriteToRomMemory(addr, value)
 		return
 	case 0x8000:
 		fallthrough
 	case 0x9000:
-		if !ppu.CanAccessVRAM() || ppu.GetDMATransferring() {
+		if !m.ppu.CanAccessVRAM() || m.ppu.GetDMATransferring() {
 			return
 		}
-		ppu.WriteToVRAMMemory(addr, value)
+		m.ppu.WriteToVRAMMemory(addr, value)
 		return
 	case 0xA000:
 		fallthrough
 	case 0xB000:
-		WriteToRamMemory(addr, value)
+		m.WriteToRamMemory(addr, value)
 		return
 	case 0xC000:
 		fallthrough
 	case 0xD000:
-		WriteToRamMemory(addr, value)
+		m.WriteToRamMemory(addr, value)
 		return
 	}
 
 	if interrupts.IsInterruptAddr(addr) {
-		interrupts.WriteToMemory(addr, uint(value))
+		m.interrupts.WriteToMemory(addr, uint(value))
 		return
 	} else if addr <= _ECHORAM_END {
 		// writeToEchoRAM(addr, value)
-		WriteToRamMemory(addr-(_ECHORAM_START-_RAM_START), value)
+		m.WriteToRamMemory(addr-(_ECHORAM_START-_RAM_START), value)
 		return
 	} else if addr <= _OAM_END {
 		// TODO: re-add
-		if !ppu.CanAccessOAM() || ppu.GetDMATransferring() {
+		if !m.ppu.CanAccessOAM() || m.ppu.GetDMATransferring() {
 			return
 		}
-		ppu.WriteToOAMMemory(addr, value)
+		m.ppu.WriteToOAMMemory(addr, value)
 		return
 	} else if addr <= 0xFEFF {
 		log.Printf("Use of this area is prohibited %04X\n", addr)
 		return
 	} else if addr <= 0xFF7F {
+		if addr == _BOOT {
+			m.writeBoot(value)
+			return
+		}
+		if addr == _KEY0 {
+			m.writeKey0(value)
+			return
+		}
 		if joypad.IsJoypadAddr(addr) {
-			joypad.WriteToMemory(addr, uint(value))
+			m.joypad.WriteToMemory(addr, uint(value))
 			return
 		}
 		if serial.IsSerialAddr(addr) {
-			serial.WriteToMemory(addr, uint(value))
+			m.serial.WriteToMemory(addr, uint(value))
 			return
 		}
 		if timer.IsTimerAddr(addr) {
-			timer.WriteToMemory(addr, uint(value))
+			m.timer.WriteToMemory(addr, uint(value))
 			return
 		}
 		if ppu.IsLCDAddr(addr) {
-			ppu.WriteToLCDMemory(addr, uint(value))
+			m.ppu.WriteToLCDMemory(addr, uint(value))
 			return
 		}
 		if sound.IsSoundAddr(addr) {
-			sound.WriteToMemory(addr, uint(value))
+			m.sound.WriteToMemory(addr, uint(value))
 			return
 		}
 		// log.Printf("I/O not handled (0x%02X)", addr)
 		return
 	} else if addr <= _HRAM_END {
-		writeToHighRAM(addr, value)
+		m.writeToHighRAM(addr, value)
 		return
 	} else if interrupts.IsInterruptAddr(addr) {
-		interrupts.WriteToMemory(addr, uint(value))
+		m.interrupts.WriteToMemory(addr, uint(value))
 		return
 	}
 
 	log.Fatalf("Invalid address (Write) (0x%08X)", addr)
 }
-func writeWordMemoryCPU(addr uint, bytes []byte) {
-	writeByteMemoryCPU(addr, bytes[0])
-	writeByteMemoryCPU(addr+1, bytes[1])
+func (m *MMU) writeWordMemoryCPU(addr uint, bytes []byte) {
+	m.writeByteMemoryCPU(addr, bytes[0])
+	m.writeByteMemoryCPU(addr+1, bytes[1])
 }
 
-func WriteToMemoryCPU(addr uint, value uint, bytes ...uint) {
+func (m *MMU) WriteToMemoryCPU(addr uint, value uint, bytes ...uint) {
 	if len(bytes) > 1 {
 		log.Fatal("Too many arguments")
 	}
+	if m.Watch != nil {
+		m.watch(addr, value, bytes, true)
+	}
 
 	if len(bytes) == 1 {
 		if bytes[0] > 2 {
@@ -497,12 +554,23 @@ func WriteToMemoryCPU(addr uint, value uint, bytes ...uint) {
 		}
 		if bytes[0] == 2 {
 			hi, low := utility.GetHiLow(uint16(value))
-			writeWordMemoryCPU(addr, []byte{low, hi})
+			m.writeWordMemoryCPU(addr, []byte{low, hi})
 		} else {
-			writeByteMemoryCPU(addr, byte(value))
+			m.writeByteMemoryCPU(addr, byte(value))
 		}
 	} else {
-		writeByteMemoryCPU(addr, byte(value))
+		m.writeByteMemoryCPU(addr, byte(value))
 	}
 
 }
+
+// reports every byte of a cpu access to Watch
+func (m *MMU) watch(addr uint, value uint, bytes []uint, write bool) {
+	n := uint(1)
+	if len(bytes) == 1 {
+		n = bytes[0]
+	}
+	for i := uint(0); i < n; i++ {
+		m.Watch((addr+i)&0xFFFF, value>>(_BYTE_SIZE*i)&0xFF, write)
+	}
+}
@@ -0,0 +1,15 @@
+package mmu
+
+// 32 KiB of rom without a memory bank controller,
+// the optional ram is always accessible
+type rom_only_t struct {
+	banks_t
+}
+
+func newRomOnly(rom []byte, ram_size uint) *rom_only_t {
+	m := &rom_only_t{banks_t: newBanks(rom, ram_size)}
+	m.ram_enabled = true
+	return m
+}
+
+func (m *rom_only_t) WriteROM(addr uint, value uint8) {}
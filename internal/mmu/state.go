@@ -0,0 +1,35 @@
+package mmu
+
+import (
+	"encoding/gob"
+
+	"github.com/giammirove/gampboy_emulator/internal/utility"
+)
+
+func (m *MMU) SaveState(enc *gob.Encoder) error {
+	// only the part of the cgb banks that is actually addressed
+	var wram_cgb [len(m.WRAM_CGB)][]byte
+	for i := range m.WRAM_CGB {
+		wram_cgb[i] = m.WRAM_CGB[i][_RAM_CGB_START : _RAM_END+1]
+	}
+	if err := utility.EncodeAll(enc, m.WRAM, wram_cgb, m.HRAM, m.boot_mapped); err != nil {
+		return err
+	}
+	return m.cart.SaveState(enc)
+}
+
+func (m *MMU) LoadState(dec *gob.Decoder) error {
+	var wram_cgb [len(m.WRAM_CGB)][]byte
+	if err := utility.DecodeAll(dec, &m.WRAM, &wram_cgb, &m.HRAM, &m.boot_mapped); err != nil {
+		return err
+	}
+	for i := range m.WRAM_CGB {
+		copy(m.WRAM_CGB[i][_RAM_CGB_START:_RAM_END+1], wram_cgb[i])
+	}
+	if err := m.cart.LoadState(dec); err != nil {
+		return err
+	}
+	m.save_needed = true
+	m.UpdateCGBMode()
+	return nil
+}
@@ -0,0 +1,140 @@
+// Package movie records the buttons held in every frame, to play them back
+// exactly as they were. A movie starts from power on or from a save state
+// embedded in it, and the hash of every frame tells if the playback differs
+package movie
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+
+	"github.com/giammirove/gampboy_emulator/gampboy"
+)
+
+var _MAGIC = [4]byte{'G', 'B', 'M', 'V'}
+
+// has to be incremented every time the content of a movie changes
+const VERSION = 2
+
+var ErrVersion = errors.New("movie version not supported")
+var ErrFormat = errors.New("not a movie")
+var ErrROM = errors.New("movie belongs to another ROM")
+var ErrModel = errors.New("movie recorded on another model")
+var ErrBootROM = errors.New("movie recorded with another boot rom")
+var ErrDesync = errors.New("frame differs from the movie")
+
+type header_t struct {
+	Magic    [4]byte
+	Version  uint32
+	Checksum uint16
+}
+
+// Movie is the input of every frame since the anchor
+type Movie struct {
+	Checksum uint16
+	Title    string
+	Model    string
+	// hash of the boot rom, 0 = started without it
+	BootROM uint64
+	// save state the movie starts from, empty = power on
+	State []byte
+	// buttons held during every frame and hash of the frame drawn
+	Buttons []gampboy.Button
+	Hashes  []uint64
+}
+
+// Write writes the movie to w
+func (m *Movie) Write(w io.Writer) error {
+	header := header_t{Magic: _MAGIC, Version: VERSION, Checksum: m.Checksum}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	enc := gob.NewEncoder(w)
+	for _, v := range []interface{}{m.Title, m.Model, m.BootROM, m.State, m.Buttons, m.Hashes} {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read reads a movie written by Write
+func Read(r io.Reader) (*Movie, error) {
+	var header header_t
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != _MAGIC {
+		return nil, ErrFormat
+	}
+	if header.Version != VERSION {
+		return nil, fmt.Errorf("%w (%d)", ErrVersion, header.Version)
+	}
+	m := &Movie{Checksum: header.Checksum}
+	dec := gob.NewDecoder(r)
+	for _, v := range []interface{}{&m.Title, &m.Model, &m.BootROM, &m.State, &m.Buttons, &m.Hashes} {
+		if err := dec.Decode(v); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Load reads the movie at path
+func Load(path string) (*Movie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(bufio.NewReader(file))
+}
+
+// Save writes the movie to path
+func (m *Movie) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	err = m.Write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Len is the number of frames
+func (m *Movie) Len() int {
+	return len(m.Buttons)
+}
+
+// BootHash is the FNV-1a hash of the boot rom of the machine, 0 without it
+func BootHash(gb *gampboy.GameBoy) uint64 {
+	boot := gb.BootROM()
+	if boot == nil {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write(boot)
+	return h.Sum64()
+}
+
+// Hash is the FNV-1a hash of the last frame drawn
+func Hash(gb *gampboy.GameBoy) uint64 {
+	h := fnv.New64a()
+	var pixel [4]byte
+	for _, color := range gb.Framebuffer() {
+		binary.LittleEndian.PutUint32(pixel[:], color)
+		h.Write(pixel[:])
+	}
+	return h.Sum64()
+}
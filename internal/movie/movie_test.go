@@ -0,0 +1,108 @@
+package movie
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/giammirove/gampboy_emulator/gampboy"
+	"github.com/giammirove/gampboy_emulator/internal/testutil"
+)
+
+// a cartridge that turns the lcd on and keeps writing the joypad
+// to the background palette, so the buttons change the frames
+func joypadROM(checksum uint16) []byte {
+	// LD A,$91 ; LDH ($40),A ; LD A,$10 ; LDH ($00),A
+	// loop: LDH A,($00) ; LDH ($47),A ; JR loop
+	rom := testutil.ROM([]byte{0x3E, 0x91, 0xE0, 0x40, 0x3E, 0x10, 0xE0, 0x00, 0xF0, 0x00, 0xE0, 0x47, 0x18, 0xFA})
+	// the global checksum is not checked, it tells the roms apart
+	rom[0x14E] = byte(checksum >> 8)
+	rom[0x14F] = byte(checksum)
+	return rom
+}
+
+func newMachine(t *testing.T, rom []byte, boot []byte) *gampboy.GameBoy {
+	gb, err := gampboy.New(rom, gampboy.Options{NoSaves: true, BootROM: boot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(gb.Close)
+	return gb
+}
+
+// drives the machine as the front ends do
+func run(gb *gampboy.GameBoy, input func(gampboy.Button) gampboy.Button, drawn func() error, buttons []gampboy.Button) error {
+	for _, b := range buttons {
+		gb.SetButtons(input(b))
+		gb.RunFrame()
+		if err := drawn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func record(t *testing.T, gb *gampboy.GameBoy) *Movie {
+	r, err := NewRecorder(gb, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buttons []gampboy.Button
+	for i := 0; i < 40; i++ {
+		buttons = append(buttons, gampboy.Button(i/5)&(gampboy.ButtonA|gampboy.ButtonB|gampboy.ButtonStart))
+	}
+	if err := run(gb, r.Input, r.FrameDrawn, buttons); err != nil {
+		t.Fatal(err)
+	}
+	// through the file format
+	var file bytes.Buffer
+	if err := r.Movie().Write(&file); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Read(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func play(gb *gampboy.GameBoy, m *Movie) error {
+	p, err := NewPlayer(gb, m)
+	if err != nil {
+		return err
+	}
+	return run(gb, p.Input, p.FrameDrawn, make([]gampboy.Button, m.Len()))
+}
+
+func TestPlayback(t *testing.T) {
+	m := record(t, newMachine(t, joypadROM(0x1234), nil))
+	if m.Len() != 40 || len(m.Hashes) != 40 {
+		t.Fatalf("%d frames and %d hashes recorded", m.Len(), len(m.Hashes))
+	}
+	if err := play(newMachine(t, joypadROM(0x1234), nil), m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDesync(t *testing.T) {
+	m := record(t, newMachine(t, joypadROM(0x1234), nil))
+	m.Buttons[20] ^= gampboy.ButtonB
+	if err := play(newMachine(t, joypadROM(0x1234), nil), m); !errors.Is(err, ErrDesync) {
+		t.Fatalf("changed buttons played with %v", err)
+	}
+}
+
+func TestRefused(t *testing.T) {
+	m := record(t, newMachine(t, joypadROM(0x1234), nil))
+	if err := play(newMachine(t, joypadROM(0x4321), nil), m); !errors.Is(err, ErrROM) {
+		t.Fatalf("another rom played with %v", err)
+	}
+	boot := make([]byte, 0x100)
+	if err := play(newMachine(t, joypadROM(0x1234), boot), m); !errors.Is(err, ErrBootROM) {
+		t.Fatalf("a boot rom played with %v", err)
+	}
+	m = record(t, newMachine(t, joypadROM(0x1234), boot))
+	if err := play(newMachine(t, joypadROM(0x1234), nil), m); !errors.Is(err, ErrBootROM) {
+		t.Fatalf("no boot rom played with %v", err)
+	}
+}
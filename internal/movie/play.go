@@ -0,0 +1,107 @@
+package movie
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/giammirove/gampboy_emulator/gampboy"
+)
+
+// Recorder appends the frames of the machine to a movie. Input is called
+// before every frame and FrameDrawn after it
+type Recorder struct {
+	gb    *gampboy.GameBoy
+	movie *Movie
+}
+
+// NewRecorder starts a movie from power on, the machine must have just
+// been created, or from the current state of the machine
+func NewRecorder(gb *gampboy.GameBoy, power_on bool) (*Recorder, error) {
+	m := &Movie{Checksum: gb.Checksum(), Title: gb.Title(), Model: gb.Model(), BootROM: BootHash(gb)}
+	if !power_on {
+		var state bytes.Buffer
+		if err := gb.SaveState(&state); err != nil {
+			return nil, err
+		}
+		m.State = state.Bytes()
+	}
+	return &Recorder{gb: gb, movie: m}, nil
+}
+
+// Input records the buttons of the next frame
+func (r *Recorder) Input(buttons gampboy.Button) gampboy.Button {
+	r.movie.Buttons = append(r.movie.Buttons, buttons)
+	return buttons
+}
+
+// FrameDrawn records the hash of the frame
+func (r *Recorder) FrameDrawn() error {
+	r.movie.Hashes = append(r.movie.Hashes, Hash(r.gb))
+	return nil
+}
+
+// Movie is what has been recorded so far
+func (r *Recorder) Movie() *Movie {
+	return r.movie
+}
+
+// Player replaces the buttons with the ones of a movie, until its end.
+// Input is called before every frame and FrameDrawn after it
+type Player struct {
+	gb    *gampboy.GameBoy
+	movie *Movie
+	frame int
+}
+
+// NewPlayer checks that the movie belongs to the machine and restores its
+// save state. Without a save state the machine must have just been created
+func NewPlayer(gb *gampboy.GameBoy, m *Movie) (*Player, error) {
+	if m.Checksum != gb.Checksum() {
+		return nil, fmt.Errorf("%w (%s)", ErrROM, m.Title)
+	}
+	if m.Model != gb.Model() {
+		return nil, fmt.Errorf("%w (%s)", ErrModel, m.Model)
+	}
+	if m.BootROM != BootHash(gb) {
+		return nil, ErrBootROM
+	}
+	if len(m.State) > 0 {
+		if err := gb.LoadState(bytes.NewReader(m.State)); err != nil {
+			return nil, err
+		}
+	}
+	return &Player{gb: gb, movie: m}, nil
+}
+
+// Input is the buttons of the movie, the ones given after its end
+func (p *Player) Input(buttons gampboy.Button) gampboy.Button {
+	if p.Done() {
+		return buttons
+	}
+	return p.movie.Buttons[p.frame]
+}
+
+// FrameDrawn compares the frame with the one recorded
+func (p *Player) FrameDrawn() error {
+	if p.Done() {
+		return nil
+	}
+	p.frame++
+	if p.frame > len(p.movie.Hashes) {
+		return nil
+	}
+	if Hash(p.gb) != p.movie.Hashes[p.frame-1] {
+		return fmt.Errorf("%w (frame %d)", ErrDesync, p.frame-1)
+	}
+	return nil
+}
+
+// Done tells if every frame has been played
+func (p *Player) Done() bool {
+	return p.frame >= p.movie.Len()
+}
+
+// Frame is the number of frames played
+func (p *Player) Frame() int {
+	return p.frame
+}
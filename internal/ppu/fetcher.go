@@ -3,7 +3,6 @@ package ppu
 import (
 	"log"
 
-	"github.com/giammirove/gampboy_emulator/internal/headers"
 	"github.com/giammirove/gampboy_emulator/internal/utility"
 )
 
@@ -48,225 +47,215 @@ type sprite_t struct {
 	cgb_palette     uint
 }
 
-var buffer [_LCD_WIDTH][_LCD_HEIGHT]uint32
-
-// incremented at the last step of fetcher
-var fetcher_x uint8
-
-var tile_id uint8
-var tile_addr uint
-var bg_bank uint
-var bg_tilemap uint
-var window_tilemap uint
-var tiledata_base uint
-
-var map_x uint8
-var map_y uint8
-var win_x uint8
-var win_y uint8
-var tile_x uint8
-var tile_y uint8
-var line_x uint8
-
-// higher pixel x that has been rendered
-var buffered_x uint8
-
-// higher pixel x that has been pushed to fifo
-var fifo_x uint8
-
-var bg_pixels [_PIXELS_LEN]uint
-
-var fifo_array [_LCD_WIDTH * _LCD_HEIGHT]uint32
-var fifo_len uint
-var fifo_front uint
-var fifo_back uint
-
-var sprite_pixels [_SPRITES_PER_PIXEL][_PIXELS_LEN]uint
-
-var sprite_tiles []sprite_t
-
-var sprites_on_line [_SPRITES_PER_LINE]uint
-var sprites_on_line_len uint
-var sprites_map [_PIXELS_LEN]uint
-
-var bg_priority [_LCD_WIDTH]bool
-var bg_transparent [_LCD_WIDTH]bool
-
-var state uint
-var ticks uint
-
-// incremented on every window pixel
-// The window keeps an internal line counter that’s functionally similar to LY,
-// and increments alongside it.
-// However, it only gets incremented when the window is visible
-// This line counter determines what window line is to be rendered on the current scanline.
-var window_line_counter uint8
-
-func InitFetcher() {
-	fifo_len = 0
-	fifo_front = 0
-	fifo_back = 0
-	window_line_counter = 0
-	line_x = 0
-	fetcher_x = 0
-	buffered_x = 0
-	fifo_x = 0
-	tile_id = 0
-	tiledata_base = _TILE_DATA_AREA_DEFAULT
-	bg_tilemap = _TILEMAP_SECONDARY
-	window_tilemap = _TILEMAP_SECONDARY
+// fetcher state, part of PPU
+type fetcher_t struct {
+	buffer [_LCD_WIDTH][_LCD_HEIGHT]uint32
+	// incremented at the last step of fetcher
+	fetcher_x      uint8
+	tile_id        uint8
+	tile_addr      uint
+	bg_bank        uint
+	bg_tilemap     uint
+	window_tilemap uint
+	tiledata_base  uint
+	map_x          uint8
+	map_y          uint8
+	win_x          uint8
+	win_y          uint8
+	tile_x         uint8
+	tile_y         uint8
+	line_x         uint8
+	// higher pixel x that has been rendered
+	buffered_x uint8
+	// higher pixel x that has been pushed to fifo
+	fifo_x              uint8
+	bg_pixels           [_PIXELS_LEN]uint
+	fifo_array          [_LCD_WIDTH * _LCD_HEIGHT]uint32
+	fifo_len            uint
+	fifo_front          uint
+	fifo_back           uint
+	sprite_pixels       [_SPRITES_PER_PIXEL][_PIXELS_LEN]uint
+	sprite_tiles        []sprite_t
+	sprites_on_line     [_SPRITES_PER_LINE]uint
+	sprites_on_line_len uint
+	sprites_map         [_PIXELS_LEN]uint
+	bg_priority         [_LCD_WIDTH]bool
+	bg_transparent      [_LCD_WIDTH]bool
+	state               uint
+	ticks               uint
+	// incremented on every window pixel
+	// The window keeps an internal line counter that’s functionally similar to LY,
+	// and increments alongside it.
+	// However, it only gets incremented when the window is visible
+	// This line counter determines what window line is to be rendered on the current scanline.
+	window_line_counter uint8
 }
 
-func FetcherStart() {
-	state = _FETCHER_STATE_GET_TILE
-
-	line_x = 0
-	fetcher_x = 0
-	buffered_x = 0
-	fifo_x = 0
-	tile_id = 0
-	tiledata_base = _TILE_DATA_AREA_DEFAULT
-	bg_tilemap = _TILEMAP_SECONDARY
-	window_tilemap = _TILEMAP_SECONDARY
-
-	fifo_len = 0
-	fifo_front = 0
-	fifo_back = 0
-
-	sprite_tiles = []sprite_t{}
-	bg_transparent = [_LCD_WIDTH]bool{}
-	bg_priority = [_LCD_WIDTH]bool{}
+func (p *PPU) InitFetcher() {
+	p.fifo_len = 0
+	p.fifo_front = 0
+	p.fifo_back = 0
+	p.window_line_counter = 0
+	p.line_x = 0
+	p.fetcher_x = 0
+	p.buffered_x = 0
+	p.fifo_x = 0
+	p.tile_id = 0
+	p.tiledata_base = _TILE_DATA_AREA_DEFAULT
+	p.bg_tilemap = _TILEMAP_SECONDARY
+	p.window_tilemap = _TILEMAP_SECONDARY
 }
-func FetcherOamLoad() {
-	sprites_on_line_len = 0
-	loadSpritePerLine()
+
+func (p *PPU) FetcherStart() {
+	p.state = _FETCHER_STATE_GET_TILE
+
+	p.line_x = 0
+	p.fetcher_x = 0
+	p.buffered_x = 0
+	p.fifo_x = 0
+	p.tile_id = 0
+	p.tiledata_base = _TILE_DATA_AREA_DEFAULT
+	p.bg_tilemap = _TILEMAP_SECONDARY
+	p.window_tilemap = _TILEMAP_SECONDARY
+
+	p.fifo_len = 0
+	p.fifo_front = 0
+	p.fifo_back = 0
+
+	p.sprite_tiles = []sprite_t{}
+	p.bg_transparent = [_LCD_WIDTH]bool{}
+	p.bg_priority = [_LCD_WIDTH]bool{}
+}
+func (p *PPU) FetcherOamLoad() {
+	p.sprites_on_line_len = 0
+	p.loadSpritePerLine()
 }
-func FetcherClearFIFO() {
-	fifo_len = 0
-	fifo_back = 0
-	fifo_front = 0
+func (p *PPU) FetcherClearFIFO() {
+	p.fifo_len = 0
+	p.fifo_back = 0
+	p.fifo_front = 0
 }
 
-func GetTileAddr() uint {
-	y := tile_y
-	if tile_addr != 0x0 && GetCGBBGVerticalFlip(tile_addr) {
+func (p *PPU) GetTileAddr() uint {
+	y := p.tile_y
+	if p.tile_addr != 0x0 && p.GetCGBBGVerticalFlip(p.tile_addr) {
 		y = 8 - y - 1
 	}
-	return (tiledata_base + uint(tile_id)<<4) + uint(y)<<1
+	return (p.tiledata_base + uint(p.tile_id)<<4) + uint(y)<<1
 }
-func GetSpriteTileAddr(sprite sprite_t) uint {
+func (p *PPU) GetSpriteTileAddr(sprite sprite_t) uint {
 	t_id := sprite.tile_index
 	s_h := uint(8)
-	if GetLCDCOBJSize() {
+	if p.GetLCDCOBJSize() {
 		t_id = utility.ClearBit(t_id, 0)
 		s_h = 16
 	}
-	y := (GetLY() - (sprite.y - 16))
+	y := (p.GetLY() - (sprite.y - 16))
 	if sprite.vertical_flip {
 		y = s_h - y - 1
 	}
 	return (_TILE_DATA_AREA_SECONDARY + uint(t_id)<<4) + y<<1
 }
 
-func FetcherTick() {
+func (p *PPU) FetcherTick() {
 
-	fetcherCycle()
+	p.fetcherCycle()
 	// done every tick
-	fetcherPixelPush()
+	p.fetcherPixelPush()
 }
 
-func fetcherCycle() {
+func (p *PPU) fetcherCycle() {
 
-	ticks++
+	p.ticks++
 	// fetcher goes at half speed
 	// in other words all phases take 2 dots in LCDTick()
-	if ticks < 2 {
+	if p.ticks < 2 {
 		return
 	}
-	ticks = 0
+	p.ticks = 0
 
 	// map_x/8 because a tile is 8x8
-	map_x = (fetcher_x + uint8(GetSCX())) / 8
-	map_y = (uint8(GetLY()) + uint8(GetSCY())) / 8
+	p.map_x = (p.fetcher_x + uint8(p.GetSCX())) / 8
+	p.map_y = (uint8(p.GetLY()) + uint8(p.GetSCY())) / 8
 	// has no scroll
-	win_x = (fetcher_x - (uint8(GetWX()) - 7)) / 8
+	p.win_x = (p.fetcher_x - (uint8(p.GetWX()) - 7)) / 8
 	// has no scroll
-	win_y = window_line_counter / 8
-	tile_y = (uint8(GetLY()) + uint8(GetSCY())) % 8
+	p.win_y = p.window_line_counter / 8
+	p.tile_y = (uint8(p.GetLY()) + uint8(p.GetSCY())) % 8
 
-	switch state {
+	switch p.state {
 	case _FETCHER_STATE_GET_TILE:
-		if IsWindowVisible() && IsPixelInWindow(int(fetcher_x), int(GetLY())) {
-			if GetLCDCWinTileMapDisplay() {
-				window_tilemap = _TILEMAP_SECONDARY
+		if p.IsWindowVisible() && p.IsPixelInWindow(int(p.fetcher_x), int(p.GetLY())) {
+			if p.GetLCDCWinTileMapDisplay() {
+				p.window_tilemap = _TILEMAP_SECONDARY
 			} else {
-				window_tilemap = _TILEMAP_DEFAULT
+				p.window_tilemap = _TILEMAP_DEFAULT
 			}
-			tile_addr = window_tilemap + uint(win_x) + (uint(win_y))<<5
+			p.tile_addr = p.window_tilemap + uint(p.win_x) + (uint(p.win_y))<<5
 		} else {
-			if GetLCDCBGTileMapDisplayArea() {
-				bg_tilemap = _TILEMAP_SECONDARY
+			if p.GetLCDCBGTileMapDisplayArea() {
+				p.bg_tilemap = _TILEMAP_SECONDARY
 			} else {
-				bg_tilemap = _TILEMAP_DEFAULT
+				p.bg_tilemap = _TILEMAP_DEFAULT
 			}
-			tile_addr = bg_tilemap + uint(map_x) + uint(map_y)<<5
+			p.tile_addr = p.bg_tilemap + uint(p.map_x) + uint(p.map_y)<<5
 
 		}
 		// the first tile map is for tile_id
 		// the second one for attributes
-		tile_id = ReadFromVRAMMemory(tile_addr, 0)
-		if !GetLCDCBGWinTileDataArea() {
+		p.tile_id = p.ReadFromVRAMMemory(p.tile_addr, 0)
+		if !p.GetLCDCBGWinTileDataArea() {
 			// indexing is [-127,+128] , so need to translate to [0,256]
-			tile_id += 128
-			tiledata_base = _TILE_DATA_AREA_DEFAULT
+			p.tile_id += 128
+			p.tiledata_base = _TILE_DATA_AREA_DEFAULT
 		} else {
-			tiledata_base = _TILE_DATA_AREA_SECONDARY
+			p.tiledata_base = _TILE_DATA_AREA_SECONDARY
 		}
-		if GetLCDCOBJDisplay() {
-			sprite_tiles = getSpriteTiles()
-			sprite_pixels = [_SPRITES_PER_PIXEL][_PIXELS_LEN]uint{}
+		if p.GetLCDCOBJDisplay() {
+			p.sprite_tiles = p.getSpriteTiles()
+			p.sprite_pixels = [_SPRITES_PER_PIXEL][_PIXELS_LEN]uint{}
 		} else {
-			sprite_tiles = []sprite_t{}
+			p.sprite_tiles = []sprite_t{}
 		}
-		fetcher_x += 8
+		p.fetcher_x += 8
 		break
 	case _FETCHER_STATE_GET_TILE_DATA0:
 		bank := uint(0)
-		if headers.IsCGB() && tile_addr != 0x0 && GetCGBBGVRAMBank(tile_addr) {
+		if p.headers.IsCGB() && p.tile_addr != 0x0 && p.GetCGBBGVRAMBank(p.tile_addr) {
 			bank = 1
 		}
-		data := ReadFromVRAMMemory(GetTileAddr(), bank)
+		data := p.ReadFromVRAMMemory(p.GetTileAddr(), bank)
 		for b := _PIXELS_LEN - 1; b >= 0; b-- {
-			bg_pixels[b] = utility.GetBit(uint(data), uint(b))
+			p.bg_pixels[b] = utility.GetBit(uint(data), uint(b))
 		}
-		for i := 0; i < len(sprite_tiles); i++ {
+		for i := 0; i < len(p.sprite_tiles); i++ {
 			bank = 0
-			if headers.IsCGB() && GetSpriteTileVRAMBankNumber(sprite_tiles[i].addr) {
+			if p.headers.IsCGB() && p.GetSpriteTileVRAMBankNumber(p.sprite_tiles[i].addr) {
 				bank = 1
 			}
-			data = ReadFromVRAMMemory(GetSpriteTileAddr(sprite_tiles[i]), bank)
+			data = p.ReadFromVRAMMemory(p.GetSpriteTileAddr(p.sprite_tiles[i]), bank)
 			for b := _PIXELS_LEN - 1; b >= 0; b-- {
-				sprite_pixels[i][b] = utility.GetBit(uint(data), uint(b))
+				p.sprite_pixels[i][b] = utility.GetBit(uint(data), uint(b))
 			}
 		}
 		break
 	case _FETCHER_STATE_GET_TILE_DATA1:
 		bank := uint(0)
-		if headers.IsCGB() && tile_addr != 0x0 && GetCGBBGVRAMBank(tile_addr) {
+		if p.headers.IsCGB() && p.tile_addr != 0x0 && p.GetCGBBGVRAMBank(p.tile_addr) {
 			bank = 1
 		}
-		data := ReadFromVRAMMemory(GetTileAddr()+1, bank)
+		data := p.ReadFromVRAMMemory(p.GetTileAddr()+1, bank)
 		for b := _PIXELS_LEN - 1; b >= 0; b-- {
-			bg_pixels[b] |= utility.GetBit(uint(data), uint(b)) << 1
+			p.bg_pixels[b] |= utility.GetBit(uint(data), uint(b)) << 1
 		}
-		for i := 0; i < len(sprite_tiles); i++ {
+		for i := 0; i < len(p.sprite_tiles); i++ {
 			bank = 0
-			if headers.IsCGB() && GetSpriteTileVRAMBankNumber(sprite_tiles[i].addr) {
+			if p.headers.IsCGB() && p.GetSpriteTileVRAMBankNumber(p.sprite_tiles[i].addr) {
 				bank = 1
 			}
-			data = ReadFromVRAMMemory(GetSpriteTileAddr(sprite_tiles[i])+1, bank)
+			data = p.ReadFromVRAMMemory(p.GetSpriteTileAddr(p.sprite_tiles[i])+1, bank)
 			for b := _PIXELS_LEN - 1; b >= 0; b-- {
-				sprite_pixels[i][b] |= utility.GetBit(uint(data), uint(b)) << 1
+				p.sprite_pixels[i][b] |= utility.GetBit(uint(data), uint(b)) << 1
 			}
 		}
 		break
@@ -274,97 +263,97 @@ func fetcherCycle() {
 	// 	break
 	case _FETCHER_STATE_PUSH:
 		// no space left
-		if fifo_len > 8 {
+		if p.fifo_len > 8 {
 			return
 		}
 		// TODO: is this necessary
-		x := uint(fetcher_x) - (8 - (GetSCX() % 8))
+		x := uint(p.fetcher_x) - (8 - (p.GetSCX() % 8))
 		if x >= 0 {
 			// load fifo
 			for i := _PIXELS_LEN - 1; i >= 0; i-- {
 				bg_i := i
-				if tile_addr != 0x0 && GetCGBBGHorizontalFlip(tile_addr) {
+				if p.tile_addr != 0x0 && p.GetCGBBGHorizontalFlip(p.tile_addr) {
 					bg_i = _PIXELS_LEN - 1 - i
 				}
-				color := GetBGColor(bg_pixels[bg_i])
-				if !GetLCDCBGWinDisplay() && headers.IsGB() {
-					bg_pixels[bg_i] = 0
-					color = GetBGColor(bg_pixels[bg_i])
+				color := p.GetBGColor(p.bg_pixels[bg_i])
+				if !p.GetLCDCBGWinDisplay() && p.headers.IsGB() {
+					p.bg_pixels[bg_i] = 0
+					color = p.GetBGColor(p.bg_pixels[bg_i])
 				}
-				if headers.IsCGB() && tile_addr != 0x0 {
-					color = GetCGBBGColor(tile_addr, bg_pixels[bg_i])
+				if p.headers.IsCGB() && p.tile_addr != 0x0 {
+					color = p.GetCGBBGColor(p.tile_addr, p.bg_pixels[bg_i])
 				}
 
-				if GetLCDCOBJDisplay() && len(sprite_tiles) > 0 {
+				if p.GetLCDCOBJDisplay() && len(p.sprite_tiles) > 0 {
 					bg_priority := false
-					if headers.IsCGB() {
-						bg_priority = GetLCDCBGWinDisplay() && (tile_addr != 0x0 && GetCGBBGPriority(tile_addr))
+					if p.headers.IsCGB() {
+						bg_priority = p.GetLCDCBGWinDisplay() && (p.tile_addr != 0x0 && p.GetCGBBGPriority(p.tile_addr))
 					}
-					color = fetcherGetSpritePixel(i, bg_pixels[bg_i], color, bg_priority)
+					color = p.fetcherGetSpritePixel(i, p.bg_pixels[bg_i], color, bg_priority)
 				}
 
-				fifo_array[fifo_back] = color
-				fifo_len++
-				fifo_back++
-				fifo_x++
+				p.fifo_array[p.fifo_back] = color
+				p.fifo_len++
+				p.fifo_back++
+				p.fifo_x++
 			}
 		} else {
 			log.Printf("x nop")
 		}
 		break
 	default:
-		log.Fatalf("Fetcher state not recognized %d\n", state)
+		log.Fatalf("Fetcher state not recognized %d\n", p.state)
 		break
 	}
 
-	state++
-	if state > _FETCHER_STATE_PUSH {
-		state = _FETCHER_STATE_GET_TILE
+	p.state++
+	if p.state > _FETCHER_STATE_PUSH {
+		p.state = _FETCHER_STATE_GET_TILE
 	}
 
 }
 
-func fetcherGetSpritePixel(index int, bg_color_index uint, bg_color uint32, bg_priority bool) uint32 {
+func (p *PPU) fetcherGetSpritePixel(index int, bg_color_index uint, bg_color uint32, bg_priority bool) uint32 {
 	new_color := bg_color
 	new_color_c := uint(0)
 	bit := index
 	min_x := _LCD_WIDTH + 8
 	min_oam := uint(0xFFFF)
-	for s := 0; s < len(sprite_tiles); s++ {
-		x := int(sprite_tiles[s].x) - 8 + int(GetSCX()%8)
-		if x+8 < int(fifo_x) {
+	for s := 0; s < len(p.sprite_tiles); s++ {
+		x := int(p.sprite_tiles[s].x) - 8 + int(p.GetSCX()%8)
+		if x+8 < int(p.fifo_x) {
 			continue
 		}
-		bit = int(fifo_x) - int(x)
+		bit = int(p.fifo_x) - int(x)
 		// check if bit is already displayed or if out of bounds
 		if bit < 0 || bit > 7 {
 			continue
 		}
-		if !sprite_tiles[s].horizontal_flip {
+		if !p.sprite_tiles[s].horizontal_flip {
 			bit = 7 - bit
 		}
 		// do this check before update x is important
-		if IsTransparent(sprite_pixels[s][bit]) {
+		if IsTransparent(p.sprite_pixels[s][bit]) {
 			continue
 		}
-		if (!bg_priority && !sprite_tiles[s].bg_priority) || IsTransparent(bg_color_index) {
+		if (!bg_priority && !p.sprite_tiles[s].bg_priority) || IsTransparent(bg_color_index) {
 			prior := x < min_x
 			// CGB has different priorities
-			if headers.IsCGB() {
-				prior = sprite_tiles[s].addr < min_oam
+			if p.headers.IsCGB() {
+				prior = p.sprite_tiles[s].addr < min_oam
 			}
 			// the `<` avoids the problem of same x
 			if prior {
 				min_x = x
-				min_oam = sprite_tiles[s].addr
-				new_color_c = sprite_pixels[s][bit]
-				if headers.IsCGB() {
-					new_color = GetCGBOBPColor(sprite_tiles[s].addr, new_color_c)
+				min_oam = p.sprite_tiles[s].addr
+				new_color_c = p.sprite_pixels[s][bit]
+				if p.headers.IsCGB() {
+					new_color = p.GetCGBOBPColor(p.sprite_tiles[s].addr, new_color_c)
 				} else {
-					if sprite_tiles[s].palette {
-						new_color = GetOBP1Color(new_color_c)
+					if p.sprite_tiles[s].palette {
+						new_color = p.GetOBP1Color(new_color_c)
 					} else {
-						new_color = GetOBP0Color(new_color_c)
+						new_color = p.GetOBP0Color(new_color_c)
 					}
 				}
 			}
@@ -376,35 +365,35 @@ func fetcherGetSpritePixel(index int, bg_color_index uint, bg_color uint32, bg_p
 	return bg_color
 }
 
-func fetcherPixelPush() {
-	if fifo_len > _FIFO_MAX_LEN {
-		pixel := FetcherFIFOPop()
-		if line_x >= uint8(GetSCX())%8 {
-			buffer[buffered_x][GetLY()] = pixel
-			buffered_x++
+func (p *PPU) fetcherPixelPush() {
+	if p.fifo_len > _FIFO_MAX_LEN {
+		pixel := p.FetcherFIFOPop()
+		if p.line_x >= uint8(p.GetSCX())%8 {
+			p.buffer[p.buffered_x][p.GetLY()] = pixel
+			p.buffered_x++
 		}
-		line_x++
+		p.line_x++
 	}
 }
 
-func loadSpritePerLine() {
+func (p *PPU) loadSpritePerLine() {
 	loaded := uint(0)
 	// min_x := _LCD_WIDTH + 8
 	// min_oam := uint(0xFFFF)
 	height := 8
-	if GetLCDCOBJSize() {
+	if p.GetLCDCOBJSize() {
 		height = 16
 	}
 	for i := uint(0); i < _SPRITES_NUM && loaded < _SPRITES_PER_LINE; i++ {
 		addr := _OAM_SPRITES_BASE + i*4
-		x := int(GetSpriteXPosition(addr))
+		x := int(p.GetSpriteXPosition(addr))
 		// not visible
 		if x == 0 {
 			continue
 		}
-		y := int(GetSpriteYPosition(addr)) - 16
-		if y <= int(GetLY()) && y+height > int(GetLY()) {
-			sprites_on_line[loaded] = addr
+		y := int(p.GetSpriteYPosition(addr)) - 16
+		if y <= int(p.GetLY()) && y+height > int(p.GetLY()) {
+			p.sprites_on_line[loaded] = addr
 			loaded++
 		}
 		// check if too much
@@ -412,32 +401,32 @@ func loadSpritePerLine() {
 			break
 		}
 	}
-	sprites_on_line_len = uint(loaded)
+	p.sprites_on_line_len = uint(loaded)
 }
 
-func getSpriteTiles() []sprite_t {
+func (p *PPU) getSpriteTiles() []sprite_t {
 	tile_addr := []sprite_t{}
 	c := uint(0)
-	for i := 0; i < int(sprites_on_line_len); i++ {
+	for i := 0; i < int(p.sprites_on_line_len); i++ {
 		// int because x could be also -7 (one pixel will be displayed)
-		x := int(GetSpriteXPosition(sprites_on_line[i])) - 8 + int(GetSCX())%8
+		x := int(p.GetSpriteXPosition(p.sprites_on_line[i])) - 8 + int(p.GetSCX())%8
 		// check that sprite is in this row of 8 pixel
 		// choose the one with lower x
 		// < and not <= because in case of parity of lower x we have to choose
 		// the first one in oam
 		// x+8 > fetcher_x ( > is strict !! important)
-		if (x < int(fetcher_x) && x+8 >= int(fetcher_x)) || (x >= int(fetcher_x) && x < int(fetcher_x)+8) {
-			s_x := GetSpriteXPosition(sprites_on_line[i])
-			s_y := GetSpriteYPosition(sprites_on_line[i])
-			t_i := GetSpriteTileIndex(sprites_on_line[i])
-			flip_h := GetSpriteHorizontalFlip(sprites_on_line[i])
-			flip_v := GetSpriteVerticalFlip(sprites_on_line[i])
-			pal := GetSpritePaletteNumber(sprites_on_line[i])
-			pal_cgb := GetSpriteCGBPaletteNumber(sprites_on_line[i])
-			bg_p := GetSpriteBGtoOAMPriority(sprites_on_line[i])
+		if (x < int(p.fetcher_x) && x+8 >= int(p.fetcher_x)) || (x >= int(p.fetcher_x) && x < int(p.fetcher_x)+8) {
+			s_x := p.GetSpriteXPosition(p.sprites_on_line[i])
+			s_y := p.GetSpriteYPosition(p.sprites_on_line[i])
+			t_i := p.GetSpriteTileIndex(p.sprites_on_line[i])
+			flip_h := p.GetSpriteHorizontalFlip(p.sprites_on_line[i])
+			flip_v := p.GetSpriteVerticalFlip(p.sprites_on_line[i])
+			pal := p.GetSpritePaletteNumber(p.sprites_on_line[i])
+			pal_cgb := p.GetSpriteCGBPaletteNumber(p.sprites_on_line[i])
+			bg_p := p.GetSpriteBGtoOAMPriority(p.sprites_on_line[i])
 
 			tile_addr = append(tile_addr,
-				sprite_t{addr: sprites_on_line[i],
+				sprite_t{addr: p.sprites_on_line[i],
 					x: s_x, y: s_y,
 					tile_index:      t_i,
 					horizontal_flip: flip_h,
@@ -456,38 +445,38 @@ func getSpriteTiles() []sprite_t {
 	return tile_addr
 }
 
-func FetcherFIFOPop() uint32 {
+func (p *PPU) FetcherFIFOPop() uint32 {
 	// if fifo.Len() == 0 {
 	// 	log.Fatal("fifo is empty")
 	// }
 	//
 	// return fifo.Remove(fifo.Front()).(uint32)
-	if fifo_len == 0 {
+	if p.fifo_len == 0 {
 		log.Fatal("fifo is empty")
 	}
 
-	fifo_len--
-	r := fifo_array[fifo_front]
-	fifo_front++
+	p.fifo_len--
+	r := p.fifo_array[p.fifo_front]
+	p.fifo_front++
 	return r
 }
 
-func DrawScanline() {
-	bg_priority = [_LCD_WIDTH]bool{}
-	renderBG()
-	renderWindow()
-	renderSprites()
-	buffered_x = _LCD_WIDTH
+func (p *PPU) DrawScanline() {
+	p.bg_priority = [_LCD_WIDTH]bool{}
+	p.renderBG()
+	p.renderWindow()
+	p.renderSprites()
+	p.buffered_x = _LCD_WIDTH
 }
-func renderBG() {
-	if !GetLCDCBGWinDisplay() && !headers.IsCGB() {
+func (p *PPU) renderBG() {
+	if !p.GetLCDCBGWinDisplay() && !p.headers.IsCGB() {
 		return
 	}
-	ly := int(GetLY())
-	scx := int(GetSCX())
-	scy := int(GetSCY())
+	ly := int(p.GetLY())
+	scx := int(p.GetSCX())
+	scy := int(p.GetSCY())
 	tilemap := _TILEMAP_DEFAULT
-	if GetLCDCBGTileMapDisplayArea() {
+	if p.GetLCDCBGTileMapDisplayArea() {
 		tilemap = _TILEMAP_SECONDARY
 	}
 	if ly >= 144 {
@@ -499,51 +488,51 @@ func renderBG() {
 		map_y := ((ly + scy) % 256) / 8
 		tile_y := (ly + scy) % 256 % 8
 		tile_addr := tilemap + uint(map_y*32+map_x)
-		tile_id = ReadFromVRAMMemory(tile_addr, 0)
-		if !GetLCDCBGWinTileDataArea() {
-			tile_id += 128
+		p.tile_id = p.ReadFromVRAMMemory(tile_addr, 0)
+		if !p.GetLCDCBGWinTileDataArea() {
+			p.tile_id += 128
 			tiledata = _TILE_DATA_AREA_DEFAULT
 		}
-		if GetCGBBGVerticalFlip(tile_addr) {
+		if p.GetCGBBGVerticalFlip(tile_addr) {
 			tile_y = _PIXELS_LEN - 1 - tile_y
 		}
-		tile_data_addr := uint(tiledata) + uint(tile_id)*16 + uint(tile_y*2)
+		tile_data_addr := uint(tiledata) + uint(p.tile_id)*16 + uint(tile_y*2)
 
 		bank := uint(0)
-		if headers.IsCGB() && GetCGBBGVRAMBank(tile_addr) {
+		if p.headers.IsCGB() && p.GetCGBBGVRAMBank(tile_addr) {
 			bank = 1
 		}
-		byte1 := ReadFromVRAMMemory(tile_data_addr, bank)
-		byte2 := ReadFromVRAMMemory(tile_data_addr+1, bank)
+		byte1 := p.ReadFromVRAMMemory(tile_data_addr, bank)
+		byte2 := p.ReadFromVRAMMemory(tile_data_addr+1, bank)
 		pixels := [_PIXELS_LEN]uint{}
 		c := 0
 		for b := _PIXELS_LEN - 1; b >= 0; b-- {
 			pixels[b] = utility.GetBit(uint(byte1), uint(b))
 			pixels[b] |= utility.GetBit(uint(byte2), uint(b)) << 1
-			color := GetBGColor(pixels[b])
-			if headers.IsCGB() {
-				color = GetCGBBGColor(tile_addr, pixels[b])
+			color := p.GetBGColor(pixels[b])
+			if p.headers.IsCGB() {
+				color = p.GetCGBBGColor(tile_addr, pixels[b])
 			}
 			pos := x + c
-			if GetCGBBGHorizontalFlip(tile_addr) {
+			if p.GetCGBBGHorizontalFlip(tile_addr) {
 				pos = x + (_PIXELS_LEN - 1 - c)
 			}
-			buffer[pos][ly] = color
-			bg_transparent[pos] = IsTransparent(pixels[b])
-			if headers.IsCGB() {
-				bg_priority[pos] = GetCGBBGPriority(tile_addr) && GetLCDCBGWinDisplay()
+			p.buffer[pos][ly] = color
+			p.bg_transparent[pos] = IsTransparent(pixels[b])
+			if p.headers.IsCGB() {
+				p.bg_priority[pos] = p.GetCGBBGPriority(tile_addr) && p.GetLCDCBGWinDisplay()
 			}
 			c++
 		}
 	}
 }
-func renderWindow() {
-	if !IsWindowVisible() {
+func (p *PPU) renderWindow() {
+	if !p.IsWindowVisible() {
 		return
 	}
-	ly := int(GetLY())
-	wx := int(GetWX())
-	wy := int(GetWY())
+	ly := int(p.GetLY())
+	wx := int(p.GetWX())
+	wy := int(p.GetWY())
 	// no window
 	if ly < wy || wx > _WX_MAX {
 		return
@@ -553,7 +542,7 @@ func renderWindow() {
 	}
 	wx -= 7
 	tilemap := _TILEMAP_DEFAULT
-	if GetLCDCWinTileMapDisplay() {
+	if p.GetLCDCWinTileMapDisplay() {
 		tilemap = _TILEMAP_SECONDARY
 	}
 	tiledata := _TILE_DATA_AREA_SECONDARY
@@ -562,43 +551,43 @@ func renderWindow() {
 			continue
 		}
 		map_x := x / 8
-		map_y := window_line_counter / 8
-		tile_y := window_line_counter % 8
+		map_y := p.window_line_counter / 8
+		tile_y := p.window_line_counter % 8
 		tile_addr := tilemap + uint(uint(map_y)*32+uint(map_x))
-		tile_id = ReadFromVRAMMemory(tile_addr, 0)
-		if !GetLCDCBGWinTileDataArea() {
-			tile_id += 128
+		p.tile_id = p.ReadFromVRAMMemory(tile_addr, 0)
+		if !p.GetLCDCBGWinTileDataArea() {
+			p.tile_id += 128
 			tiledata = _TILE_DATA_AREA_DEFAULT
 		}
-		if GetCGBBGVerticalFlip(tile_addr) {
+		if p.GetCGBBGVerticalFlip(tile_addr) {
 			tile_y = _PIXELS_LEN - 1 - tile_y
 		}
-		tile_data_addr := uint(tiledata) + uint(tile_id)*16 + uint(tile_y*2)
+		tile_data_addr := uint(tiledata) + uint(p.tile_id)*16 + uint(tile_y*2)
 
 		bank := uint(0)
-		if headers.IsCGB() && GetCGBBGVRAMBank(tile_addr) {
+		if p.headers.IsCGB() && p.GetCGBBGVRAMBank(tile_addr) {
 			bank = 1
 		}
-		byte1 := ReadFromVRAMMemory(tile_data_addr, bank)
-		byte2 := ReadFromVRAMMemory(tile_data_addr+1, bank)
+		byte1 := p.ReadFromVRAMMemory(tile_data_addr, bank)
+		byte2 := p.ReadFromVRAMMemory(tile_data_addr+1, bank)
 		pixels := [_PIXELS_LEN]uint{}
 		c := 0
 		for b := _PIXELS_LEN - 1; b >= 0; b-- {
 			pixels[b] = utility.GetBit(uint(byte1), uint(b))
 			pixels[b] |= utility.GetBit(uint(byte2), uint(b)) << 1
 			color := GetColor(pixels[b])
-			if headers.IsCGB() {
-				color = GetCGBBGColor(tile_addr, pixels[b])
+			if p.headers.IsCGB() {
+				color = p.GetCGBBGColor(tile_addr, pixels[b])
 			}
 			pos := x + wx + c
-			if GetCGBBGHorizontalFlip(tile_addr) {
+			if p.GetCGBBGHorizontalFlip(tile_addr) {
 				pos = x + wx + (_PIXELS_LEN - 1 - c)
 			}
 			if pos < _LCD_WIDTH {
-				buffer[pos][ly] = color
-				bg_transparent[pos] = IsTransparent(pixels[b])
-				if headers.IsCGB() {
-					bg_priority[pos] = GetCGBBGPriority(tile_addr) && GetLCDCBGWinDisplay()
+				p.buffer[pos][ly] = color
+				p.bg_transparent[pos] = IsTransparent(pixels[b])
+				if p.headers.IsCGB() {
+					p.bg_priority[pos] = p.GetCGBBGPriority(tile_addr) && p.GetLCDCBGWinDisplay()
 				}
 				c++
 			} else {
@@ -607,17 +596,17 @@ func renderWindow() {
 		}
 	}
 }
-func renderSprites() {
-	if !GetLCDCOBJDisplay() {
+func (p *PPU) renderSprites() {
+	if !p.GetLCDCOBJDisplay() {
 		return
 	}
 	loaded := uint(0)
-	ly := int(GetLY())
+	ly := int(p.GetLY())
 	if ly >= 144 {
 		return
 	}
 	height := 8
-	if GetLCDCOBJSize() {
+	if p.GetLCDCOBJSize() {
 		height = 16
 	}
 	row := [_LCD_WIDTH]int{}
@@ -626,33 +615,33 @@ func renderSprites() {
 	}
 	for i := uint(0); i < _SPRITES_NUM; i++ {
 		addr := _OAM_SPRITES_BASE + i*4
-		x := int(GetSpriteXPosition(addr)) - 8
-		y := int(GetSpriteYPosition(addr)) - 16
+		x := int(p.GetSpriteXPosition(addr)) - 8
+		y := int(p.GetSpriteYPosition(addr)) - 16
 		if y > ly || y+height <= ly {
 			continue
 		}
-		tile_index := uint(GetSpriteTileIndex(addr))
-		if GetLCDCOBJSize() {
+		tile_index := uint(p.GetSpriteTileIndex(addr))
+		if p.GetLCDCOBJSize() {
 			tile_index = utility.ClearBit(tile_index, 0)
 		}
 		y = (ly - y)
-		if GetSpriteVerticalFlip(addr) {
+		if p.GetSpriteVerticalFlip(addr) {
 			y = height - y - 1
 		}
 		spritedata := (_TILE_DATA_AREA_SECONDARY + uint(tile_index)<<4) + uint(y)<<1
 
 		bank := uint(0)
-		if headers.IsCGB() && GetSpriteTileVRAMBankNumber(addr) {
+		if p.headers.IsCGB() && p.GetSpriteTileVRAMBankNumber(addr) {
 			bank = 1
 		}
-		byte1 := ReadFromVRAMMemory(spritedata, bank)
-		byte2 := ReadFromVRAMMemory(spritedata+1, bank)
+		byte1 := p.ReadFromVRAMMemory(spritedata, bank)
+		byte2 := p.ReadFromVRAMMemory(spritedata+1, bank)
 
 		pixels := [_PIXELS_LEN]uint{}
 		c := 0
 		for b := _PIXELS_LEN - 1; b >= 0; b-- {
 			pos := x + c
-			if GetSpriteHorizontalFlip(addr) {
+			if p.GetSpriteHorizontalFlip(addr) {
 				pos = x + (_PIXELS_LEN - 1 - c)
 			}
 			c++
@@ -661,7 +650,7 @@ func renderSprites() {
 			}
 			to_display := x < row[pos]
 			// CGB has different priorities
-			if headers.IsCGB() {
+			if p.headers.IsCGB() {
 				to_display = row[pos] == _LCD_WIDTH+1
 			}
 			if !to_display {
@@ -673,18 +662,18 @@ func renderSprites() {
 				continue
 			}
 			color := GetColor(0)
-			if headers.IsGB() {
-				if GetSpritePaletteNumber(addr) {
-					color = GetOBP1Color(pixels[b])
+			if p.headers.IsGB() {
+				if p.GetSpritePaletteNumber(addr) {
+					color = p.GetOBP1Color(pixels[b])
 				} else {
-					color = GetOBP0Color(pixels[b])
+					color = p.GetOBP0Color(pixels[b])
 				}
 			}
-			if headers.IsCGB() {
-				color = GetCGBOBPColor(addr, pixels[b])
+			if p.headers.IsCGB() {
+				color = p.GetCGBOBPColor(addr, pixels[b])
 			}
-			if (!bg_priority[pos] && !GetSpriteBGtoOAMPriority(addr)) || bg_transparent[pos] {
-				buffer[pos][ly] = color
+			if (!p.bg_priority[pos] && !p.GetSpriteBGtoOAMPriority(addr)) || p.bg_transparent[pos] {
+				p.buffer[pos][ly] = color
 				row[pos] = x
 			}
 		}
@@ -695,43 +684,43 @@ func renderSprites() {
 	}
 }
 
-func FetcherGetCurrentDots() uint {
-	return current_dots
+func (p *PPU) FetcherGetCurrentDots() uint {
+	return p.current_dots
 }
-func FetcherGetPushedX() uint {
-	return uint(buffered_x)
+func (p *PPU) FetcherGetPushedX() uint {
+	return uint(p.buffered_x)
 }
-func FetcherGetY() uint {
-	return GetLY()
+func (p *PPU) FetcherGetY() uint {
+	return p.GetLY()
 }
-func FetcherGetBuffer() [_LCD_WIDTH][_LCD_HEIGHT]uint32 {
-	return buffer
+func (p *PPU) FetcherGetBuffer() [_LCD_WIDTH][_LCD_HEIGHT]uint32 {
+	return p.buffer
 }
-func IsWindowVisible() bool {
-	return GetLCDCWinDisplay() && (int(GetWX()) >= 0 && int(GetWX()) <= _WX_MAX && int(GetWY()) >= 0 && int(GetWY()) <= _WY_MAX)
+func (p *PPU) IsWindowVisible() bool {
+	return p.GetLCDCWinDisplay() && (int(p.GetWX()) >= 0 && int(p.GetWX()) <= _WX_MAX && int(p.GetWY()) >= 0 && int(p.GetWY()) <= _WY_MAX)
 }
-func IsPixelInWindow(x int, y int) bool {
-	return (x >= int(GetWX())-7 && x < int(GetWX())-7+_LCD_WIDTH) && (y >= int(GetWY()) && y < int(GetWY()+_LCD_HEIGHT))
+func (p *PPU) IsPixelInWindow(x int, y int) bool {
+	return (x >= int(p.GetWX())-7 && x < int(p.GetWX())-7+_LCD_WIDTH) && (y >= int(p.GetWY()) && y < int(p.GetWY()+_LCD_HEIGHT))
 }
-func IncrementWindowLineCounter() {
+func (p *PPU) IncrementWindowLineCounter() {
 	// if is in bounds
-	if IsWindowVisible() && GetWY() < GetLY() && GetWY()+_LCD_HEIGHT > GetLY() {
-		window_line_counter++
+	if p.IsWindowVisible() && p.GetWY() < p.GetLY() && p.GetWY()+_LCD_HEIGHT > p.GetLY() {
+		p.window_line_counter++
 	}
 }
-func ResetWindowLineCounter() {
-	window_line_counter = 0
+func (p *PPU) ResetWindowLineCounter() {
+	p.window_line_counter = 0
 }
 
 // this will return a tile 8x8 pixel as matrix
-func GetTileData(addr uint) [_TILE_W][_TILE_H]uint {
+func (p *PPU) GetTileData(addr uint) [_TILE_W][_TILE_H]uint {
 	tile := [_TILE_W][_TILE_H]uint{}
 	c := uint(0)
 	y := uint(0)
 	for t := 0; t < _TILE_BYTES; t += 2 {
-		p1 := ReadFromVRAMMemory(addr+c, 0)
+		p1 := p.ReadFromVRAMMemory(addr+c, 0)
 		c++
-		p2 := ReadFromVRAMMemory(addr+c, 0)
+		p2 := p.ReadFromVRAMMemory(addr+c, 0)
 		c++
 		x := 0
 		for b := 7; b >= 0; b-- {
@@ -2,8 +2,6 @@ package ppu
 
 import (
 	"log"
-
-	"github.com/giammirove/gampboy_emulator/internal/interrupts"
 )
 
 const _TOTAL_DOTS = 456
@@ -18,36 +16,40 @@ const _MODE_VBLANK = 1
 const _MODE_OAM = 2
 const _MODE_PIXEL_DRAWING = 3
 
-var current_dots uint
-var current_frame int
-var fps uint
-
-var current_speed = 0
-
-var target_time uint32 = 1000 / 60
-var prev_time uint32
+// lcd state, part of PPU
+type lcd_t struct {
+	current_dots  uint
+	current_frame int
+	fps           uint
+	current_speed int
+	lcd_registers [_LCD_CGB_REGISTER_NUM]uint
+	wait          uint
+	pacing_t
+}
 
-var lcd_registers [_LCD_CGB_REGISTER_NUM]uint
+// InitLCD is the state at power on, the lcd is off
+func (p *PPU) InitLCD() {
+	p.lcd_registers = [_LCD_CGB_REGISTER_NUM]uint{}
+	p.lcd_registers[_STAT-_REGISTER_BASE] = 0x80
+	p.lcd_registers[_DMA-_REGISTER_BASE] = 0xFF
+	p.lcd_registers[_KEY1-_REGISTER_BASE] = 0xFF
+	p.lcd_registers[_VBK-_REGISTER_BASE] = 0xFF
+	p.lcd_registers[_RP-_REGISTER_BASE] = 0xFF
+	p.lcd_registers[_BGPI-_REGISTER_BASE] = 0xFF
+	p.lcd_registers[_BGPD-_REGISTER_BASE] = 0xFF
+	p.lcd_registers[_OBPI-_REGISTER_BASE] = 0xFF
+	p.lcd_registers[_OBPD-_REGISTER_BASE] = 0xFF
+	p.lcd_registers[_SVBK-_REGISTER_BASE] = 0xFF
+	p.fps = 0
+	p.current_dots = 0
+}
 
-func InitLCD() {
-	lcd_registers[_LCDC-_REGISTER_BASE] = 0x91
-	lcd_registers[_STAT-_REGISTER_BASE] = 0x81
-	lcd_registers[_LY-_REGISTER_BASE] = 0x91
-	lcd_registers[_LYC-_REGISTER_BASE] = 0x00
-	lcd_registers[_DMA-_REGISTER_BASE] = 0xFF
-	lcd_registers[_BGP-_REGISTER_BASE] = 0xFC
-	lcd_registers[_WY-_REGISTER_BASE] = 0x00
-	lcd_registers[_WX-_REGISTER_BASE] = 0x00
-	lcd_registers[_KEY1-_REGISTER_BASE] = 0xFF
-	lcd_registers[_VBK-_REGISTER_BASE] = 0xFF
-	lcd_registers[_RP-_REGISTER_BASE] = 0xFF
-	lcd_registers[_BGPI-_REGISTER_BASE] = 0xFF
-	lcd_registers[_BGPD-_REGISTER_BASE] = 0xFF
-	lcd_registers[_OBPI-_REGISTER_BASE] = 0xFF
-	lcd_registers[_OBPD-_REGISTER_BASE] = 0xFF
-	lcd_registers[_SVBK-_REGISTER_BASE] = 0xFF
-	fps = 0
-	current_dots = 0
+// PostBoot is the state left by the boot rom, the lcd is on
+func (p *PPU) PostBoot() {
+	p.lcd_registers[_LCDC-_REGISTER_BASE] = 0x91
+	p.lcd_registers[_STAT-_REGISTER_BASE] = 0x81
+	p.lcd_registers[_LY-_REGISTER_BASE] = 0x91
+	p.lcd_registers[_BGP-_REGISTER_BASE] = 0xFC
 }
 
 func IsLCDAddr(addr uint) bool {
@@ -55,7 +57,7 @@ func IsLCDAddr(addr uint) bool {
 	return r
 }
 
-func ReadFromLCDMemory(addr uint) uint {
+func (p *PPU) ReadFromLCDMemory(addr uint) uint {
 	if !IsLCDAddr(addr) {
 		log.Fatalf("LCD address not recognized %04X\n", addr)
 	}
@@ -70,9 +72,9 @@ func ReadFromLCDMemory(addr uint) uint {
 	}
 	if addr == _DMA {
 	}
-	return lcd_registers[addr-_REGISTER_BASE]
+	return p.lcd_registers[addr-_REGISTER_BASE]
 }
-func WriteToLCDMemory(addr uint, value uint) {
+func (p *PPU) WriteToLCDMemory(addr uint, value uint) {
 	if !IsLCDAddr(addr) {
 		log.Fatalf("LCD address not recognized %04X\n", addr)
 	}
@@ -81,21 +83,21 @@ func WriteToLCDMemory(addr uint, value uint) {
 	}
 
 	if addr == _BGP {
-		UpdatePalette(&bg_colors, value)
+		p.UpdatePalette(&p.bg_colors, value)
 	}
 	if addr == _OBP0 {
-		UpdatePalette(&obp0_colors, value&0b11111100)
+		p.UpdatePalette(&p.obp0_colors, value&0b11111100)
 	}
 	if addr == _OBP1 {
-		UpdatePalette(&obp1_colors, value&0b11111100)
+		p.UpdatePalette(&p.obp1_colors, value&0b11111100)
 	}
 	// if headers.IsCGB() {
 	if addr == _KEY1 {
 		value = value & 0b1
 		// prepare speed switch
 		if value == 1 {
-			switchSpeed()
-			value = uint(current_speed) << 7
+			p.switchSpeed()
+			value = uint(p.current_speed) << 7
 		}
 		// utility.WaitHere()
 	}
@@ -103,10 +105,10 @@ func WriteToLCDMemory(addr uint, value uint) {
 		// log.Printf("HDMA %04X -> %04X\n", addr, value)
 	}
 	if addr == _BGPD {
-		UpdateCGBPalette(&cgb_bg_colors, uint32(value))
+		p.UpdateCGBPalette(&p.cgb_bg_colors, uint32(value))
 	}
 	if addr == _OBPD {
-		UpdateCGBPalette(&cgb_obp_colors, uint32(value))
+		p.UpdateCGBPalette(&p.cgb_obp_colors, uint32(value))
 	}
 	if addr == _VBK {
 		// just first bit is important, others set to 1
@@ -121,116 +123,108 @@ func WriteToLCDMemory(addr uint, value uint) {
 	if addr >= _BGPI {
 		addr -= _LCD_CGB_REGISTER_OFFSET
 	}
-	lcd_registers[addr-_REGISTER_BASE] = value
+	p.lcd_registers[addr-_REGISTER_BASE] = value
 
 	if addr == _DMA {
-		DMAStart()
+		p.DMAStart()
 	}
 	if addr == _LCDC {
 		// resetted
-		if !GetLCDCEnable() {
-			lcd_registers[_STAT-_REGISTER_BASE] = getSTAT() & 0b11111100
+		if !p.GetLCDCEnable() {
+			p.lcd_registers[_STAT-_REGISTER_BASE] = p.getSTAT() & 0b11111100
 		} else {
 			// otherwise first time this check will be skipped
-			updateLYFlag()
+			p.updateLYFlag()
 		}
 	}
 
 	if addr == _HDMA5 {
-		HDMAStart()
+		p.HDMAStart()
 	}
 }
-func IsDoubleSpeed() bool {
-	return current_speed == 1
+func (p *PPU) IsDoubleSpeed() bool {
+	return p.current_speed == 1
 }
-func switchSpeed() {
-	current_speed = 1 - current_speed
+func (p *PPU) switchSpeed() {
+	p.current_speed = 1 - p.current_speed
 }
 
-func GetCurrentFrame() int {
-	return current_frame
+func (p *PPU) GetCurrentFrame() int {
+	return p.current_frame
 }
 
-var DelayGUI func(delay uint32)
-var TicksGUI func() uint32
-var wait uint = 0
-
-func LCDTick() {
-	if !GetLCDCEnable() {
-		SetLY(0)
-		current_dots = 0
-		stat := getSTAT()
+func (p *PPU) LCDTick() {
+	if !p.GetLCDCEnable() {
+		p.SetLY(0)
+		p.current_dots = 0
+		stat := p.getSTAT()
 		stat &= 252
-		setSTAT(stat)
+		p.setSTAT(stat)
+		p.offTick()
 		return
 	}
-	current_dots++
-	mode := GetModeSTAT()
+	p.current_dots++
+	mode := p.GetModeSTAT()
 	switch mode {
 	case _MODE_HBLANK:
-		if current_dots >= _DOTS_PER_LINE {
-			IncrementLY()
-			current_dots = 0
-			if GetLY() >= _LY_VBLANK_START {
-				SetSTATModeVBlank()
-				interrupts.RequestInterruptVBlank()
-				if GetSTATINTVBlank() {
-					interrupts.RequestInterruptSTAT()
+		if p.current_dots >= _DOTS_PER_LINE {
+			p.IncrementLY()
+			p.current_dots = 0
+			if p.GetLY() >= _LY_VBLANK_START {
+				p.SetSTATModeVBlank()
+				p.interrupts.RequestInterruptVBlank()
+				if p.GetSTATINTVBlank() {
+					p.interrupts.RequestInterruptSTAT()
 				}
-				current_frame++
-				// ticks := TicksGUI()
-				// frame_time := ticks - prev_time
-				// if frame_time < target_time {
-				// 	// DelayGUI(target_time - frame_time)
-				// }
-				// prev_time = ticks
+				p.current_frame++
+				p.pace()
 			} else {
-				SetSTATModeOAM()
-				if GetSTATINTOAM() {
-					interrupts.RequestInterruptSTAT()
+				p.SetSTATModeOAM()
+				if p.GetSTATINTOAM() {
+					p.interrupts.RequestInterruptSTAT()
 				}
 			}
 		}
 		break
 	case _MODE_VBLANK:
-		if current_dots >= _DOTS_PER_LINE {
-			IncrementLY()
-			current_dots = 0
-			if GetLY() > _LY_VBLANK_END {
-				SetLY(0)
-				ResetWindowLineCounter()
-				SetSTATModeOAM()
-				if GetSTATINTOAM() {
-					interrupts.RequestInterruptSTAT()
+		if p.current_dots >= _DOTS_PER_LINE {
+			p.IncrementLY()
+			p.current_dots = 0
+			if p.GetLY() > _LY_VBLANK_END {
+				p.SetLY(0)
+				p.ResetWindowLineCounter()
+				p.SetSTATModeOAM()
+				if p.GetSTATINTOAM() {
+					p.interrupts.RequestInterruptSTAT()
 				}
 			}
 		}
 		break
 	case _MODE_OAM:
-		if current_dots >= _MODE_OAM_SCAN_DOTS {
-			FetcherStart()
-			SetSTATModePixelDrawing()
+		if p.current_dots >= _MODE_OAM_SCAN_DOTS {
+			p.FetcherStart()
+			p.SetSTATModePixelDrawing()
 		}
-		if current_dots == 1 {
-			FetcherOamLoad()
+		if p.current_dots == 1 {
+			p.FetcherOamLoad()
 		}
 		break
 	case _MODE_PIXEL_DRAWING:
-		FetcherTick()
+		p.FetcherTick()
 
-		if FetcherGetPushedX() >= 160 {
+		if p.FetcherGetPushedX() >= 160 {
 			// DrawScanline()
-			FetcherClearFIFO()
-			SetSTATModeHBlank()
-			HDMATransfer()
+			p.FetcherClearFIFO()
+			p.SetSTATModeHBlank()
+			p.HDMATransfer()
 			// TODO: check if necessary
-			if GetSTATINTHBlank() {
-				interrupts.RequestInterruptSTAT()
+			if p.GetSTATINTHBlank() {
+				p.interrupts.RequestInterruptSTAT()
 			}
 		}
 		break
 	default:
 		log.Fatalf("LCD tick mode not recognized %d\n", mode)
 	}
-	updateLYFlag()
+	p.updateLYFlag()
 }
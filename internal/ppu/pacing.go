@@ -0,0 +1,47 @@
+package ppu
+
+import "time"
+
+// a frame takes 70224 T-Cycles of the 4194304 Hz clock (59.73 Hz)
+const _DOTS_PER_FRAME = _DOTS_PER_LINE * (_LY_VBLANK_END + 1)
+const FRAME_DURATION = time.Second * _DOTS_PER_FRAME / 4194304
+
+// behind by more than this the emulation does not try to catch up
+// (after a pause, a breakpoint or a slow host)
+const _MAX_LAG = 5 * FRAME_DURATION
+
+// frame pacing, part of PPU
+type pacing_t struct {
+	// 1 = real time, less is slow motion, more is faster,
+	// 0 = as fast as possible (headless, tools)
+	Speed      float64
+	next_frame time.Time
+	// the lcd is off, the frames are counted anyway
+	off_dots uint
+}
+
+// pace waits until the frame is due, called at every vblank
+func (p *PPU) pace() {
+	if p.Speed <= 0 {
+		p.next_frame = time.Time{}
+		return
+	}
+	now := time.Now()
+	if p.next_frame.IsZero() || now.Sub(p.next_frame) > _MAX_LAG {
+		p.next_frame = now
+	}
+	p.next_frame = p.next_frame.Add(time.Duration(float64(FRAME_DURATION) / p.Speed))
+	if wait := p.next_frame.Sub(now); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// while the lcd is off there is no vblank, the time of a frame is
+// counted in dots instead
+func (p *PPU) offTick() {
+	p.off_dots++
+	if p.off_dots >= _DOTS_PER_FRAME {
+		p.off_dots = 0
+		p.pace()
+	}
+}
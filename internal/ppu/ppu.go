@@ -3,33 +3,50 @@ package ppu
 import (
 	"log"
 
+	"github.com/giammirove/gampboy_emulator/internal/headers"
+	"github.com/giammirove/gampboy_emulator/internal/interrupts"
 	"github.com/giammirove/gampboy_emulator/internal/utility"
 )
 
 var _COLORS [4]uint32 = [4]uint32{0xFFFFFFFF, 0xFFAAAAAA, 0xFF555555, 0xFF000000}
-var bg_colors [4]uint32
-var obp0_colors [4]uint32
-var obp1_colors [4]uint32
-var cgb_bg_colors [32]uint32
-var cgb_obp_colors [32]uint32
+
+// PPU holds the lcd registers, vram, oam, the dma and the pixel fetcher
+type PPU struct {
+	dma_t
+	fetcher_t
+	lcd_t
+
+	headers    *headers.Header
+	interrupts *interrupts.Interrupts
+
+	bg_colors      [4]uint32
+	obp0_colors    [4]uint32
+	obp1_colors    [4]uint32
+	cgb_bg_colors  [32]uint32
+	cgb_obp_colors [32]uint32
+	_VRAM          [2][_VRAM_END_ADDR - _VRAM_START_ADDR + 1]byte
+	_OAM           [_OAM_END_ADDR - _OAM_START_ADDR + 1]byte
+}
+
+// New creates the ppu connected to the other components
+func New(headers *headers.Header, interrupts *interrupts.Interrupts) *PPU {
+	return &PPU{headers: headers, interrupts: interrupts}
+}
 
 const _VRAM_START_ADDR = uint(0x8000)
 const _VRAM_END_ADDR = uint(0x9FFF)
 const _OAM_START_ADDR = uint(0xFE00)
 const _OAM_END_ADDR = uint(0xFE9F)
 
-var _VRAM [2][_VRAM_END_ADDR - _VRAM_START_ADDR + 1]byte
-var _OAM [_OAM_END_ADDR - _OAM_START_ADDR + 1]byte
-
-func Init() {
-	InitLCD()
-	InitDMA()
-	InitFetcher()
+func (p *PPU) Init() {
+	p.InitLCD()
+	p.InitDMA()
+	p.InitFetcher()
 
 	for i := 0; i < len(_COLORS); i++ {
-		bg_colors[i] = _COLORS[i]
-		obp0_colors[i] = _COLORS[i]
-		obp1_colors[i] = _COLORS[i]
+		p.bg_colors[i] = _COLORS[i]
+		p.obp0_colors[i] = _COLORS[i]
+		p.obp1_colors[i] = _COLORS[i]
 	}
 }
 
@@ -43,44 +60,44 @@ func IsInPPU(addr uint) bool {
 	return IsInVRAM(addr) || IsInPPU(addr)
 }
 
-func CanAccessVRAM() bool {
-	return GetModeSTAT() != _MODE_PIXEL_DRAWING
+func (p *PPU) CanAccessVRAM() bool {
+	return p.GetModeSTAT() != _MODE_PIXEL_DRAWING
 }
-func ReadFromVRAMMemory(addr uint, bank ...uint) byte {
+func (p *PPU) ReadFromVRAMMemory(addr uint, bank ...uint) byte {
 	if !IsInVRAM(addr) {
 		log.Fatalf("Address not in VRAM %04X\n", addr)
 	}
-	b := GetVRAMBank()
+	b := p.GetVRAMBank()
 	if len(bank) == 1 {
 		b = bank[0]
 	}
-	return _VRAM[b][addr-_VRAM_START_ADDR]
+	return p._VRAM[b][addr-_VRAM_START_ADDR]
 }
-func WriteToVRAMMemory(addr uint, value byte, bank ...uint) {
+func (p *PPU) WriteToVRAMMemory(addr uint, value byte, bank ...uint) {
 	if !IsInVRAM(addr) {
 		log.Fatalf("Address not in VRAM %04X\n", addr)
 	}
-	b := GetVRAMBank()
+	b := p.GetVRAMBank()
 	if len(bank) == 1 {
 		b = bank[0]
 	}
-	_VRAM[b][addr-_VRAM_START_ADDR] = value
+	p._VRAM[b][addr-_VRAM_START_ADDR] = value
 }
 
-func CanAccessOAM() bool {
-	return GetModeSTAT() == _MODE_HBLANK || GetModeSTAT() == _MODE_VBLANK
+func (p *PPU) CanAccessOAM() bool {
+	return p.GetModeSTAT() == _MODE_HBLANK || p.GetModeSTAT() == _MODE_VBLANK
 }
-func ReadFromOAMMemory(addr uint) byte {
+func (p *PPU) ReadFromOAMMemory(addr uint) byte {
 	if !IsInOAM(addr) {
 		log.Fatalf("Address not in OAM %04X (Read)\n", addr)
 	}
-	return _OAM[addr-_OAM_START_ADDR]
+	return p._OAM[addr-_OAM_START_ADDR]
 }
-func WriteToOAMMemory(addr uint, value byte) {
+func (p *PPU) WriteToOAMMemory(addr uint, value byte) {
 	if !IsInOAM(addr) {
 		log.Fatalf("Address not in OAM %04X (Write)\n", addr)
 	}
-	_OAM[addr-_OAM_START_ADDR] = value
+	p._OAM[addr-_OAM_START_ADDR] = value
 }
 
 func GetTileBlock(addr uint) uint {
@@ -96,29 +113,29 @@ func GetTileBlock(addr uint) uint {
 	}
 }
 
-func GetSpriteBGtoOAMPriority(addr uint) bool {
-	return utility.GetBit(GetSpriteFlags(addr), _BG_OAM_PRIOR_BIT) == 0x1
+func (p *PPU) GetSpriteBGtoOAMPriority(addr uint) bool {
+	return utility.GetBit(p.GetSpriteFlags(addr), _BG_OAM_PRIOR_BIT) == 0x1
 }
-func GetSpriteVerticalFlip(addr uint) bool {
-	return utility.GetBit(GetSpriteFlags(addr), _VERTICAL_FLIP_BIT) == 0x1
+func (p *PPU) GetSpriteVerticalFlip(addr uint) bool {
+	return utility.GetBit(p.GetSpriteFlags(addr), _VERTICAL_FLIP_BIT) == 0x1
 }
-func GetSpriteHorizontalFlip(addr uint) bool {
-	return utility.GetBit(GetSpriteFlags(addr), _HORIZONTAL_FLIP_BIT) == 0x1
+func (p *PPU) GetSpriteHorizontalFlip(addr uint) bool {
+	return utility.GetBit(p.GetSpriteFlags(addr), _HORIZONTAL_FLIP_BIT) == 0x1
 }
 
 // Non CGB mode only
-func GetSpritePaletteNumber(addr uint) bool {
-	return utility.GetBit(GetSpriteFlags(addr), _PALETTE_NUMBER_BIT) == 0x1
+func (p *PPU) GetSpritePaletteNumber(addr uint) bool {
+	return utility.GetBit(p.GetSpriteFlags(addr), _PALETTE_NUMBER_BIT) == 0x1
 }
 
 // CGB mode only
-func GetSpriteTileVRAMBankNumber(addr uint) bool {
-	return utility.GetBit(GetSpriteFlags(addr), _TILE_VRAM_BANK_NUM_BIT) == 0x1
+func (p *PPU) GetSpriteTileVRAMBankNumber(addr uint) bool {
+	return utility.GetBit(p.GetSpriteFlags(addr), _TILE_VRAM_BANK_NUM_BIT) == 0x1
 }
 
 // CGB mode only
-func GetSpriteCGBPaletteNumber(addr uint) uint {
-	return GetSpriteFlags(addr) & _CGB_PALETTE_NUM_MASK
+func (p *PPU) GetSpriteCGBPaletteNumber(addr uint) uint {
+	return p.GetSpriteFlags(addr) & _CGB_PALETTE_NUM_MASK
 }
 func GetColor(c uint) uint32 {
 	return _COLORS[c]
@@ -126,30 +143,45 @@ func GetColor(c uint) uint32 {
 func IsTransparent(val uint) bool {
 	return val == 0
 }
-func GetBGColor(c uint) uint32 {
-	return bg_colors[c]
+func (p *PPU) GetBGColor(c uint) uint32 {
+	if p.headers.IsColorized() {
+		return adjustColor(p.cgb_bg_colors[dmgShade(p.GetBGP(), c)])
+	}
+	return p.bg_colors[c]
 }
-func GetOBP0Color(c uint) uint32 {
-	return obp0_colors[c]
+func (p *PPU) GetOBP0Color(c uint) uint32 {
+	if p.headers.IsColorized() {
+		return adjustColor(p.cgb_obp_colors[dmgShade(p.GetOBP0(), c)])
+	}
+	return p.obp0_colors[c]
 }
-func GetOBP1Color(c uint) uint32 {
-	return obp1_colors[c]
+func (p *PPU) GetOBP1Color(c uint) uint32 {
+	if p.headers.IsColorized() {
+		return adjustColor(p.cgb_obp_colors[4+dmgShade(p.GetOBP1(), c)])
+	}
+	return p.obp1_colors[c]
+}
+
+// index of color c in a dmg palette, the colorized roms use it in the
+// first cgb palettes (bg 0, obj 0 and 1)
+func dmgShade(palette uint, c uint) uint {
+	return (palette >> (c * 2)) & 0x3
 }
 
-func GetCGBBGColor(tile_addr uint, index uint) uint32 {
+func (p *PPU) GetCGBBGColor(tile_addr uint, index uint) uint32 {
 	// if !CanAccessVRAM() {
 	// 	return 0xFFFFFFFF
 	// }
-	return adjustColor(cgb_bg_colors[GetCGBBGPaletteNumber(tile_addr)*4+index])
+	return adjustColor(p.cgb_bg_colors[p.GetCGBBGPaletteNumber(tile_addr)*4+index])
 }
-func GetCGBBGPaletteNumber(tile_addr uint) uint {
-	return uint(ReadFromVRAMMemory(tile_addr, 1)) & _CGB_PALETTE_NUM_MASK
+func (p *PPU) GetCGBBGPaletteNumber(tile_addr uint) uint {
+	return uint(p.ReadFromVRAMMemory(tile_addr, 1)) & _CGB_PALETTE_NUM_MASK
 }
-func GetCGBOBPColor(obp_addr uint, index uint) uint32 {
+func (p *PPU) GetCGBOBPColor(obp_addr uint, index uint) uint32 {
 	// if !CanAccessVRAM() {
 	// 	return 0xFFFFFFFF
 	// }
-	return adjustColor(cgb_obp_colors[GetSpriteCGBPaletteNumber(obp_addr)*4+index])
+	return adjustColor(p.cgb_obp_colors[p.GetSpriteCGBPaletteNumber(obp_addr)*4+index])
 }
 func adjustColor(color uint32) uint32 {
 
@@ -164,6 +196,33 @@ func adjustColor(color uint32) uint32 {
 	return new_red<<16 | new_green<<8 | new_blue
 }
 
+// RawColor is the inverse of adjustColor, it gives back the 15 bit color
+// (xBBBBBGGGGGRRRRR) from a pixel of the cgb buffer
+func RawColor(color uint32) uint32 {
+	red := ((color >> 16) & 0xFF) >> 3
+	green := ((color >> 8) & 0xFF) >> 3
+	blue := (color & 0xFF) >> 3
+	return blue<<10 | green<<5 | red
+}
+
+// Shade gives the index in _COLORS of the closest dmg color
+func Shade(color uint32) uint {
+	gray := ((color>>16)&0xFF + (color>>8)&0xFF + color&0xFF) / 3
+	best := uint(0)
+	best_distance := uint32(0xFFFF)
+	for i, c := range _COLORS {
+		distance := c&0xFF - gray
+		if gray > c&0xFF {
+			distance = gray - c&0xFF
+		}
+		if distance < best_distance {
+			best = uint(i)
+			best_distance = distance
+		}
+	}
+	return best
+}
+
 func min(a uint32, b uint32) uint32 {
 	if a < b {
 		return a
@@ -174,8 +233,8 @@ func min(a uint32, b uint32) uint32 {
 // value is made like this : ZZWWYYXX
 // where XX is 0-3 index for color 0
 // etc ...
-func UpdatePalette(_colors *([4]uint32), value uint) {
-	if !CanAccessVRAM() {
+func (p *PPU) UpdatePalette(_colors *([4]uint32), value uint) {
+	if !p.CanAccessVRAM() {
 		return
 	}
 	for i := 0; i < len(*_colors); i++ {
@@ -185,13 +244,13 @@ func UpdatePalette(_colors *([4]uint32), value uint) {
 	}
 }
 
-func UpdateCGBPalette(_colors *([32]uint32), value uint32) {
-	if !CanAccessVRAM() {
+func (p *PPU) UpdateCGBPalette(_colors *([32]uint32), value uint32) {
+	if !p.CanAccessVRAM() {
 		return
 	}
-	addr := GetBGPIAddress()
-	if _colors == &cgb_obp_colors {
-		addr = GetOBPIAddress()
+	addr := p.GetBGPIAddress()
+	if _colors == &p.cgb_obp_colors {
+		addr = p.GetOBPIAddress()
 	}
 	// coloring lower byte
 	if addr&1 == 0 {
@@ -203,35 +262,35 @@ func UpdateCGBPalette(_colors *([32]uint32), value uint32) {
 		b := (value&0b01111100)>>2 | (*_colors)[addr/2]&0xFF
 		(*_colors)[addr/2] |= g<<8 | b
 	}
-	if _colors == &cgb_bg_colors && GetBGPIAutoIncrement() {
-		IncBGPI()
+	if _colors == &p.cgb_bg_colors && p.GetBGPIAutoIncrement() {
+		p.IncBGPI()
 	}
-	if _colors == &cgb_obp_colors && GetOBPIAutoIncrement() {
-		IncOBPI()
+	if _colors == &p.cgb_obp_colors && p.GetOBPIAutoIncrement() {
+		p.IncOBPI()
 	}
 }
-func GetCGBBGPriority(tile_addr uint) bool {
-	return utility.GetBit(uint(ReadFromVRAMMemory(tile_addr, 1)), _BG_OAM_PRIOR_BIT) == 0x1
+func (p *PPU) GetCGBBGPriority(tile_addr uint) bool {
+	return utility.GetBit(uint(p.ReadFromVRAMMemory(tile_addr, 1)), _BG_OAM_PRIOR_BIT) == 0x1
 }
-func GetCGBBGVRAMBank(tile_addr uint) bool {
-	return utility.GetBit(uint(ReadFromVRAMMemory(tile_addr, 1)), _TILE_VRAM_BANK_NUM_BIT) == 0x1
+func (p *PPU) GetCGBBGVRAMBank(tile_addr uint) bool {
+	return utility.GetBit(uint(p.ReadFromVRAMMemory(tile_addr, 1)), _TILE_VRAM_BANK_NUM_BIT) == 0x1
 }
-func GetCGBBGVerticalFlip(tile_addr uint) bool {
-	return utility.GetBit(uint(ReadFromVRAMMemory(tile_addr, 1)), _VERTICAL_FLIP_BIT) == 0x1
+func (p *PPU) GetCGBBGVerticalFlip(tile_addr uint) bool {
+	return utility.GetBit(uint(p.ReadFromVRAMMemory(tile_addr, 1)), _VERTICAL_FLIP_BIT) == 0x1
 }
-func GetCGBBGHorizontalFlip(tile_addr uint) bool {
-	return utility.GetBit(uint(ReadFromVRAMMemory(tile_addr, 1)), _HORIZONTAL_FLIP_BIT) == 0x1
+func (p *PPU) GetCGBBGHorizontalFlip(tile_addr uint) bool {
+	return utility.GetBit(uint(p.ReadFromVRAMMemory(tile_addr, 1)), _HORIZONTAL_FLIP_BIT) == 0x1
 }
 
-func GetSpriteYPosition(addr uint) uint {
-	return uint(ReadFromOAMMemory(addr + _Y_POS_BYTE))
+func (p *PPU) GetSpriteYPosition(addr uint) uint {
+	return uint(p.ReadFromOAMMemory(addr + _Y_POS_BYTE))
 }
-func GetSpriteXPosition(addr uint) uint {
-	return uint(ReadFromOAMMemory(addr + _X_POS_BYTE))
+func (p *PPU) GetSpriteXPosition(addr uint) uint {
+	return uint(p.ReadFromOAMMemory(addr + _X_POS_BYTE))
 }
-func GetSpriteTileIndex(addr uint) uint {
-	return uint(ReadFromOAMMemory(addr + _TILE_INDEX_BYTE))
+func (p *PPU) GetSpriteTileIndex(addr uint) uint {
+	return uint(p.ReadFromOAMMemory(addr + _TILE_INDEX_BYTE))
 }
-func GetSpriteFlags(addr uint) uint {
-	return uint(ReadFromOAMMemory(addr + _FLAGS_BYTE))
+func (p *PPU) GetSpriteFlags(addr uint) uint {
+	return uint(p.ReadFromOAMMemory(addr + _FLAGS_BYTE))
 }
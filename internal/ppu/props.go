@@ -3,8 +3,6 @@ package ppu
 import (
 	"log"
 
-	"github.com/giammirove/gampboy_emulator/internal/headers"
-	"github.com/giammirove/gampboy_emulator/internal/interrupts"
 	"github.com/giammirove/gampboy_emulator/internal/utility"
 )
 
@@ -104,275 +102,275 @@ const _TILE_BYTES = 16
 const _TILE_W = 8
 const _TILE_H = 8
 
-func getLCDC() uint {
-	return ReadFromLCDMemory(_LCDC)
+func (p *PPU) getLCDC() uint {
+	return p.ReadFromLCDMemory(_LCDC)
 }
 
-func GetLCDCEnable() bool {
-	return utility.GetBit(getLCDC(), _LCDC_LCD_ENABLE_BIT) == 0x1
+func (p *PPU) GetLCDCEnable() bool {
+	return utility.GetBit(p.getLCDC(), _LCDC_LCD_ENABLE_BIT) == 0x1
 }
-func GetLCDCWinTileMapDisplay() bool {
-	return utility.GetBit(getLCDC(), _LCDC_WIN_TILE_MAP_DISPLAY_BIT) == 0x1
+func (p *PPU) GetLCDCWinTileMapDisplay() bool {
+	return utility.GetBit(p.getLCDC(), _LCDC_WIN_TILE_MAP_DISPLAY_BIT) == 0x1
 }
-func GetLCDCWinDisplay() bool {
-	return utility.GetBit(getLCDC(), _LCDC_WIN_DISPLAY_BIT) == 0x1
+func (p *PPU) GetLCDCWinDisplay() bool {
+	return utility.GetBit(p.getLCDC(), _LCDC_WIN_DISPLAY_BIT) == 0x1
 }
-func GetLCDCBGWinTileDataArea() bool {
-	return utility.GetBit(getLCDC(), _LCDC_BG_TILE_DATA_BIT) == 0x1
+func (p *PPU) GetLCDCBGWinTileDataArea() bool {
+	return utility.GetBit(p.getLCDC(), _LCDC_BG_TILE_DATA_BIT) == 0x1
 }
-func GetLCDCBGTileMapDisplayArea() bool {
-	return utility.GetBit(getLCDC(), _LCDC_BG_TILE_MAP_DISPLAY_BIT) == 0x1
+func (p *PPU) GetLCDCBGTileMapDisplayArea() bool {
+	return utility.GetBit(p.getLCDC(), _LCDC_BG_TILE_MAP_DISPLAY_BIT) == 0x1
 }
-func GetLCDCOBJSize() bool {
-	return utility.GetBit(getLCDC(), _LCDC_OBJ_SIZE_BIT) == 0x1
+func (p *PPU) GetLCDCOBJSize() bool {
+	return utility.GetBit(p.getLCDC(), _LCDC_OBJ_SIZE_BIT) == 0x1
 }
-func GetLCDCOBJDisplay() bool {
-	return utility.GetBit(getLCDC(), _LCDC_OBJ_DISPLAY_BIT) == 0x1
+func (p *PPU) GetLCDCOBJDisplay() bool {
+	return utility.GetBit(p.getLCDC(), _LCDC_OBJ_DISPLAY_BIT) == 0x1
 }
-func GetLCDCBGWinDisplay() bool {
-	return utility.GetBit(getLCDC(), _LCDC_BG_DISPLAY_BIT) == 0x1
+func (p *PPU) GetLCDCBGWinDisplay() bool {
+	return utility.GetBit(p.getLCDC(), _LCDC_BG_DISPLAY_BIT) == 0x1
 }
-func GetLCDCMasterPriority() bool {
-	return headers.IsCGB() && !GetLCDCBGWinDisplay()
+func (p *PPU) GetLCDCMasterPriority() bool {
+	return p.headers.IsCGB() && !p.GetLCDCBGWinDisplay()
 }
 
-func getSTAT() uint {
-	return ReadFromLCDMemory(_STAT)
+func (p *PPU) getSTAT() uint {
+	return p.ReadFromLCDMemory(_STAT)
 }
-func setSTAT(val uint) {
-	lcd_registers[_STAT-_REGISTER_BASE] = val
+func (p *PPU) setSTAT(val uint) {
+	p.lcd_registers[_STAT-_REGISTER_BASE] = val
 }
-func GetModeSTAT() uint {
-	return getSTAT() & _STAT_MODE_MASK
+func (p *PPU) GetModeSTAT() uint {
+	return p.getSTAT() & _STAT_MODE_MASK
 }
-func setSTATMode(mode uint) {
+func (p *PPU) setSTATMode(mode uint) {
 	// clear the previous one
-	_stat := getSTAT()
+	_stat := p.getSTAT()
 	_stat &= ^_STAT_MODE_MASK
 	_stat |= mode
-	setSTAT(_stat)
+	p.setSTAT(_stat)
 }
-func resetSTATMode() {
+func (p *PPU) resetSTATMode() {
 	// the first one to be executed
-	SetSTATModeOAM()
+	p.SetSTATModeOAM()
 }
-func SetSTATModeVBlank() {
-	setSTATMode(_MODE_VBLANK)
+func (p *PPU) SetSTATModeVBlank() {
+	p.setSTATMode(_MODE_VBLANK)
 }
-func SetSTATModeHBlank() {
-	setSTATMode(_MODE_HBLANK)
+func (p *PPU) SetSTATModeHBlank() {
+	p.setSTATMode(_MODE_HBLANK)
 }
-func SetSTATModeOAM() {
-	setSTATMode(_MODE_OAM)
+func (p *PPU) SetSTATModeOAM() {
+	p.setSTATMode(_MODE_OAM)
 }
-func SetSTATModePixelDrawing() {
-	setSTATMode(_MODE_PIXEL_DRAWING)
+func (p *PPU) SetSTATModePixelDrawing() {
+	p.setSTATMode(_MODE_PIXEL_DRAWING)
 }
-func GetSTATINTLY() bool {
-	return utility.GetBit(getSTAT(), _STAT_INT_LY_BIT) == 0x1
+func (p *PPU) GetSTATINTLY() bool {
+	return utility.GetBit(p.getSTAT(), _STAT_INT_LY_BIT) == 0x1
 }
-func SetSTATINTLY(val uint) {
-	setSTAT(utility.WriteBit(getSTAT(), _STAT_INT_LY_BIT, val))
+func (p *PPU) SetSTATINTLY(val uint) {
+	p.setSTAT(utility.WriteBit(p.getSTAT(), _STAT_INT_LY_BIT, val))
 }
-func GetSTATINTOAM() bool {
-	return utility.GetBit(getSTAT(), _STAT_INT_OAM_BIT) == 0x1
+func (p *PPU) GetSTATINTOAM() bool {
+	return utility.GetBit(p.getSTAT(), _STAT_INT_OAM_BIT) == 0x1
 }
-func SetSTATINTOAM(val uint) {
-	setSTAT(utility.WriteBit(getSTAT(), _STAT_INT_OAM_BIT, val))
+func (p *PPU) SetSTATINTOAM(val uint) {
+	p.setSTAT(utility.WriteBit(p.getSTAT(), _STAT_INT_OAM_BIT, val))
 
 }
-func GetSTATINTVBlank() bool {
-	return utility.GetBit(getSTAT(), _STAT_INT_VBLANK_BIT) == 0x1
+func (p *PPU) GetSTATINTVBlank() bool {
+	return utility.GetBit(p.getSTAT(), _STAT_INT_VBLANK_BIT) == 0x1
 }
-func SetSTATINTVBlank(val uint) {
-	setSTAT(utility.WriteBit(getSTAT(), _STAT_INT_VBLANK_BIT, val))
+func (p *PPU) SetSTATINTVBlank(val uint) {
+	p.setSTAT(utility.WriteBit(p.getSTAT(), _STAT_INT_VBLANK_BIT, val))
 }
-func GetSTATINTHBlank() bool {
-	return utility.GetBit(getSTAT(), _STAT_INT_HBLANK_BIT) == 0x1
+func (p *PPU) GetSTATINTHBlank() bool {
+	return utility.GetBit(p.getSTAT(), _STAT_INT_HBLANK_BIT) == 0x1
 }
-func SetSTATINTHBlank(val uint) {
-	setSTAT(utility.WriteBit(getSTAT(), _STAT_INT_HBLANK_BIT, val))
+func (p *PPU) SetSTATINTHBlank(val uint) {
+	p.setSTAT(utility.WriteBit(p.getSTAT(), _STAT_INT_HBLANK_BIT, val))
 }
-func GetSTATLYFlag() bool {
-	return utility.GetBit(getSTAT(), _STAT_LY_FLAG_BIT) == 0x1
+func (p *PPU) GetSTATLYFlag() bool {
+	return utility.GetBit(p.getSTAT(), _STAT_LY_FLAG_BIT) == 0x1
 }
-func SetSTATLYFlag(val uint) {
-	setSTAT(utility.WriteBit(getSTAT(), _STAT_LY_FLAG_BIT, val))
+func (p *PPU) SetSTATLYFlag(val uint) {
+	p.setSTAT(utility.WriteBit(p.getSTAT(), _STAT_LY_FLAG_BIT, val))
 }
 
-func GetSCY() uint {
-	return ReadFromLCDMemory(_SCY)
+func (p *PPU) GetSCY() uint {
+	return p.ReadFromLCDMemory(_SCY)
 }
-func SetSCY(val uint) {
-	WriteToLCDMemory(_SCY, val)
+func (p *PPU) SetSCY(val uint) {
+	p.WriteToLCDMemory(_SCY, val)
 }
-func GetSCX() uint {
-	return ReadFromLCDMemory(_SCX)
+func (p *PPU) GetSCX() uint {
+	return p.ReadFromLCDMemory(_SCX)
 }
-func SetSCX(val uint) {
-	WriteToLCDMemory(_SCX, val)
+func (p *PPU) SetSCX(val uint) {
+	p.WriteToLCDMemory(_SCX, val)
 }
-func GetLY() uint {
-	return ReadFromLCDMemory(_LY)
+func (p *PPU) GetLY() uint {
+	return p.ReadFromLCDMemory(_LY)
 }
-func SetLY(val uint) {
-	WriteToLCDMemory(_LY, val)
+func (p *PPU) SetLY(val uint) {
+	p.WriteToLCDMemory(_LY, val)
 }
-func IncrementLY() {
-	SetLY(GetLY() + 1)
-	IncrementWindowLineCounter()
+func (p *PPU) IncrementLY() {
+	p.SetLY(p.GetLY() + 1)
+	p.IncrementWindowLineCounter()
 }
-func updateLYFlag() {
-	prev := GetSTATLYFlag()
-	if GetLY() == GetLYC() {
+func (p *PPU) updateLYFlag() {
+	prev := p.GetSTATLYFlag()
+	if p.GetLY() == p.GetLYC() {
 		// interrupt
-		SetSTATLYFlag(1)
+		p.SetSTATLYFlag(1)
 		// if interrupt is enabled
-		if GetSTATINTLY() && !prev {
-			interrupts.RequestInterruptSTAT()
-			prev = GetLY() == GetLYC()
+		if p.GetSTATINTLY() && !prev {
+			p.interrupts.RequestInterruptSTAT()
+			prev = p.GetLY() == p.GetLYC()
 		}
 	} else {
-		SetSTATLYFlag(0)
+		p.SetSTATLYFlag(0)
 	}
 }
-func GetLYC() uint {
-	return ReadFromLCDMemory(_LYC)
+func (p *PPU) GetLYC() uint {
+	return p.ReadFromLCDMemory(_LYC)
 }
-func SetLYC(val uint) {
-	WriteToLCDMemory(_LYC, val)
+func (p *PPU) SetLYC(val uint) {
+	p.WriteToLCDMemory(_LYC, val)
 }
-func GetDMA() uint {
-	return ReadFromLCDMemory(_DMA)
+func (p *PPU) GetDMA() uint {
+	return p.ReadFromLCDMemory(_DMA)
 }
-func SetDMA(val uint) {
-	WriteToLCDMemory(_DMA, val)
+func (p *PPU) SetDMA(val uint) {
+	p.WriteToLCDMemory(_DMA, val)
 }
-func GetHDMA1() uint {
-	return ReadFromLCDMemory(_HDMA1)
+func (p *PPU) GetHDMA1() uint {
+	return p.ReadFromLCDMemory(_HDMA1)
 }
-func SetHDMA1(val uint) {
-	WriteToLCDMemory(_HDMA1, val)
+func (p *PPU) SetHDMA1(val uint) {
+	p.WriteToLCDMemory(_HDMA1, val)
 }
-func GetHDMA2() uint {
-	return ReadFromLCDMemory(_HDMA2)
+func (p *PPU) GetHDMA2() uint {
+	return p.ReadFromLCDMemory(_HDMA2)
 }
-func SetHDMA2(val uint) {
-	WriteToLCDMemory(_HDMA2, val)
+func (p *PPU) SetHDMA2(val uint) {
+	p.WriteToLCDMemory(_HDMA2, val)
 }
-func GetHDMA3() uint {
-	return ReadFromLCDMemory(_HDMA3)
+func (p *PPU) GetHDMA3() uint {
+	return p.ReadFromLCDMemory(_HDMA3)
 }
-func SetHDMA3(val uint) {
-	WriteToLCDMemory(_HDMA3, val)
+func (p *PPU) SetHDMA3(val uint) {
+	p.WriteToLCDMemory(_HDMA3, val)
 }
-func GetHDMA4() uint {
-	return ReadFromLCDMemory(_HDMA4)
+func (p *PPU) GetHDMA4() uint {
+	return p.ReadFromLCDMemory(_HDMA4)
 }
-func SetHDMA4(val uint) {
-	WriteToLCDMemory(_HDMA4, val)
+func (p *PPU) SetHDMA4(val uint) {
+	p.WriteToLCDMemory(_HDMA4, val)
 }
-func GetHDMA5() uint {
-	return ReadFromLCDMemory(_HDMA5)
+func (p *PPU) GetHDMA5() uint {
+	return p.ReadFromLCDMemory(_HDMA5)
 }
-func SetHDM5(val uint) {
-	WriteToLCDMemory(_HDMA5, val)
+func (p *PPU) SetHDM5(val uint) {
+	p.WriteToLCDMemory(_HDMA5, val)
 	log.Printf("hdm5 -> %04X\n", val)
 }
-func ResetHDM5() {
-	lcd_registers[_HDMA5-_REGISTER_BASE] = 0xFF
+func (p *PPU) ResetHDM5() {
+	p.lcd_registers[_HDMA5-_REGISTER_BASE] = 0xFF
 }
-func UpdateDMALength(leng uint) {
+func (p *PPU) UpdateDMALength(leng uint) {
 	// TODO : check this one
 	// hdma5 := GetHDMA5()
 	// mode := hdma5 & 0b10000000
-	lcd_registers[_HDMA5-_REGISTER_BASE] = leng & 0x7F
+	p.lcd_registers[_HDMA5-_REGISTER_BASE] = leng & 0x7F
 }
-func GetDMALength() uint {
-	return (GetHDMA5()&0x7F + 1) * 0x10
+func (p *PPU) GetDMALength() uint {
+	return (p.GetHDMA5()&0x7F + 1) * 0x10
 }
-func GetBGP() uint {
-	return ReadFromLCDMemory(_BGP)
+func (p *PPU) GetBGP() uint {
+	return p.ReadFromLCDMemory(_BGP)
 }
-func SetBGP(val uint) {
-	WriteToLCDMemory(_BGP, val)
+func (p *PPU) SetBGP(val uint) {
+	p.WriteToLCDMemory(_BGP, val)
 }
-func GetOBP0() uint {
-	return ReadFromLCDMemory(_OBP0)
+func (p *PPU) GetOBP0() uint {
+	return p.ReadFromLCDMemory(_OBP0)
 }
-func SetOBP0(val uint) {
-	WriteToLCDMemory(_OBP0, val)
+func (p *PPU) SetOBP0(val uint) {
+	p.WriteToLCDMemory(_OBP0, val)
 }
-func GetOBP1() uint {
-	return ReadFromLCDMemory(_OBP1)
+func (p *PPU) GetOBP1() uint {
+	return p.ReadFromLCDMemory(_OBP1)
 }
-func SetOBP1(val uint) {
-	WriteToLCDMemory(_OBP1, val)
+func (p *PPU) SetOBP1(val uint) {
+	p.WriteToLCDMemory(_OBP1, val)
 }
-func GetWY() uint {
-	return ReadFromLCDMemory(_WY)
+func (p *PPU) GetWY() uint {
+	return p.ReadFromLCDMemory(_WY)
 }
-func SetWY(val uint) {
-	WriteToLCDMemory(_WY, val)
+func (p *PPU) SetWY(val uint) {
+	p.WriteToLCDMemory(_WY, val)
 }
-func GetWX() uint {
-	return ReadFromLCDMemory(_WX)
+func (p *PPU) GetWX() uint {
+	return p.ReadFromLCDMemory(_WX)
 }
-func SetWX(val uint) {
-	WriteToLCDMemory(_WX, val)
+func (p *PPU) SetWX(val uint) {
+	p.WriteToLCDMemory(_WX, val)
 }
 
-func GetBGPI() uint {
-	return ReadFromLCDMemory(_BGPI)
+func (p *PPU) GetBGPI() uint {
+	return p.ReadFromLCDMemory(_BGPI)
 }
-func GetBGPIAutoIncrement() bool {
-	return utility.GetBit(GetBGPI(), _BGPI_AUTO_INCREMENT_BIT) == 0x1
+func (p *PPU) GetBGPIAutoIncrement() bool {
+	return utility.GetBit(p.GetBGPI(), _BGPI_AUTO_INCREMENT_BIT) == 0x1
 }
-func GetBGPIAddress() uint {
-	return GetBGPI() & _BGPI_ADDRESS_MASK
+func (p *PPU) GetBGPIAddress() uint {
+	return p.GetBGPI() & _BGPI_ADDRESS_MASK
 }
-func SetBGPI(val uint) {
-	WriteToLCDMemory(_BGPI, val)
+func (p *PPU) SetBGPI(val uint) {
+	p.WriteToLCDMemory(_BGPI, val)
 }
-func IncBGPI() {
-	val := GetBGPI()
-	SetBGPI(val&0b10000000 | (val&0b01111111 + 1))
+func (p *PPU) IncBGPI() {
+	val := p.GetBGPI()
+	p.SetBGPI(val&0b10000000 | (val&0b01111111 + 1))
 }
-func GetBGPD() uint {
-	return ReadFromLCDMemory(_BGPD)
+func (p *PPU) GetBGPD() uint {
+	return p.ReadFromLCDMemory(_BGPD)
 }
-func SetBGPD(val uint) {
-	WriteToLCDMemory(_BGPD, val)
+func (p *PPU) SetBGPD(val uint) {
+	p.WriteToLCDMemory(_BGPD, val)
 }
-func GetOBPI() uint {
-	return ReadFromLCDMemory(_OBPI)
+func (p *PPU) GetOBPI() uint {
+	return p.ReadFromLCDMemory(_OBPI)
 }
-func GetOBPIAutoIncrement() bool {
-	return utility.GetBit(GetOBPI(), _BGPI_AUTO_INCREMENT_BIT) == 0x1
+func (p *PPU) GetOBPIAutoIncrement() bool {
+	return utility.GetBit(p.GetOBPI(), _BGPI_AUTO_INCREMENT_BIT) == 0x1
 }
-func GetOBPIAddress() uint {
-	return GetOBPI() & _BGPI_ADDRESS_MASK
+func (p *PPU) GetOBPIAddress() uint {
+	return p.GetOBPI() & _BGPI_ADDRESS_MASK
 }
-func SetOBPI(val uint) {
-	WriteToLCDMemory(_OBPI, val)
+func (p *PPU) SetOBPI(val uint) {
+	p.WriteToLCDMemory(_OBPI, val)
 }
-func IncOBPI() {
-	val := GetOBPI()
-	SetOBPI(val&0b10000000 | (val&0b01111111 + 1))
+func (p *PPU) IncOBPI() {
+	val := p.GetOBPI()
+	p.SetOBPI(val&0b10000000 | (val&0b01111111 + 1))
 }
-func GetVRAMBank() uint {
-	if headers.IsCGB() {
-		return ReadFromLCDMemory(_VBK) & 1
+func (p *PPU) GetVRAMBank() uint {
+	if p.headers.IsCGB() {
+		return p.ReadFromLCDMemory(_VBK) & 1
 	} else {
 		return 0x00
 	}
 }
-func SetVRAMBank(val uint) {
-	WriteToLCDMemory(_VBK, val)
+func (p *PPU) SetVRAMBank(val uint) {
+	p.WriteToLCDMemory(_VBK, val)
 }
-func GetWRAMBank() uint {
-	if headers.IsCGB() {
-		r := ReadFromLCDMemory(_SVBK) & 0b111
+func (p *PPU) GetWRAMBank() uint {
+	if p.headers.IsCGB() {
+		r := p.ReadFromLCDMemory(_SVBK) & 0b111
 		if r == 0 {
 			r = 1
 		}
@@ -381,6 +379,6 @@ func GetWRAMBank() uint {
 		return 0x00
 	}
 }
-func SetWRAMBank(val uint) {
-	WriteToLCDMemory(_SVBK, val)
+func (p *PPU) SetWRAMBank(val uint) {
+	p.WriteToLCDMemory(_SVBK, val)
 }
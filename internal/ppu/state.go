@@ -0,0 +1,84 @@
+package ppu
+
+import (
+	"encoding/gob"
+
+	"github.com/giammirove/gampboy_emulator/internal/utility"
+)
+
+func (p *PPU) SaveState(enc *gob.Encoder) error {
+	// memory and palettes
+	err := utility.EncodeAll(enc, p._VRAM, p._OAM, p.bg_colors, p.obp0_colors, p.obp1_colors, p.cgb_bg_colors, p.cgb_obp_colors)
+	if err != nil {
+		return err
+	}
+	// lcd
+	err = utility.EncodeAll(enc, p.lcd_registers, p.current_dots, p.current_frame, p.current_speed)
+	if err != nil {
+		return err
+	}
+	// dma and hdma
+	err = utility.EncodeAll(enc, p.dma_old, p.dma_delay, p.dma_transferring, p.current_byte,
+		p.is_new_dma, p.new_dma_delay, p.new_current_byte, p.new_dma_transferring, p.new_dma_value,
+		p.new_dma_source, p.new_dma_dest, p.new_dma_len, p.new_dma_mode, p.new_dma_vram_bank, p.new_dma_wram_bank)
+	if err != nil {
+		return err
+	}
+	// fetcher
+	err = utility.EncodeAll(enc, p.buffer, p.fetcher_x, p.tile_id, p.tile_addr, p.bg_bank, p.bg_tilemap, p.window_tilemap, p.tiledata_base,
+		p.map_x, p.map_y, p.win_x, p.win_y, p.tile_x, p.tile_y, p.line_x, p.buffered_x, p.fifo_x, p.bg_pixels,
+		p.fifo_array, p.fifo_len, p.fifo_front, p.fifo_back, p.sprite_pixels,
+		p.sprites_on_line, p.sprites_on_line_len, p.sprites_map, p.bg_priority, p.bg_transparent,
+		p.state, p.ticks, p.window_line_counter)
+	if err != nil {
+		return err
+	}
+	if err := enc.Encode(len(p.sprite_tiles)); err != nil {
+		return err
+	}
+	for _, s := range p.sprite_tiles {
+		err := utility.EncodeAll(enc, s.addr, s.x, s.y, s.tile_index, s.horizontal_flip, s.vertical_flip, s.bg_priority, s.palette, s.cgb_palette)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PPU) LoadState(dec *gob.Decoder) error {
+	err := utility.DecodeAll(dec, &p._VRAM, &p._OAM, &p.bg_colors, &p.obp0_colors, &p.obp1_colors, &p.cgb_bg_colors, &p.cgb_obp_colors)
+	if err != nil {
+		return err
+	}
+	err = utility.DecodeAll(dec, &p.lcd_registers, &p.current_dots, &p.current_frame, &p.current_speed)
+	if err != nil {
+		return err
+	}
+	err = utility.DecodeAll(dec, &p.dma_old, &p.dma_delay, &p.dma_transferring, &p.current_byte,
+		&p.is_new_dma, &p.new_dma_delay, &p.new_current_byte, &p.new_dma_transferring, &p.new_dma_value,
+		&p.new_dma_source, &p.new_dma_dest, &p.new_dma_len, &p.new_dma_mode, &p.new_dma_vram_bank, &p.new_dma_wram_bank)
+	if err != nil {
+		return err
+	}
+	err = utility.DecodeAll(dec, &p.buffer, &p.fetcher_x, &p.tile_id, &p.tile_addr, &p.bg_bank, &p.bg_tilemap, &p.window_tilemap, &p.tiledata_base,
+		&p.map_x, &p.map_y, &p.win_x, &p.win_y, &p.tile_x, &p.tile_y, &p.line_x, &p.buffered_x, &p.fifo_x, &p.bg_pixels,
+		&p.fifo_array, &p.fifo_len, &p.fifo_front, &p.fifo_back, &p.sprite_pixels,
+		&p.sprites_on_line, &p.sprites_on_line_len, &p.sprites_map, &p.bg_priority, &p.bg_transparent,
+		&p.state, &p.ticks, &p.window_line_counter)
+	if err != nil {
+		return err
+	}
+	var n int
+	if err := dec.Decode(&n); err != nil {
+		return err
+	}
+	p.sprite_tiles = make([]sprite_t, n)
+	for i := range p.sprite_tiles {
+		s := &p.sprite_tiles[i]
+		err := utility.DecodeAll(dec, &s.addr, &s.x, &s.y, &s.tile_index, &s.horizontal_flip, &s.vertical_flip, &s.bg_priority, &s.palette, &s.cgb_palette)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
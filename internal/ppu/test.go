@@ -1,13 +0,0 @@
-package ppu
-
-import "fmt"
-
-func Test() {
-
-	SetSTATModeHBlank()
-	fmt.Println(GetModeSTAT())
-	SetSTATModeVBlank()
-	fmt.Println(GetModeSTAT())
-	SetSTATModeOAM()
-	fmt.Println(GetModeSTAT())
-}
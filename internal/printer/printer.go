@@ -0,0 +1,298 @@
+// Package printer emulates the Game Boy Printer plugged in the link port
+package printer
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// every packet is
+// 0x88 0x33 | command | compression | length (LE) | data | checksum (LE) | 0x00 0x00
+// the printer answers the last two bytes with its id and its status
+const _MAGIC_0 = 0x88
+const _MAGIC_1 = 0x33
+
+const (
+	_CMD_INIT   = 0x01
+	_CMD_PRINT  = 0x02
+	_CMD_DATA   = 0x04
+	_CMD_STATUS = 0x0F
+)
+
+const _ALIVE = 0x81
+
+// status bits
+const (
+	_STATUS_CHECKSUM   = 0x01
+	_STATUS_BUSY       = 0x02
+	_STATUS_FULL       = 0x04
+	_STATUS_UNPRINTED  = 0x08
+	_STATUS_PACKET_ERR = 0x10
+)
+
+// the paper is 20 tiles wide, a DATA packet holds 2 rows of tiles
+const _TILES_PER_ROW = 20
+const _TILE_BYTES = 16
+const _WIDTH = _TILES_PER_ROW * 8
+const _ROW_BYTES = _TILES_PER_ROW * _TILE_BYTES
+const _MAX_DATA = 9 * 2 * _ROW_BYTES
+
+// STATUS packets answered busy after a print
+const _BUSY_PACKETS = 2
+
+var _SHADES = [4]uint8{0xFF, 0xAA, 0x55, 0x00}
+
+// position in the packet
+const (
+	_STATE_MAGIC_0 = iota
+	_STATE_MAGIC_1
+	_STATE_COMMAND
+	_STATE_COMPRESSION
+	_STATE_LENGTH_LO
+	_STATE_LENGTH_HI
+	_STATE_DATA
+	_STATE_CHECKSUM_LO
+	_STATE_CHECKSUM_HI
+	_STATE_ALIVE
+	_STATE_STATUS
+)
+
+// Printer is a serial.SerialDevice, the printed images are
+// written as png in a directory
+type Printer struct {
+	dir string
+
+	state       int
+	command     uint8
+	compression uint8
+	length      uint16
+	data        []uint8
+	checksum    uint16
+	sum         uint16
+
+	status uint8
+	busy   int
+	// tiles received since the last print
+	buffer []uint8
+	// shades of the current sheet, it grows until a margin is fed
+	paper  []uint8
+	sheet  string
+	sheets int
+}
+
+// New creates a printer that saves its images in dir
+func New(dir string) (*Printer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Printer{dir: dir}, nil
+}
+
+// Transfer shifts one byte of the packet, the clock is not relevant
+func (p *Printer) Transfer(value uint8, fast bool) uint8 {
+	switch p.state {
+	case _STATE_MAGIC_0:
+		if value == _MAGIC_0 {
+			p.state = _STATE_MAGIC_1
+		}
+	case _STATE_MAGIC_1:
+		if value == _MAGIC_1 {
+			p.state = _STATE_COMMAND
+		} else {
+			p.state = _STATE_MAGIC_0
+		}
+	case _STATE_COMMAND:
+		p.command = value
+		p.sum = uint16(value)
+		p.state = _STATE_COMPRESSION
+	case _STATE_COMPRESSION:
+		p.compression = value
+		p.sum += uint16(value)
+		p.state = _STATE_LENGTH_LO
+	case _STATE_LENGTH_LO:
+		p.length = uint16(value)
+		p.sum += uint16(value)
+		p.state = _STATE_LENGTH_HI
+	case _STATE_LENGTH_HI:
+		p.length |= uint16(value) << 8
+		p.sum += uint16(value)
+		p.data = p.data[:0]
+		p.state = _STATE_DATA
+		if p.length == 0 {
+			p.state = _STATE_CHECKSUM_LO
+		}
+	case _STATE_DATA:
+		p.data = append(p.data, value)
+		p.sum += uint16(value)
+		if len(p.data) >= int(p.length) {
+			p.state = _STATE_CHECKSUM_LO
+		}
+	case _STATE_CHECKSUM_LO:
+		p.checksum = uint16(value)
+		p.state = _STATE_CHECKSUM_HI
+	case _STATE_CHECKSUM_HI:
+		p.checksum |= uint16(value) << 8
+		p.state = _STATE_ALIVE
+		p.execute()
+	case _STATE_ALIVE:
+		p.state = _STATE_STATUS
+		return _ALIVE
+	case _STATE_STATUS:
+		p.state = _STATE_MAGIC_0
+		return p.status
+	}
+	return 0x00
+}
+
+// the whole packet has been received
+func (p *Printer) execute() {
+	if p.checksum != p.sum {
+		p.status |= _STATUS_CHECKSUM
+		return
+	}
+	p.status &^= _STATUS_CHECKSUM | _STATUS_PACKET_ERR
+	switch p.command {
+	case _CMD_INIT:
+		p.buffer = p.buffer[:0]
+		p.status = 0
+		p.busy = 0
+	case _CMD_DATA:
+		data := p.data
+		if p.compression != 0 {
+			data = decompress(data)
+		}
+		if len(p.buffer)+len(data) > _MAX_DATA {
+			data = data[:_MAX_DATA-len(p.buffer)]
+		}
+		p.buffer = append(p.buffer, data...)
+		if len(p.buffer) > 0 {
+			p.status |= _STATUS_UNPRINTED
+		}
+		if len(p.buffer) >= _MAX_DATA {
+			p.status |= _STATUS_FULL
+		}
+	case _CMD_PRINT:
+		if len(p.data) < 4 {
+			p.status |= _STATUS_PACKET_ERR
+			return
+		}
+		p.print(p.data[1], p.data[2])
+		p.buffer = p.buffer[:0]
+		p.status &^= _STATUS_UNPRINTED | _STATUS_FULL
+		p.status |= _STATUS_BUSY
+		p.busy = _BUSY_PACKETS
+	case _CMD_STATUS:
+		// the print takes a while, the game waits for it
+		if p.busy > 0 {
+			p.busy--
+			if p.busy == 0 {
+				p.status &^= _STATUS_BUSY
+			}
+		}
+	default:
+		p.status |= _STATUS_PACKET_ERR
+	}
+}
+
+// run length encoding, a control byte with bit 7 set repeats the next byte
+// (control & 0x7F) + 2 times, otherwise control + 1 bytes follow as they are
+func decompress(data []uint8) []uint8 {
+	out := make([]uint8, 0, 2*_ROW_BYTES)
+	for i := 0; i < len(data); {
+		control := data[i]
+		i++
+		if control&0x80 != 0 {
+			if i >= len(data) {
+				break
+			}
+			for n := 0; n < int(control&0x7F)+2; n++ {
+				out = append(out, data[i])
+			}
+			i++
+		} else {
+			end := i + int(control) + 1
+			if end > len(data) {
+				end = len(data)
+			}
+			out = append(out, data[i:end]...)
+			i = end
+		}
+	}
+	return out
+}
+
+// print appends the tiles in the buffer to the sheet, margins has
+// the lines fed before (high nibble) and after (low nibble)
+func (p *Printer) print(margins uint8, palette uint8) {
+	// 0x00 is used as the default palette by some games
+	if palette == 0 {
+		palette = 0xE4
+	}
+	if margins>>4 != 0 && len(p.paper) > 0 {
+		p.cut()
+	}
+	rows := len(p.buffer) / _ROW_BYTES
+	for row := 0; row < rows; row++ {
+		for y := 0; y < 8; y++ {
+			for x := 0; x < _WIDTH; x++ {
+				tile := p.buffer[row*_ROW_BYTES+(x/8)*_TILE_BYTES:]
+				lo := tile[y*2] >> (7 - x%8) & 0x1
+				hi := tile[y*2+1] >> (7 - x%8) & 0x1
+				index := hi<<1 | lo
+				p.paper = append(p.paper, _SHADES[palette>>(index*2)&0x3])
+			}
+		}
+	}
+	if len(p.paper) == 0 {
+		return
+	}
+	if p.sheet == "" {
+		p.sheet = p.nextSheet()
+	}
+	// the file is rewritten as the sheet grows, so nothing is lost
+	// if the game never feeds the margin
+	if err := p.save(p.sheet); err != nil {
+		log.Printf("Error with printer\n\t%s", err)
+	}
+	if margins&0x0F != 0 {
+		p.cut()
+	}
+}
+
+// the next print goes to a new sheet
+func (p *Printer) cut() {
+	p.paper = p.paper[:0]
+	p.sheet = ""
+}
+
+func (p *Printer) nextSheet() string {
+	for {
+		p.sheets++
+		path := filepath.Join(p.dir, fmt.Sprintf("print_%03d.png", p.sheets))
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+	}
+}
+
+func (p *Printer) save(path string) error {
+	height := len(p.paper) / _WIDTH
+	img := image.NewGray(image.Rect(0, 0, _WIDTH, height))
+	for i, shade := range p.paper {
+		img.Pix[i] = shade
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		return err
+	}
+	fmt.Printf("!!! Printed %s\n", path)
+	return nil
+}
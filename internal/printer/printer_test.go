@@ -0,0 +1,136 @@
+package printer
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sends a whole packet as the game does, bad adds to the checksum.
+// Returns the two bytes answered at the end
+func send(p *Printer, command uint8, compression uint8, data []uint8, bad uint16) (uint8, uint8) {
+	sum := uint16(command) + uint16(compression) + uint16(len(data)&0xFF) + uint16(len(data)>>8)
+	for _, b := range data {
+		sum += uint16(b)
+	}
+	sum += bad
+	packet := []uint8{_MAGIC_0, _MAGIC_1, command, compression, uint8(len(data)), uint8(len(data) >> 8)}
+	packet = append(packet, data...)
+	packet = append(packet, uint8(sum), uint8(sum>>8))
+	for _, b := range packet {
+		p.Transfer(b, false)
+	}
+	return p.Transfer(0, false), p.Transfer(0, false)
+}
+
+// two rows of tiles, the first line of every tile has color 1
+func tiles() []uint8 {
+	data := make([]uint8, 2*_ROW_BYTES)
+	for t := 0; t < len(data); t += _TILE_BYTES {
+		data[t] = 0xFF
+	}
+	return data
+}
+
+func TestPackets(t *testing.T) {
+	dir := t.TempDir()
+	p, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		command uint8
+		data    []uint8
+		bad     uint16
+		status  uint8
+	}{
+		{"init", _CMD_INIT, nil, 0, 0},
+		{"data", _CMD_DATA, tiles(), 0, _STATUS_UNPRINTED},
+		{"bad checksum", _CMD_DATA, tiles(), 1, _STATUS_UNPRINTED | _STATUS_CHECKSUM},
+		{"end of data", _CMD_DATA, nil, 0, _STATUS_UNPRINTED},
+		{"status", _CMD_STATUS, nil, 0, _STATUS_UNPRINTED},
+		// one line before and three after, so the sheet is cut
+		{"print", _CMD_PRINT, []uint8{0x01, 0x13, 0xE4, 0x40}, 0, _STATUS_BUSY},
+		{"busy", _CMD_STATUS, nil, 0, _STATUS_BUSY},
+		{"done", _CMD_STATUS, nil, 0, 0},
+		{"short print", _CMD_PRINT, []uint8{0x01}, 0, _STATUS_PACKET_ERR},
+		{"unknown", 0x05, nil, 0, _STATUS_PACKET_ERR},
+		{"init again", _CMD_INIT, nil, 0, 0},
+	}
+	for _, test := range tests {
+		alive, status := send(p, test.command, 0, test.data, test.bad)
+		if alive != _ALIVE {
+			t.Errorf("%s: answered %02X, expected %02X", test.name, alive, _ALIVE)
+		}
+		if status != test.status {
+			t.Errorf("%s: status %02X, expected %02X", test.name, status, test.status)
+		}
+	}
+
+	// only the packet with the right checksum is printed
+	file, err := os.Open(filepath.Join(dir, "print_001.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != _WIDTH || size.Y != 16 {
+		t.Fatalf("printed %dx%d", size.X, size.Y)
+	}
+	for _, pixel := range []struct {
+		x, y  int
+		shade uint8
+	}{{0, 0, 0xAA}, {159, 8, 0xAA}, {0, 1, 0xFF}, {80, 15, 0xFF}} {
+		r, _, _, _ := img.At(pixel.x, pixel.y).RGBA()
+		if uint8(r>>8) != pixel.shade {
+			t.Errorf("pixel %d,%d is %02X, expected %02X", pixel.x, pixel.y, r>>8, pixel.shade)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "print_002.png")); !os.IsNotExist(err) {
+		t.Errorf("more than one sheet printed")
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	tests := []struct {
+		name string
+		data []uint8
+		want []uint8
+	}{
+		{"raw", []uint8{0x02, 1, 2, 3}, []uint8{1, 2, 3}},
+		{"repeated", []uint8{0x81, 7}, []uint8{7, 7, 7}},
+		{"mixed", []uint8{0x80, 9, 0x00, 4}, []uint8{9, 9, 4}},
+		{"truncated raw", []uint8{0x03, 1}, []uint8{1}},
+		{"truncated repeat", []uint8{0x85}, []uint8{}},
+	}
+	for _, test := range tests {
+		if got := decompress(test.data); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: % X, expected % X", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCompressedData(t *testing.T) {
+	p, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(p, _CMD_INIT, 0, nil, 0)
+	// a whole buffer in a packet, 0x7F + 2 bytes at a time
+	var data []uint8
+	for n := 0; n < _MAX_DATA; n += 0x81 {
+		data = append(data, 0xFF, 0x00)
+	}
+	if _, status := send(p, _CMD_DATA, 1, data, 0); status != _STATUS_UNPRINTED|_STATUS_FULL {
+		t.Fatalf("status %02X after a full buffer", status)
+	}
+	if len(p.buffer) != _MAX_DATA {
+		t.Fatalf("%d bytes in the buffer, expected %d", len(p.buffer), _MAX_DATA)
+	}
+}
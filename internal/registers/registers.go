@@ -1,10 +1,12 @@
 package registers
 
 import (
+	"encoding/gob"
 	"fmt"
 	"log"
 
 	"github.com/giammirove/gampboy_emulator/internal/headers"
+	"github.com/giammirove/gampboy_emulator/internal/utility"
 )
 
 // the underscore before avoid exposing this constants
@@ -40,239 +42,253 @@ type registers_t struct {
 
 }
 
-var clock uint
-var registers registers_t
+// Registers are the cpu registers
+type Registers struct {
+	headers *headers.Header
 
-func Init() {
-	registers = registers_t{}
-	SetPC(0x100)
-	Reset()
-	clock = 0
+	clock     uint
+	registers registers_t
 }
 
-func Reset() {
-	// DMG0
-	if headers.IsGB() && !headers.IsCGB() {
-		SetA(0x1)
-		SetF(0x0)
-		SetB(0xFF)
-		SetC(0x13)
-		SetD(0x0)
-		SetE(0xC1)
-		SetH(0x84)
-		SetL(0x03)
-		SetPC(0x0100)
-		SetSP(0xFFFE)
-	}
-	if headers.IsCGB() {
-		SetA(0x11)
-		SetF(0x80)
-		SetB(0x00)
-		SetC(0x00)
-		SetD(0xFF)
-		SetE(0x08)
-		SetH(0x00)
-		SetL(0x0D)
-		SetPC(0x0100)
-		SetSP(0xFFFE)
-	}
+// New creates the registers connected to the other components
+func New(headers *headers.Header) *Registers {
+	return &Registers{headers: headers}
+}
+
+// Init is the state at power on, the boot rom starts at 0
+func (r *Registers) Init() {
+	r.registers = registers_t{}
+	r.clock = 0
+}
 
+// A, F, B, C, D, E, H, L left by the boot rom of every model
+var _POST_BOOT = map[headers.Model][8]uint{
+	headers.MODEL_DMG0: {0x01, 0x00, 0xFF, 0x13, 0x00, 0xC1, 0x84, 0x03},
+	headers.MODEL_DMG:  {0x01, 0xB0, 0x00, 0x13, 0x00, 0xD8, 0x01, 0x4D},
+	headers.MODEL_MGB:  {0xFF, 0xB0, 0x00, 0x13, 0x00, 0xD8, 0x01, 0x4D},
+	headers.MODEL_SGB:  {0x01, 0x00, 0x00, 0x14, 0x00, 0x00, 0xC0, 0x60},
+	headers.MODEL_CGB:  {0x11, 0x80, 0x00, 0x00, 0xFF, 0x56, 0x00, 0x0D},
+	headers.MODEL_AGB:  {0x11, 0x00, 0x01, 0x00, 0xFF, 0x56, 0x00, 0x0D},
 }
 
-func IncrementClock(val ...uint) {
+// Reset is the state left by the boot rom, the cartridge starts at 0x100
+func (r *Registers) Reset() {
+	model := r.headers.GetModel()
+	values := _POST_BOOT[model]
+	// dmg roms on cgb and agb
+	if model.IsColor() && r.headers.IsGB() {
+		values[4], values[5], values[6], values[7] = 0x00, 0x08, 0x00, 0x7C
+	}
+	// half carry and carry come from the header checksum
+	if (model == headers.MODEL_DMG || model == headers.MODEL_MGB) && r.headers.GetHeaderChecksum() == 0 {
+		values[1] = 0x80
+	}
+	r.SetA(values[0])
+	r.SetF(values[1])
+	r.SetB(values[2])
+	r.SetC(values[3])
+	r.SetD(values[4])
+	r.SetE(values[5])
+	r.SetH(values[6])
+	r.SetL(values[7])
+	r.SetPC(0x0100)
+	r.SetSP(0xFFFE)
+}
+
+func (r *Registers) IncrementClock(val ...uint) {
 	if len(val) > 1 {
 		log.Fatal("Too many arguments")
 	}
 	if len(val) == 1 {
-		clock += val[0]
+		r.clock += val[0]
 	} else {
-		clock++
+		r.clock++
 	}
 }
 
-func SetFlag(Set bool, bit int) {
+func (r *Registers) SetFlag(Set bool, bit int) {
 	if Set {
-		SetF(F() | 1<<bit)
+		r.SetF(r.F() | 1<<bit)
 	} else {
-		SetF((F() | (1 << bit)) ^ (1 << bit))
+		r.SetF((r.F() | (1 << bit)) ^ (1 << bit))
 	}
 }
 
-func SetFlags(z bool, n bool, h bool, c bool) {
-	SetZeroFlag(z)
-	SetSubstractionFlag(n)
-	SetHalfCarryFlag(h)
-	SetCarryFlag(c)
+func (r *Registers) SetFlags(z bool, n bool, h bool, c bool) {
+	r.SetZeroFlag(z)
+	r.SetSubstractionFlag(n)
+	r.SetHalfCarryFlag(h)
+	r.SetCarryFlag(c)
 }
 
-func SetZeroFlag(Set bool) {
+func (r *Registers) SetZeroFlag(Set bool) {
 	bit := _ZERO_FLAG
-	SetFlag(Set, bit)
+	r.SetFlag(Set, bit)
 }
-func Z_flag() bool { return F()&_ZERO_FLAG_MASK > 0 }
+func (r *Registers) Z_flag() bool { return r.F()&_ZERO_FLAG_MASK > 0 }
 
-func SetSubstractionFlag(Set bool) {
+func (r *Registers) SetSubstractionFlag(Set bool) {
 	bit := _SUB_FLAG
-	SetFlag(Set, bit)
+	r.SetFlag(Set, bit)
 }
-func N_flag() bool { return F()&_SUB_FLAG_MASK > 0 }
+func (r *Registers) N_flag() bool { return r.F()&_SUB_FLAG_MASK > 0 }
 
-func SetHalfCarryFlag(Set bool) {
+func (r *Registers) SetHalfCarryFlag(Set bool) {
 	bit := _HALF_CARRY_FLAG
-	SetFlag(Set, bit)
+	r.SetFlag(Set, bit)
 }
-func H_flag() bool { return F()&_HALF_CARRY_FLAG_MASK > 0 }
+func (r *Registers) H_flag() bool { return r.F()&_HALF_CARRY_FLAG_MASK > 0 }
 
-func SetCarryFlag(Set bool) {
+func (r *Registers) SetCarryFlag(Set bool) {
 	bit := _CARRY_FLAG
-	SetFlag(Set, bit)
+	r.SetFlag(Set, bit)
 }
-func C_flag() bool { return F()&_CARRY_FLAG_MASK > 0 }
+func (r *Registers) C_flag() bool { return r.F()&_CARRY_FLAG_MASK > 0 }
 
-func SetA(val uint) {
-	registers.A = val & _HALF_WORD_MASK
+func (r *Registers) SetA(val uint) {
+	r.registers.A = val & _HALF_WORD_MASK
 }
 
-func SetF(val uint) {
-	registers.F = val & _HALF_WORD_MASK
+func (r *Registers) SetF(val uint) {
+	r.registers.F = val & _HALF_WORD_MASK
 }
 
-func SetAF(val uint) {
-	registers.A = val & _MASK_HI >> _HALF_WORD
-	registers.F = val & _MASK_LOW
+func (r *Registers) SetAF(val uint) {
+	r.registers.A = val & _MASK_HI >> _HALF_WORD
+	r.registers.F = val & _MASK_LOW
 }
 
-func A() uint  { return registers.A & _HALF_WORD_MASK }
-func F() uint  { return registers.F & _HALF_WORD_MASK }
-func AF() uint { return registers.F | registers.A<<_HALF_WORD }
+func (r *Registers) A() uint  { return r.registers.A & _HALF_WORD_MASK }
+func (r *Registers) F() uint  { return r.registers.F & _HALF_WORD_MASK }
+func (r *Registers) AF() uint { return r.registers.F | r.registers.A<<_HALF_WORD }
 
-func SetB(val uint) {
-	registers.B = val & _HALF_WORD_MASK
+func (r *Registers) SetB(val uint) {
+	r.registers.B = val & _HALF_WORD_MASK
 }
 
-func SetC(val uint) {
-	registers.C = val & _HALF_WORD_MASK
+func (r *Registers) SetC(val uint) {
+	r.registers.C = val & _HALF_WORD_MASK
 }
 
-func SetBC(val uint) {
-	registers.B = val & _MASK_HI >> _HALF_WORD
-	registers.C = val & _MASK_LOW
+func (r *Registers) SetBC(val uint) {
+	r.registers.B = val & _MASK_HI >> _HALF_WORD
+	r.registers.C = val & _MASK_LOW
 }
 
-func B() uint  { return registers.B & _HALF_WORD_MASK }
-func C() uint  { return registers.C & _HALF_WORD_MASK }
-func BC() uint { return registers.C | registers.B<<_HALF_WORD }
+func (r *Registers) B() uint  { return r.registers.B & _HALF_WORD_MASK }
+func (r *Registers) C() uint  { return r.registers.C & _HALF_WORD_MASK }
+func (r *Registers) BC() uint { return r.registers.C | r.registers.B<<_HALF_WORD }
 
-func SetD(val uint) {
-	registers.D = val & _HALF_WORD_MASK
+func (r *Registers) SetD(val uint) {
+	r.registers.D = val & _HALF_WORD_MASK
 }
 
-func SetE(val uint) {
-	registers.E = val & _HALF_WORD_MASK
+func (r *Registers) SetE(val uint) {
+	r.registers.E = val & _HALF_WORD_MASK
 }
 
-func SetDE(val uint) {
-	registers.D = val & _MASK_HI >> _HALF_WORD
-	registers.E = val & _MASK_LOW
+func (r *Registers) SetDE(val uint) {
+	r.registers.D = val & _MASK_HI >> _HALF_WORD
+	r.registers.E = val & _MASK_LOW
 }
 
-func D() uint  { return registers.D & _HALF_WORD_MASK }
-func E() uint  { return registers.E & _HALF_WORD_MASK }
-func DE() uint { return registers.E | registers.D<<_HALF_WORD }
+func (r *Registers) D() uint  { return r.registers.D & _HALF_WORD_MASK }
+func (r *Registers) E() uint  { return r.registers.E & _HALF_WORD_MASK }
+func (r *Registers) DE() uint { return r.registers.E | r.registers.D<<_HALF_WORD }
 
-func SetH(val uint) {
-	registers.H = val & _HALF_WORD_MASK
+func (r *Registers) SetH(val uint) {
+	r.registers.H = val & _HALF_WORD_MASK
 }
 
-func SetL(val uint) {
-	registers.L = val & _HALF_WORD_MASK
+func (r *Registers) SetL(val uint) {
+	r.registers.L = val & _HALF_WORD_MASK
 }
 
-func SetHL(val uint) {
-	registers.H = val & _MASK_HI >> _HALF_WORD
-	registers.L = val & _MASK_LOW
+func (r *Registers) SetHL(val uint) {
+	r.registers.H = val & _MASK_HI >> _HALF_WORD
+	r.registers.L = val & _MASK_LOW
 }
 
-func H() uint  { return registers.H & _HALF_WORD_MASK }
-func L() uint  { return registers.L & _HALF_WORD_MASK }
-func HL() uint { return registers.L | registers.H<<_HALF_WORD }
+func (r *Registers) H() uint  { return r.registers.H & _HALF_WORD_MASK }
+func (r *Registers) L() uint  { return r.registers.L & _HALF_WORD_MASK }
+func (r *Registers) HL() uint { return r.registers.L | r.registers.H<<_HALF_WORD }
 
-func SetSP(val uint) {
-	registers.SP = val & 0xFFFF
+func (r *Registers) SetSP(val uint) {
+	r.registers.SP = val & 0xFFFF
 }
 
-func SetPC(val uint) {
-	registers.PC = val & 0xFFFF
+func (r *Registers) SetPC(val uint) {
+	r.registers.PC = val & 0xFFFF
 }
 
-func SP() uint { return registers.SP & 0xFFFF }
-func PC() uint { return registers.PC & 0xFFFF }
+func (r *Registers) SP() uint { return r.registers.SP & 0xFFFF }
+func (r *Registers) PC() uint { return r.registers.PC & 0xFFFF }
 
-func DecrementSP() { registers.SP-- }
-func DecrementPC() { registers.PC-- }
-func IncrementSP() { registers.SP++ }
-func IncrementPC() { registers.PC++ }
+func (r *Registers) DecrementSP() { r.registers.SP-- }
+func (r *Registers) DecrementPC() { r.registers.PC-- }
+func (r *Registers) IncrementSP() { r.registers.SP++ }
+func (r *Registers) IncrementPC() { r.registers.PC++ }
 
-func Set(key string) func(val uint) {
+func (r *Registers) Set(key string) func(val uint) {
 	switch key {
 	case "A":
-		return SetA
+		return r.SetA
 	case "B":
-		return SetB
+		return r.SetB
 	case "C":
-		return SetC
+		return r.SetC
 	case "D":
-		return SetD
+		return r.SetD
 	case "E":
-		return SetE
+		return r.SetE
 	case "H":
-		return SetH
+		return r.SetH
 	case "L":
-		return SetL
+		return r.SetL
 	case "AF":
-		return SetAF
+		return r.SetAF
 	case "BC":
-		return SetBC
+		return r.SetBC
 	case "DE":
-		return SetDE
+		return r.SetDE
 	case "HL":
-		return SetHL
+		return r.SetHL
 	case "SP":
-		return SetSP
+		return r.SetSP
 	case "PC":
-		return SetPC
+		return r.SetPC
 	}
 	log.Fatal("Register not found")
 	return (func(val uint) {})
 }
-func Get(key string) func() uint {
+func (r *Registers) Get(key string) func() uint {
 	switch key {
 	case "A":
-		return A
+		return r.A
 	case "B":
-		return B
+		return r.B
 	case "C":
-		return C
+		return r.C
 	case "D":
-		return D
+		return r.D
 	case "E":
-		return E
+		return r.E
 	case "H":
-		return H
+		return r.H
 	case "L":
-		return L
+		return r.L
 	case "AF":
-		return AF
+		return r.AF
 	case "BC":
-		return BC
+		return r.BC
 	case "DE":
-		return DE
+		return r.DE
 	case "HL":
-		return HL
+		return r.HL
 	case "SP":
-		return SP
+		return r.SP
 	case "PC":
-		return PC
+		return r.PC
 	}
 	log.Fatal("Register not found (", key, ")")
 	return (func() uint { return 0 })
@@ -311,64 +327,65 @@ func GetNByte(key string) uint {
 	return 0
 }
 
-func GetPair(key string) (func() uint, func() uint) {
+func (r *Registers) GetPair(key string) (func() uint, func() uint) {
 	switch key {
 	case "AF":
-		return A, F
+		return r.A, r.F
 	case "BC":
-		return B, C
+		return r.B, r.C
 	case "DE":
-		return D, E
+		return r.D, r.E
 	case "HL":
-		return H, L
+		return r.H, r.L
 	}
 	log.Fatal("Register not found (", key, ")")
 	return func() uint { return 0 }, func() uint { return 0 }
 }
-func SetPair(key string) (func(val uint), func(val uint)) {
+func (r *Registers) SetPair(key string) (func(val uint), func(val uint)) {
 	switch key {
 	case "AF":
-		return SetA, SetF
+		return r.SetA, r.SetF
 	case "BC":
-		return SetB, SetC
+		return r.SetB, r.SetC
 	case "DE":
-		return SetD, SetE
+		return r.SetD, r.SetE
 	case "HL":
-		return SetH, SetL
+		return r.SetH, r.SetL
 	}
 	log.Fatal("Register not found (", key, ")")
 	return func(val uint) {}, func(val uint) {}
 }
 
-func GetFlag(key string) bool {
+func (r *Registers) GetFlag(key string) bool {
 	switch key {
 	case "NZ":
-		return !Z_flag()
+		return !r.Z_flag()
 	case "Z":
-		return Z_flag()
+		return r.Z_flag()
 	case "NC":
-		return !C_flag()
+		return !r.C_flag()
 	case "C":
-		return C_flag()
+		return r.C_flag()
 	}
 	log.Fatal("Flag not found (", key, ")")
 	return false
 }
 
-func Dump() {
-	fmt.Printf("A: %02X F: %04b BC: %04X DE: %04X HL: %04X\n", A(), F()>>4, BC(), DE(), HL())
+func (r *Registers) Dump() {
+	fmt.Printf("A: %02X F: %04b BC: %04X DE: %04X HL: %04X\n", r.A(), r.F()>>4, r.BC(), r.DE(), r.HL())
 	// fmt.Printf("SP: %04X\n", SP())
 }
 
-func Test() {
+func (r *Registers) SaveState(enc *gob.Encoder) error {
+	return utility.EncodeAll(enc, r.registers, r.clock)
+}
 
-	fmt.Println(A())
-	SetCarryFlag(true)
-	fmt.Println(C_flag())
-	SetCarryFlag(false)
-	fmt.Println(C_flag())
-	SetBC(0x0F00)
-	fmt.Printf("%016b\n", BC())
-	fmt.Printf("%08b\n", B())
-	fmt.Printf("%08b\n", C())
+func (r *Registers) LoadState(dec *gob.Decoder) error {
+	// zero fields are not transmitted, start from a clean struct
+	loaded := registers_t{}
+	if err := utility.DecodeAll(dec, &loaded, &r.clock); err != nil {
+		return err
+	}
+	r.registers = loaded
+	return nil
 }
@@ -0,0 +1,143 @@
+// Package rewind keeps the last seconds of the machine, to run the game
+// backwards. A snapshot is a save state, only the newest one is kept whole,
+// every older one is the compressed difference with the one after it
+package rewind
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+	"github.com/giammirove/gampboy_emulator/internal/savestate"
+)
+
+// Buffer records a snapshot every few frames, the oldest ones are dropped
+// to stay within the memory budget
+type Buffer struct {
+	gb *emulator.GameBoy
+	// frames between two snapshots
+	interval int
+	frames   int
+	// bytes of the snapshots, size counts only the deltas
+	budget int
+	size   int
+
+	current []byte
+	deltas  ring_t
+}
+
+// New creates an empty buffer, budget is in bytes
+func New(gb *emulator.GameBoy, interval int, budget int) *Buffer {
+	if interval < 1 {
+		interval = 1
+	}
+	return &Buffer{gb: gb, interval: interval, budget: budget}
+}
+
+// Record is called after every frame, it takes a snapshot every
+// interval frames
+func (b *Buffer) Record() error {
+	b.frames++
+	if b.frames < b.interval {
+		return nil
+	}
+	b.frames = 0
+
+	var state bytes.Buffer
+	if err := savestate.SaveState(b.gb, &state); err != nil {
+		return err
+	}
+	if b.current != nil {
+		delta, err := diff(b.current, state.Bytes())
+		if err != nil {
+			return err
+		}
+		b.deltas.push(delta)
+		b.size += len(delta)
+	}
+	b.current = state.Bytes()
+	for b.Size() > b.budget && b.deltas.len() > 0 {
+		b.size -= len(b.deltas.popFront())
+	}
+	return nil
+}
+
+// Rewind restores the snapshot before the last one restored, it returns
+// false when there is nothing older
+func (b *Buffer) Rewind() (bool, error) {
+	if b.current == nil {
+		return false, nil
+	}
+	b.frames = 0
+	if b.deltas.len() == 0 {
+		// back to the oldest one, the frames run since then are dropped
+		return false, savestate.LoadState(b.gb, bytes.NewReader(b.current))
+	}
+	delta := b.deltas.popBack()
+	b.size -= len(delta)
+	older, err := patch(b.current, delta)
+	if err != nil {
+		return false, err
+	}
+	b.current = older
+	return true, savestate.LoadState(b.gb, bytes.NewReader(b.current))
+}
+
+// Len is the number of snapshots that can be restored
+func (b *Buffer) Len() int {
+	if b.current == nil {
+		return 0
+	}
+	return b.deltas.len() + 1
+}
+
+// Size is the memory used by the snapshots, in bytes
+func (b *Buffer) Size() int {
+	return b.size + len(b.current)
+}
+
+// Clear drops every snapshot, e.g. after loading a state
+func (b *Buffer) Clear() {
+	b.current = nil
+	b.deltas = ring_t{}
+	b.size = 0
+	b.frames = 0
+}
+
+// diff is older xor newer, compressed: most of the bytes don't change
+// between two frames so it is mostly zeros. The bytes of older past the
+// end of newer are kept as they are
+func diff(older []byte, newer []byte) ([]byte, error) {
+	delta := make([]byte, len(older))
+	copy(delta, older)
+	for i := 0; i < len(delta) && i < len(newer); i++ {
+		delta[i] ^= newer[i]
+	}
+	var out bytes.Buffer
+	w, err := flate.NewWriter(&out, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(delta); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// patch is the inverse of diff
+func patch(newer []byte, delta []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(delta))
+	defer r.Close()
+	older, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(older) && i < len(newer); i++ {
+		older[i] ^= newer[i]
+	}
+	return older, nil
+}
@@ -0,0 +1,97 @@
+package rewind
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+	"github.com/giammirove/gampboy_emulator/internal/headless"
+	"github.com/giammirove/gampboy_emulator/internal/savestate"
+	"github.com/giammirove/gampboy_emulator/internal/testutil"
+)
+
+// a cartridge that turns the lcd on and keeps counting in the work ram
+func counterROM() []byte {
+	// LD A,$91 ; LDH ($40),A ; loop: INC A ; LD ($C000),A ; JR loop
+	return testutil.ROM([]byte{0x3E, 0x91, 0xE0, 0x40, 0x3C, 0xEA, 0x00, 0xC0, 0x18, 0xFA})
+}
+
+func newMachine(t *testing.T) *emulator.GameBoy {
+	gb, err := emulator.New(counterROM(), emulator.Options{NoSaves: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(gb.Close)
+	return gb
+}
+
+func state(t *testing.T, gb *emulator.GameBoy) []byte {
+	var b bytes.Buffer
+	if err := savestate.SaveState(gb, &b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// every rewind restores the snapshot before, byte for byte
+func TestRewind(t *testing.T) {
+	const frames = 20
+	gb := newMachine(t)
+	buffer := New(gb, 1, 64<<20)
+	states := make([][]byte, frames)
+	for i := 0; i < frames; i++ {
+		headless.Run(gb, 1)
+		if err := buffer.Record(); err != nil {
+			t.Fatal(err)
+		}
+		states[i] = state(t, gb)
+	}
+	if bytes.Equal(states[0], states[frames-1]) {
+		t.Fatal("the machine is not running")
+	}
+	if buffer.Len() != frames {
+		t.Fatalf("%d snapshots, expected %d", buffer.Len(), frames)
+	}
+	for i := frames - 2; i >= 0; i-- {
+		ok, err := buffer.Rewind()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("nothing to rewind to frame %d", i)
+		}
+		if !bytes.Equal(state(t, gb), states[i]) {
+			t.Fatalf("frame %d differs after the rewind", i)
+		}
+	}
+	// the oldest one is restored again
+	if ok, err := buffer.Rewind(); ok || err != nil {
+		t.Fatalf("rewind past the oldest snapshot: %t %v", ok, err)
+	}
+	if !bytes.Equal(state(t, gb), states[0]) {
+		t.Fatalf("frame 0 differs after the last rewind")
+	}
+}
+
+func TestBudget(t *testing.T) {
+	gb := newMachine(t)
+	headless.Run(gb, 1)
+	budget := 2 * len(state(t, gb))
+	buffer := New(gb, 1, budget)
+	for i := 0; i < 200; i++ {
+		headless.Run(gb, 1)
+		if err := buffer.Record(); err != nil {
+			t.Fatal(err)
+		}
+		if buffer.Size() > budget {
+			t.Fatalf("%d bytes after frame %d, budget %d", buffer.Size(), i, budget)
+		}
+	}
+	buffer.Clear()
+	if buffer.Len() != 0 || buffer.Size() != 0 {
+		t.Fatalf("%d snapshots of %d bytes after Clear", buffer.Len(), buffer.Size())
+	}
+	if ok, err := buffer.Rewind(); ok || err != nil {
+		t.Fatalf("rewind after Clear: %t %v", ok, err)
+	}
+}
@@ -0,0 +1,50 @@
+package rewind
+
+// ring_t is a queue of deltas, the newest at the back. It grows when
+// full, the budget decides how many deltas it holds
+type ring_t struct {
+	items [][]byte
+	start int
+	count int
+}
+
+func (r *ring_t) len() int {
+	return r.count
+}
+
+func (r *ring_t) push(item []byte) {
+	if r.count == len(r.items) {
+		r.grow()
+	}
+	r.items[(r.start+r.count)%len(r.items)] = item
+	r.count++
+}
+
+func (r *ring_t) popFront() []byte {
+	item := r.items[r.start]
+	r.items[r.start] = nil
+	r.start = (r.start + 1) % len(r.items)
+	r.count--
+	return item
+}
+
+func (r *ring_t) popBack() []byte {
+	i := (r.start + r.count - 1) % len(r.items)
+	item := r.items[i]
+	r.items[i] = nil
+	r.count--
+	return item
+}
+
+func (r *ring_t) grow() {
+	size := 2 * len(r.items)
+	if size == 0 {
+		size = 64
+	}
+	items := make([][]byte, size)
+	for i := 0; i < r.count; i++ {
+		items[i] = r.items[(r.start+i)%len(r.items)]
+	}
+	r.items = items
+	r.start = 0
+}
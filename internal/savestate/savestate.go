@@ -0,0 +1,137 @@
+package savestate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+)
+
+var _MAGIC = [4]byte{'G', 'B', 'S', 'S'}
+
+// has to be incremented every time the content of a state changes
+const VERSION = 3
+
+var ErrVersion = errors.New("save state version not supported")
+var ErrFormat = errors.New("not a save state")
+var ErrROM = errors.New("save state belongs to another ROM")
+
+type header_t struct {
+	Magic    [4]byte
+	Version  uint32
+	Checksum uint16
+}
+
+type component_t interface {
+	SaveState(enc *gob.Encoder) error
+	LoadState(dec *gob.Decoder) error
+}
+
+// every component of the machine, always in the same order
+func components(gb *emulator.GameBoy) []component_t {
+	return []component_t{gb.Registers, gb.CPU, gb.Interrupts, gb.Timer, gb.Serial, gb.Joypad, gb.PPU, gb.APU, gb.MMU}
+}
+
+// SaveState writes the whole machine to w, between two frames
+func SaveState(gb *emulator.GameBoy, w io.Writer) error {
+	header := header_t{Magic: _MAGIC, Version: VERSION, Checksum: gb.Header.GetGlobalChecksum()}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(gb.Header.GetTitle()); err != nil {
+		return err
+	}
+	for _, c := range components(gb) {
+		if err := c.SaveState(enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadState restores the machine saved by SaveState, between two frames
+func LoadState(gb *emulator.GameBoy, r io.Reader) error {
+	dec, err := readHeader(gb, r)
+	if err != nil {
+		return err
+	}
+	var backup bytes.Buffer
+	if err := SaveState(gb, &backup); err != nil {
+		return err
+	}
+	if err := loadComponents(gb, dec); err != nil {
+		// a broken state must not leave the machine half restored
+		if dec, berr := readHeader(gb, &backup); berr == nil {
+			loadComponents(gb, dec)
+		}
+		return err
+	}
+	return nil
+}
+
+func readHeader(gb *emulator.GameBoy, r io.Reader) (*gob.Decoder, error) {
+	var header header_t
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != _MAGIC {
+		return nil, ErrFormat
+	}
+	if header.Version != VERSION {
+		return nil, fmt.Errorf("%w (%d)", ErrVersion, header.Version)
+	}
+	dec := gob.NewDecoder(r)
+	var title string
+	if err := dec.Decode(&title); err != nil {
+		return nil, err
+	}
+	if header.Checksum != gb.Header.GetGlobalChecksum() || title != gb.Header.GetTitle() {
+		return nil, fmt.Errorf("%w (%s)", ErrROM, title)
+	}
+	return dec, nil
+}
+
+func loadComponents(gb *emulator.GameBoy, dec *gob.Decoder) error {
+	for _, c := range components(gb) {
+		if err := c.LoadState(dec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func SlotPath(gb *emulator.GameBoy, slot int) string {
+	return fmt.Sprintf("%s.state%d", gb.MMU.GetRomPath(), slot)
+}
+
+func SaveSlot(gb *emulator.GameBoy, slot int) error {
+	file, err := os.Create(SlotPath(gb, slot))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	err = SaveState(gb, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func LoadSlot(gb *emulator.GameBoy, slot int) error {
+	file, err := os.Open(SlotPath(gb, slot))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return LoadState(gb, bufio.NewReader(file))
+}
@@ -1,6 +1,8 @@
 package serial
 
 import (
+	"encoding/gob"
+	"io"
 	"log"
 
 	"github.com/giammirove/gampboy_emulator/internal/interrupts"
@@ -12,39 +14,174 @@ const _SC = 0xFF02
 const _START_ADDR = _SB
 const _END_ADDR = _SC
 
-var registers []uint
+const _SC_TRANSFER_BIT = 7
+const _SC_SPEED_BIT = 1
+const _SC_CLOCK_BIT = 0
 
-// TOOD: add external clock
-func Init() {
-	registers = make([]uint, _END_ADDR-_START_ADDR+1)
-	WriteToMemory(_SB, 0x00)
-	WriteToMemory(_SC, 0x7E)
+// M-Cycles to shift a bit with the internal clock, 8192 Hz or 262144 Hz (CGB).
+// In double speed the clock is doubled too, so in M-Cycles it does not change
+const _BIT_PERIOD = 128
+const _BIT_PERIOD_FAST = 4
+
+// what is read when nothing is connected
+const _NO_DEVICE = 0xFF
+
+// Transfer_t is a byte sent by the master
+type Transfer_t struct {
+	Value uint8
+	// the master uses the CGB fast clock
+	Fast bool
+}
+
+// SerialDevice is plugged in the link port, the game boy is the master
+type SerialDevice interface {
+	// Transfer receives the byte sent with the internal clock
+	// and returns the one shifted back
+	Transfer(value uint8, fast bool) uint8
+}
+
+// Link is the cable to another machine, the other side can be the master too
+type Link interface {
+	SerialDevice
+	// Tick is called with the 2 MHz ticks elapsed (as the MBC3 clock), it
+	// keeps the two sides in step. It returns the byte sent by the other
+	// side when that one is the master
+	Tick(ticks uint) (Transfer_t, bool)
+	// Reply answers the transfer returned by Tick
+	Reply(value uint8)
+}
+
+// Serial is the link port
+type Serial struct {
+	interrupts *interrupts.Interrupts
+
+	registers []uint
+	// byte shifted in, most significant bit first
+	received  uint8
+	bits      uint
+	bit_clock uint
+	period    uint
+	// receives SB every time a transfer is started with the internal clock
+	// (test results, debug prints of homebrews), nil discards it
+	Output io.Writer
+	// the other end of the cable, nil when nothing is connected
+	device SerialDevice
+	link   Link
+}
+
+// New creates the serial connected to the other components
+func New(interrupts *interrupts.Interrupts) *Serial {
+	return &Serial{interrupts: interrupts}
+}
+
+func (s *Serial) Init() {
+	s.registers = make([]uint, _END_ADDR-_START_ADDR+1)
+	s.bits = 0
+	s.WriteToMemory(_SB, 0x00)
+	s.WriteToMemory(_SC, 0x7E)
+}
+
+// PostBoot is the state left by the boot rom, on cgb the fast clock
+// bit of SC reads as set
+func (s *Serial) PostBoot(cgb bool) {
+	if cgb {
+		s.registers[_SC-_START_ADDR] = 0x7F
+	}
+}
+
+// Connect plugs device in the link port, nil unplugs it
+func (s *Serial) Connect(device SerialDevice) {
+	s.device = device
+	s.link, _ = device.(Link)
 }
 
 func IsSerialAddr(addr uint) bool {
 	return addr >= _START_ADDR && addr <= _END_ADDR
 }
 
-func ReadFromMemory(addr uint) uint {
+func (s *Serial) ReadFromMemory(addr uint) uint {
 	if addr < _START_ADDR || addr > _END_ADDR {
-		log.Fatalf("Invalid sound address (0x%8X)", addr)
+		log.Fatalf("Invalid serial address (0x%8X)", addr)
 	}
-	return registers[addr-_START_ADDR]
+	return s.registers[addr-_START_ADDR]
 }
-func WriteToMemory(addr uint, value uint) {
+func (s *Serial) WriteToMemory(addr uint, value uint) {
 	if addr < _START_ADDR || addr > _END_ADDR {
-		log.Fatalf("Invalid sound address (0x%8X)", addr)
+		log.Fatalf("Invalid serial address (0x%8X)", addr)
+	}
+	s.registers[addr-_START_ADDR] = value
+	if addr != _SC || !utility.TestBit(value, _SC_TRANSFER_BIT) {
+		return
+	}
+	// with the external clock the transfer waits for the master
+	if !utility.TestBit(value, _SC_CLOCK_BIT) {
+		return
 	}
-	registers[addr-_START_ADDR] = value
-	if addr == _SC && isTransferring() {
-		resetSC()
-		interrupts.RequestInterruptSerial()
+	sb := s.registers[_SB-_START_ADDR]
+	if s.Output != nil {
+		s.Output.Write([]byte{uint8(sb)})
 	}
+	fast := utility.TestBit(value, _SC_SPEED_BIT)
+	received := uint8(_NO_DEVICE)
+	if s.device != nil {
+		received = s.device.Transfer(uint8(sb), fast)
+	}
+	s.startShift(received, fast)
 }
 
-func resetSC() {
-	registers[_SC-_START_ADDR] = 0x81
+// called every M-Cycle
+func (s *Serial) Tick(double_speed bool) {
+	if s.link != nil {
+		ticks := uint(2)
+		if double_speed {
+			ticks = 1
+		}
+		if transfer, ok := s.link.Tick(ticks); ok {
+			s.receive(transfer)
+		}
+	}
+	if s.bits == 0 {
+		return
+	}
+	s.bit_clock--
+	if s.bit_clock > 0 {
+		return
+	}
+	s.bit_clock = s.period
+	s.bits--
+	sb := s.registers[_SB-_START_ADDR]
+	s.registers[_SB-_START_ADDR] = (sb<<1 | uint(s.received>>s.bits)&0x1) & 0xFF
+	if s.bits == 0 {
+		s.registers[_SC-_START_ADDR] = utility.ClearBit(s.registers[_SC-_START_ADDR], _SC_TRANSFER_BIT)
+		s.interrupts.RequestInterruptSerial()
+	}
 }
-func isTransferring() bool {
-	return utility.TestBit(ReadFromMemory(_SB), 7)
+
+// the other side is the master, the byte is shifted in at its pace
+func (s *Serial) receive(transfer Transfer_t) {
+	sc := s.registers[_SC-_START_ADDR]
+	if s.bits > 0 || !utility.TestBit(sc, _SC_TRANSFER_BIT) || utility.TestBit(sc, _SC_CLOCK_BIT) {
+		s.link.Reply(_NO_DEVICE)
+		return
+	}
+	s.link.Reply(uint8(s.registers[_SB-_START_ADDR]))
+	s.startShift(transfer.Value, transfer.Fast)
+}
+
+func (s *Serial) startShift(received uint8, fast bool) {
+	s.received = received
+	s.bits = 8
+	s.period = _BIT_PERIOD
+	if fast {
+		s.period = _BIT_PERIOD_FAST
+	}
+	s.bit_clock = s.period
+}
+
+func (s *Serial) SaveState(enc *gob.Encoder) error {
+	return utility.EncodeAll(enc, s.registers, s.received, s.bits, s.bit_clock, s.period)
+}
+
+func (s *Serial) LoadState(dec *gob.Decoder) error {
+	return utility.DecodeAll(dec, &s.registers, &s.received, &s.bits, &s.bit_clock, &s.period)
 }
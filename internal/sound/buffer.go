@@ -0,0 +1,61 @@
+package sound
+
+import "sync"
+
+// RingBuffer is a fixed size FIFO of samples shared between the emulation
+// goroutine (producer) and the audio front end (consumer).
+// When it is full the oldest samples are overwritten.
+type RingBuffer struct {
+	lock  sync.Mutex
+	data  []int16
+	front int
+	size  int
+}
+
+func NewRingBuffer(capacity int) *RingBuffer {
+	return &RingBuffer{data: make([]int16, capacity)}
+}
+
+func (b *RingBuffer) Write(samples []int16) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, s := range samples {
+		back := (b.front + b.size) % len(b.data)
+		b.data[back] = s
+		if b.size < len(b.data) {
+			b.size++
+		} else {
+			// drop the oldest one
+			b.front = (b.front + 1) % len(b.data)
+		}
+	}
+}
+
+// Read copies at most len(dst) samples into dst and returns how many were copied
+func (b *RingBuffer) Read(dst []int16) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	n := len(dst)
+	if n > b.size {
+		n = b.size
+	}
+	for i := 0; i < n; i++ {
+		dst[i] = b.data[b.front]
+		b.front = (b.front + 1) % len(b.data)
+	}
+	b.size -= n
+	return n
+}
+
+func (b *RingBuffer) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.size
+}
+
+func (b *RingBuffer) Clear() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.front = 0
+	b.size = 0
+}
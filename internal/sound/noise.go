@@ -0,0 +1,80 @@
+package sound
+
+import "github.com/giammirove/gampboy_emulator/internal/utility"
+
+var _NOISE_DIVISORS = [8]uint{8, 16, 32, 48, 64, 80, 96, 112}
+
+type noise_t struct {
+	enabled     bool
+	dac_enabled bool
+
+	shift      uint
+	width_7bit bool
+	divisor    uint
+	freq_timer uint
+	lfsr       uint
+
+	length         uint
+	length_enabled bool
+
+	envelope envelope_t
+}
+
+func (n *noise_t) writePolynomial(value uint) {
+	n.shift = (value >> 4) & 0xF
+	n.width_7bit = utility.TestBit(value, 3)
+	n.divisor = _NOISE_DIVISORS[value&0x7]
+}
+
+func (n *noise_t) period() uint {
+	if n.divisor == 0 {
+		return _NOISE_DIVISORS[0] << n.shift
+	}
+	return n.divisor << n.shift
+}
+
+func (n *noise_t) trigger() {
+	n.enabled = n.dac_enabled
+	if n.length == 0 {
+		n.length = 64
+	}
+	n.freq_timer = n.period()
+	n.envelope.trigger()
+	n.lfsr = 0x7FFF
+}
+
+func (n *noise_t) clockLength() {
+	if n.length_enabled && n.length > 0 {
+		n.length--
+		if n.length == 0 {
+			n.enabled = false
+		}
+	}
+}
+
+func (n *noise_t) tick() {
+	if n.freq_timer > 0 {
+		n.freq_timer--
+	}
+	if n.freq_timer != 0 {
+		return
+	}
+	n.freq_timer = n.period()
+	// shifting with clock 14 and 15 stops the lfsr
+	if n.shift >= 14 {
+		return
+	}
+	xor := (n.lfsr & 1) ^ ((n.lfsr >> 1) & 1)
+	n.lfsr = (n.lfsr >> 1) | xor<<14
+	if n.width_7bit {
+		n.lfsr = utility.WriteBit(n.lfsr, 6, xor)
+	}
+}
+
+func (n *noise_t) output() uint {
+	if !n.enabled {
+		return 0
+	}
+	// the output is the inverted bit 0
+	return (^n.lfsr & 1) * n.envelope.volume
+}
@@ -1,52 +1,442 @@
 package sound
 
-import "log"
+import (
+	"log"
+	"sync"
 
-var registers []uint
+	"github.com/giammirove/gampboy_emulator/internal/headers"
+	"github.com/giammirove/gampboy_emulator/internal/utility"
+)
+
+// APU is the audio processing unit
+type APU struct {
+	headers               *headers.Header
+	registers             []uint
+	wave_ram              [_WAVE_RAM_END - _WAVE_RAM_START + 1]uint8
+	powered               bool
+	ch1                   square_t
+	ch2                   square_t
+	ch3                   wave_t
+	ch4                   noise_t
+	frame_sequencer_clock uint
+	frame_sequencer_step  uint
+	// how many samples have to be produced, in units of 1/CLOCK_SPEED
+	sample_clock uint
+	// high-pass filter state, it removes the DC offset like the real capacitors
+	hpf_left  float64
+	hpf_right float64
+	// samples are accumulated and flushed to the ring buffer in batches
+	pending       [1024]int16
+	pending_len   int
+	recorder      *WAVWriter
+	recorder_lock sync.Mutex
+	// stereo interleaved samples (left, right) at SAMPLE_RATE Hz
+	Samples *RingBuffer
+}
+
+// New creates the sound, Init resets it
+func New(headers *headers.Header) *APU {
+	return &APU{headers: headers}
+}
 
 const _START_ADDR = 0xFF10
 const _END_ADDR = 0xFF26
+const _WAVE_RAM_START = 0xFF30
+const _WAVE_RAM_END = 0xFF3F
+
+// channel 1 - square with sweep
+const _NR10 = 0xFF10
+const _NR11 = 0xFF11
+const _NR12 = 0xFF12
+const _NR13 = 0xFF13
+const _NR14 = 0xFF14
+
+// channel 2 - square
+const _NR21 = 0xFF16
+const _NR22 = 0xFF17
+const _NR23 = 0xFF18
+const _NR24 = 0xFF19
+
+// channel 3 - wave
+const _NR30 = 0xFF1A
+const _NR31 = 0xFF1B
+const _NR32 = 0xFF1C
+const _NR33 = 0xFF1D
+const _NR34 = 0xFF1E
+
+// channel 4 - noise
+const _NR41 = 0xFF20
+const _NR42 = 0xFF21
+const _NR43 = 0xFF22
+const _NR44 = 0xFF23
 
-func Init() {
-	registers = make([]uint, _END_ADDR-_START_ADDR+1)
-	WriteToMemory(0xFF10, 0x80)
-	WriteToMemory(0xFF11, 0xBF)
-	WriteToMemory(0xFF12, 0xF3)
-	WriteToMemory(0xFF13, 0xFF)
-	WriteToMemory(0xFF14, 0xBF)
-	WriteToMemory(0xFF15, 0xFF)
-	WriteToMemory(0xFF16, 0x3F)
-	WriteToMemory(0xFF17, 0x00)
-	WriteToMemory(0xFF18, 0xFF)
-	WriteToMemory(0xFF19, 0xBF)
-	WriteToMemory(0xFF1A, 0x7F)
-	WriteToMemory(0xFF1B, 0xFF)
-	WriteToMemory(0xFF1C, 0x9F)
-	WriteToMemory(0xFF1D, 0xFF)
-	WriteToMemory(0xFF1E, 0xBF)
-	WriteToMemory(0xFF1F, 0xFF)
-	WriteToMemory(0xFF20, 0xFF)
-	WriteToMemory(0xFF21, 0x00)
-	WriteToMemory(0xFF22, 0x00)
-	WriteToMemory(0xFF23, 0xBF)
-	WriteToMemory(0xFF24, 0x77)
-	WriteToMemory(0xFF25, 0xF3)
-	WriteToMemory(0xFF26, 0xF1)
+// master control
+const _NR50 = 0xFF24
+const _NR51 = 0xFF25
+const _NR52 = 0xFF26
+
+const _NR52_POWER_BIT = 7
+const _NRX4_TRIGGER_BIT = 7
+const _NRX4_LENGTH_ENABLE_BIT = 6
+
+const CLOCK_SPEED = 4194304
+const SAMPLE_RATE = 44100
+const CHANNELS = 2
+
+// the frame sequencer runs at 512 Hz
+const _FRAME_SEQUENCER_PERIOD = CLOCK_SPEED / 512
+
+// unused bits read back as 1
+var _READ_MASKS = [_END_ADDR - _START_ADDR + 1]uint{
+	0x80, 0x3F, 0x00, 0xFF, 0xBF, // NR10 - NR14
+	0xFF, 0x3F, 0x00, 0xFF, 0xBF, // ---- - NR24
+	0x7F, 0xFF, 0x9F, 0xFF, 0xBF, // NR30 - NR34
+	0xFF, 0xFF, 0x00, 0x00, 0xBF, // ---- - NR44
+	0x00, 0x00, 0x70, // NR50 - NR52
+}
+
+const _HPF_CHARGE = 0.996
+
+func (a *APU) Init() {
+	a.registers = make([]uint, _END_ADDR-_START_ADDR+1)
+	a.powered = false
+	a.wave_ram = [_WAVE_RAM_END - _WAVE_RAM_START + 1]uint8{}
+	a.ch1 = square_t{has_sweep: true}
+	a.ch2 = square_t{}
+	a.ch3 = wave_t{}
+	a.ch4 = noise_t{}
+	a.frame_sequencer_clock = 0
+	a.frame_sequencer_step = 0
+	a.sample_clock = 0
+	a.hpf_left = 0
+	a.hpf_right = 0
+	a.pending_len = 0
+	if a.Samples == nil {
+		a.Samples = NewRingBuffer(SAMPLE_RATE * CHANNELS / 4)
+	}
+	a.Samples.Clear()
+}
+
+// PostBoot is the state left by the boot rom, it played the sound of
+// the logo on channel 1
+func (a *APU) PostBoot() {
+	a.WriteToMemory(_NR52, 0xF1)
+	a.WriteToMemory(_NR10, 0x80)
+	a.WriteToMemory(_NR11, 0xBF)
+	a.WriteToMemory(_NR12, 0xF3)
+	a.WriteToMemory(_NR13, 0xFF)
+	a.WriteToMemory(_NR14, 0x3F)
+	a.WriteToMemory(_NR21, 0x3F)
+	a.WriteToMemory(_NR22, 0x00)
+	a.WriteToMemory(_NR23, 0xFF)
+	a.WriteToMemory(_NR24, 0x3F)
+	a.WriteToMemory(_NR30, 0x7F)
+	a.WriteToMemory(_NR31, 0xFF)
+	a.WriteToMemory(_NR32, 0x9F)
+	a.WriteToMemory(_NR33, 0xFF)
+	a.WriteToMemory(_NR34, 0x3F)
+	a.WriteToMemory(_NR41, 0xFF)
+	a.WriteToMemory(_NR42, 0x00)
+	a.WriteToMemory(_NR43, 0x00)
+	a.WriteToMemory(_NR44, 0x3F)
+	a.WriteToMemory(_NR50, 0x77)
+	a.WriteToMemory(_NR51, 0xF3)
+	// the boot rom leaves channel 1 on, with the envelope faded out
+	a.ch1.enabled = true
+	a.ch1.envelope.volume = 0
 }
 
 func IsSoundAddr(addr uint) bool {
-	return addr >= _START_ADDR && addr <= _END_ADDR
+	return (addr >= _START_ADDR && addr <= _END_ADDR) || IsWaveRAMAddr(addr)
+}
+func IsWaveRAMAddr(addr uint) bool {
+	return addr >= _WAVE_RAM_START && addr <= _WAVE_RAM_END
 }
 
-func ReadFromMemory(addr uint) uint {
+func (a *APU) ReadFromMemory(addr uint) uint {
+	if IsWaveRAMAddr(addr) {
+		return uint(a.wave_ram[addr-_WAVE_RAM_START])
+	}
 	if addr < _START_ADDR || addr > _END_ADDR {
 		log.Fatalf("Invalid sound address (0x%8X)", addr)
 	}
-	return registers[addr-_START_ADDR]
+	if addr == _NR52 {
+		r := _READ_MASKS[_NR52-_START_ADDR]
+		if a.powered {
+			r = utility.SetBit(r, _NR52_POWER_BIT)
+		}
+		if a.ch1.enabled {
+			r = utility.SetBit(r, 0)
+		}
+		if a.ch2.enabled {
+			r = utility.SetBit(r, 1)
+		}
+		if a.ch3.enabled {
+			r = utility.SetBit(r, 2)
+		}
+		if a.ch4.enabled {
+			r = utility.SetBit(r, 3)
+		}
+		return r
+	}
+	return a.registers[addr-_START_ADDR] | _READ_MASKS[addr-_START_ADDR]
 }
-func WriteToMemory(addr uint, value uint) {
+func (a *APU) WriteToMemory(addr uint, value uint) {
+	if IsWaveRAMAddr(addr) {
+		a.wave_ram[addr-_WAVE_RAM_START] = uint8(value)
+		return
+	}
 	if addr < _START_ADDR || addr > _END_ADDR {
 		log.Fatalf("Invalid sound address (0x%8X)", addr)
 	}
-	registers[addr-_START_ADDR] = value
+	value &= 0xFF
+	if addr == _NR52 {
+		a.setPower(utility.TestBit(value, _NR52_POWER_BIT))
+		return
+	}
+	// while the APU is off registers are read only,
+	// but the dmg still accepts the lengths
+	if !a.powered {
+		if !a.headers.GetModel().IsColor() {
+			a.writeLengthOff(addr, value)
+		}
+		return
+	}
+	a.registers[addr-_START_ADDR] = value
+
+	switch addr {
+	case _NR10:
+		a.ch1.writeSweep(value)
+	case _NR11:
+		a.ch1.writeLength(value)
+	case _NR12:
+		a.ch1.envelope.write(value)
+		a.ch1.dac_enabled = value&0xF8 != 0
+		if !a.ch1.dac_enabled {
+			a.ch1.enabled = false
+		}
+	case _NR13:
+		a.ch1.freq = a.ch1.freq&0x700 | value
+	case _NR14:
+		a.ch1.freq = a.ch1.freq&0xFF | (value&0x7)<<8
+		a.ch1.length_enabled = utility.TestBit(value, _NRX4_LENGTH_ENABLE_BIT)
+		if utility.TestBit(value, _NRX4_TRIGGER_BIT) {
+			a.ch1.trigger()
+		}
+	case _NR21:
+		a.ch2.writeLength(value)
+	case _NR22:
+		a.ch2.envelope.write(value)
+		a.ch2.dac_enabled = value&0xF8 != 0
+		if !a.ch2.dac_enabled {
+			a.ch2.enabled = false
+		}
+	case _NR23:
+		a.ch2.freq = a.ch2.freq&0x700 | value
+	case _NR24:
+		a.ch2.freq = a.ch2.freq&0xFF | (value&0x7)<<8
+		a.ch2.length_enabled = utility.TestBit(value, _NRX4_LENGTH_ENABLE_BIT)
+		if utility.TestBit(value, _NRX4_TRIGGER_BIT) {
+			a.ch2.trigger()
+		}
+	case _NR30:
+		a.ch3.dac_enabled = utility.TestBit(value, 7)
+		if !a.ch3.dac_enabled {
+			a.ch3.enabled = false
+		}
+	case _NR31:
+		a.ch3.length = 256 - value
+	case _NR32:
+		a.ch3.volume_code = (value >> 5) & 0x3
+	case _NR33:
+		a.ch3.freq = a.ch3.freq&0x700 | value
+	case _NR34:
+		a.ch3.freq = a.ch3.freq&0xFF | (value&0x7)<<8
+		a.ch3.length_enabled = utility.TestBit(value, _NRX4_LENGTH_ENABLE_BIT)
+		if utility.TestBit(value, _NRX4_TRIGGER_BIT) {
+			a.ch3.trigger()
+		}
+	case _NR41:
+		a.ch4.length = 64 - value&0x3F
+	case _NR42:
+		a.ch4.envelope.write(value)
+		a.ch4.dac_enabled = value&0xF8 != 0
+		if !a.ch4.dac_enabled {
+			a.ch4.enabled = false
+		}
+	case _NR43:
+		a.ch4.writePolynomial(value)
+	case _NR44:
+		a.ch4.length_enabled = utility.TestBit(value, _NRX4_LENGTH_ENABLE_BIT)
+		if utility.TestBit(value, _NRX4_TRIGGER_BIT) {
+			a.ch4.trigger()
+		}
+	}
+}
+
+// only the length counters, the rest of the registers stay 0
+func (a *APU) writeLengthOff(addr uint, value uint) {
+	switch addr {
+	case _NR11:
+		a.ch1.length = 64 - value&0x3F
+	case _NR21:
+		a.ch2.length = 64 - value&0x3F
+	case _NR31:
+		a.ch3.length = 256 - value
+	case _NR41:
+		a.ch4.length = 64 - value&0x3F
+	}
+}
+
+func (a *APU) setPower(on bool) {
+	if a.powered && !on {
+		// turning the APU off clears every register,
+		// the dmg keeps the length counters
+		lengths := [4]uint{a.ch1.length, a.ch2.length, a.ch3.length, a.ch4.length}
+		for i := range a.registers {
+			a.registers[i] = 0
+		}
+		a.ch1 = square_t{has_sweep: true}
+		a.ch2 = square_t{}
+		a.ch3 = wave_t{}
+		a.ch4 = noise_t{}
+		if !a.headers.GetModel().IsColor() {
+			a.ch1.length, a.ch2.length, a.ch3.length, a.ch4.length = lengths[0], lengths[1], lengths[2], lengths[3]
+		}
+	}
+	if !a.powered && on {
+		a.frame_sequencer_step = 0
+		a.frame_sequencer_clock = 0
+	}
+	a.powered = on
+}
+
+// called every T-cycle
+func (a *APU) Tick() {
+	if a.powered {
+		a.frame_sequencer_clock++
+		if a.frame_sequencer_clock >= _FRAME_SEQUENCER_PERIOD {
+			a.frame_sequencer_clock = 0
+			a.stepFrameSequencer()
+		}
+		a.ch1.tick()
+		a.ch2.tick()
+		a.ch3.tick(&a.wave_ram)
+		a.ch4.tick()
+	}
+
+	a.sample_clock += SAMPLE_RATE
+	if a.sample_clock >= CLOCK_SPEED {
+		a.sample_clock -= CLOCK_SPEED
+		a.mixSample()
+	}
+}
+
+// Step   Length Ctr  Vol Env     Sweep
+// ---------------------------------------
+// 0      Clock       -           -
+// 1      -           -           -
+// 2      Clock       -           Clock
+// 3      -           -           -
+// 4      Clock       -           -
+// 5      -           -           -
+// 6      Clock       -           Clock
+// 7      -           Clock       -
+func (a *APU) stepFrameSequencer() {
+	switch a.frame_sequencer_step {
+	case 0, 4:
+		a.clockLength()
+	case 2, 6:
+		a.clockLength()
+		a.ch1.clockSweep(a.registers)
+	case 7:
+		a.ch1.envelope.clock(a.ch1.enabled)
+		a.ch2.envelope.clock(a.ch2.enabled)
+		a.ch4.envelope.clock(a.ch4.enabled)
+	}
+	a.frame_sequencer_step = (a.frame_sequencer_step + 1) & 0x7
+}
+
+func (a *APU) clockLength() {
+	a.ch1.clockLength()
+	a.ch2.clockLength()
+	a.ch3.clockLength()
+	a.ch4.clockLength()
+}
+
+// the DAC maps the digital value 0-15 to -1.0 +1.0
+func dac(enabled bool, value uint) float64 {
+	if !enabled {
+		return 0
+	}
+	return float64(value)/7.5 - 1
+}
+
+func (a *APU) mixSample() {
+	left := float64(0)
+	right := float64(0)
+	if a.powered {
+		outputs := [4]float64{
+			dac(a.ch1.dac_enabled, a.ch1.output()),
+			dac(a.ch2.dac_enabled, a.ch2.output()),
+			dac(a.ch3.dac_enabled, a.ch3.output()),
+			dac(a.ch4.dac_enabled, a.ch4.output()),
+		}
+		nr51 := a.registers[_NR51-_START_ADDR]
+		for i := uint(0); i < 4; i++ {
+			if utility.TestBit(nr51, i) {
+				right += outputs[i]
+			}
+			if utility.TestBit(nr51, i+4) {
+				left += outputs[i]
+			}
+		}
+		nr50 := a.registers[_NR50-_START_ADDR]
+		left = left / 4 * float64((nr50>>4)&0x7+1) / 8
+		right = right / 4 * float64(nr50&0x7+1) / 8
+	}
+
+	out_left := left - a.hpf_left
+	a.hpf_left = left - out_left*_HPF_CHARGE
+	out_right := right - a.hpf_right
+	a.hpf_right = right - out_right*_HPF_CHARGE
+
+	a.pushSample(toPCM(out_left), toPCM(out_right))
+}
+
+func toPCM(v float64) int16 {
+	v *= 32767
+	if v > 32767 {
+		v = 32767
+	}
+	if v < -32768 {
+		v = -32768
+	}
+	return int16(v)
+}
+
+func (a *APU) pushSample(left int16, right int16) {
+	a.pending[a.pending_len] = left
+	a.pending[a.pending_len+1] = right
+	a.pending_len += 2
+	if a.pending_len < len(a.pending) {
+		return
+	}
+	a.Samples.Write(a.pending[:a.pending_len])
+	a.recorder_lock.Lock()
+	if a.recorder != nil {
+		if err := a.recorder.Write(a.pending[:a.pending_len]); err != nil {
+			log.Printf("Error while recording audio: %s\n", err)
+			a.recorder = nil
+		}
+	}
+	a.recorder_lock.Unlock()
+	a.pending_len = 0
+}
+
+// every produced sample is also written to w, nil stops the recording
+func (a *APU) SetRecorder(w *WAVWriter) {
+	a.recorder_lock.Lock()
+	a.recorder = w
+	a.recorder_lock.Unlock()
 }
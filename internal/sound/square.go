@@ -0,0 +1,175 @@
+package sound
+
+import "github.com/giammirove/gampboy_emulator/internal/utility"
+
+// 12.5% , 25% , 50% , 75%
+var _DUTY_PATTERNS = [4][8]uint{
+	{0, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 1, 1, 1},
+	{0, 1, 1, 1, 1, 1, 1, 0},
+}
+
+const _MAX_FREQ = 2047
+
+type envelope_t struct {
+	initial  uint
+	volume   uint
+	increase bool
+	period   uint
+	timer    uint
+}
+
+func (e *envelope_t) write(value uint) {
+	e.initial = (value >> 4) & 0xF
+	e.increase = utility.TestBit(value, 3)
+	e.period = value & 0x7
+}
+
+func (e *envelope_t) trigger() {
+	e.volume = e.initial
+	e.timer = e.period
+	if e.timer == 0 {
+		e.timer = 8
+	}
+}
+
+func (e *envelope_t) clock(enabled bool) {
+	if !enabled || e.period == 0 {
+		return
+	}
+	if e.timer > 0 {
+		e.timer--
+	}
+	if e.timer != 0 {
+		return
+	}
+	e.timer = e.period
+	if e.increase && e.volume < 0xF {
+		e.volume++
+	} else if !e.increase && e.volume > 0 {
+		e.volume--
+	}
+}
+
+type square_t struct {
+	enabled     bool
+	dac_enabled bool
+
+	duty       uint
+	duty_pos   uint
+	freq       uint
+	freq_timer uint
+
+	length         uint
+	length_enabled bool
+
+	envelope envelope_t
+
+	// channel 1 only
+	has_sweep     bool
+	sweep_enabled bool
+	sweep_period  uint
+	sweep_timer   uint
+	sweep_shift   uint
+	sweep_negate  bool
+	sweep_shadow  uint
+}
+
+func (s *square_t) writeLength(value uint) {
+	s.duty = (value >> 6) & 0x3
+	s.length = 64 - value&0x3F
+}
+
+func (s *square_t) writeSweep(value uint) {
+	s.sweep_period = (value >> 4) & 0x7
+	s.sweep_negate = utility.TestBit(value, 3)
+	s.sweep_shift = value & 0x7
+}
+
+func (s *square_t) trigger() {
+	s.enabled = s.dac_enabled
+	if s.length == 0 {
+		s.length = 64
+	}
+	s.freq_timer = (2048 - s.freq) * 4
+	s.envelope.trigger()
+
+	if s.has_sweep {
+		s.sweep_shadow = s.freq
+		s.sweep_timer = s.sweep_period
+		if s.sweep_timer == 0 {
+			s.sweep_timer = 8
+		}
+		s.sweep_enabled = s.sweep_period != 0 || s.sweep_shift != 0
+		if s.sweep_shift != 0 {
+			// only the overflow check is done here
+			s.sweepFrequency()
+		}
+	}
+}
+
+// the new frequency is calculated from the shadow register
+// if it overflows the channel is disabled
+func (s *square_t) sweepFrequency() uint {
+	delta := s.sweep_shadow >> s.sweep_shift
+	freq := s.sweep_shadow + delta
+	if s.sweep_negate {
+		freq = s.sweep_shadow - delta
+	}
+	if freq > _MAX_FREQ {
+		s.enabled = false
+	}
+	return freq
+}
+
+func (s *square_t) clockSweep(registers []uint) {
+	if s.sweep_timer > 0 {
+		s.sweep_timer--
+	}
+	if s.sweep_timer != 0 {
+		return
+	}
+	s.sweep_timer = s.sweep_period
+	if s.sweep_timer == 0 {
+		s.sweep_timer = 8
+	}
+	if !s.sweep_enabled || s.sweep_period == 0 {
+		return
+	}
+	freq := s.sweepFrequency()
+	if freq <= _MAX_FREQ && s.sweep_shift != 0 {
+		s.sweep_shadow = freq
+		s.freq = freq
+		registers[_NR13-_START_ADDR] = freq & 0xFF
+		registers[_NR14-_START_ADDR] = registers[_NR14-_START_ADDR]&0xF8 | (freq>>8)&0x7
+		// check the overflow again with the new value
+		s.sweepFrequency()
+	}
+}
+
+func (s *square_t) clockLength() {
+	if s.length_enabled && s.length > 0 {
+		s.length--
+		if s.length == 0 {
+			s.enabled = false
+		}
+	}
+}
+
+func (s *square_t) tick() {
+	if s.freq_timer > 0 {
+		s.freq_timer--
+	}
+	if s.freq_timer == 0 {
+		s.freq_timer = (2048 - s.freq) * 4
+		s.duty_pos = (s.duty_pos + 1) & 0x7
+	}
+}
+
+func (s *square_t) output() uint {
+	if !s.enabled {
+		return 0
+	}
+	return _DUTY_PATTERNS[s.duty][s.duty_pos] * s.envelope.volume
+}
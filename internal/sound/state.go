@@ -0,0 +1,53 @@
+package sound
+
+import (
+	"encoding/gob"
+
+	"github.com/giammirove/gampboy_emulator/internal/utility"
+)
+
+// gob follows the pointers, the same list is used to save and to load
+
+func (e *envelope_t) fields() []interface{} {
+	return []interface{}{&e.initial, &e.volume, &e.increase, &e.period, &e.timer}
+}
+
+func (s *square_t) fields() []interface{} {
+	return append(s.envelope.fields(), &s.enabled, &s.dac_enabled, &s.duty, &s.duty_pos, &s.freq, &s.freq_timer,
+		&s.length, &s.length_enabled, &s.sweep_enabled, &s.sweep_period, &s.sweep_timer, &s.sweep_shift,
+		&s.sweep_negate, &s.sweep_shadow)
+}
+
+func (w *wave_t) fields() []interface{} {
+	return []interface{}{&w.enabled, &w.dac_enabled, &w.freq, &w.freq_timer, &w.position, &w.sample,
+		&w.volume_code, &w.length, &w.length_enabled}
+}
+
+func (n *noise_t) fields() []interface{} {
+	return append(n.envelope.fields(), &n.enabled, &n.dac_enabled, &n.shift, &n.width_7bit, &n.divisor,
+		&n.freq_timer, &n.lfsr, &n.length, &n.length_enabled)
+}
+
+func (a *APU) stateFields() []interface{} {
+	fields := []interface{}{&a.registers, &a.wave_ram, &a.powered, &a.frame_sequencer_clock, &a.frame_sequencer_step, &a.sample_clock}
+	fields = append(fields, a.ch1.fields()...)
+	fields = append(fields, a.ch2.fields()...)
+	fields = append(fields, a.ch3.fields()...)
+	return append(fields, a.ch4.fields()...)
+}
+
+func (a *APU) SaveState(enc *gob.Encoder) error {
+	return utility.EncodeAll(enc, a.stateFields()...)
+}
+
+func (a *APU) LoadState(dec *gob.Decoder) error {
+	if err := utility.DecodeAll(dec, a.stateFields()...); err != nil {
+		return err
+	}
+	// the old samples do not belong to the restored state
+	a.pending_len = 0
+	a.hpf_left = 0
+	a.hpf_right = 0
+	a.Samples.Clear()
+	return nil
+}
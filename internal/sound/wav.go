@@ -0,0 +1,69 @@
+package sound
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const _WAV_HEADER_SIZE = 44
+const _BITS_PER_SAMPLE = 16
+
+// WAVWriter writes 16 bit stereo PCM samples as a RIFF/WAVE file.
+// The sizes in the header are fixed when the writer is closed.
+type WAVWriter struct {
+	w          io.WriteSeeker
+	data_bytes uint32
+}
+
+func NewWAVWriter(w io.WriteSeeker) (*WAVWriter, error) {
+	wav := &WAVWriter{w: w}
+	if err := wav.writeHeader(); err != nil {
+		return nil, err
+	}
+	return wav, nil
+}
+
+func (wav *WAVWriter) writeHeader() error {
+	block_align := uint16(CHANNELS * _BITS_PER_SAMPLE / 8)
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(_WAV_HEADER_SIZE - 8 + wav.data_bytes),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),
+		uint16(1), // PCM
+		uint16(CHANNELS),
+		uint32(SAMPLE_RATE),
+		uint32(SAMPLE_RATE) * uint32(block_align),
+		block_align,
+		uint16(_BITS_PER_SAMPLE),
+		[4]byte{'d', 'a', 't', 'a'},
+		wav.data_bytes,
+	}
+	for _, field := range header {
+		if err := binary.Write(wav.w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wav *WAVWriter) Write(samples []int16) error {
+	if err := binary.Write(wav.w, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	wav.data_bytes += uint32(len(samples) * 2)
+	return nil
+}
+
+// Close updates the header, the underlying writer is not closed
+func (wav *WAVWriter) Close() error {
+	if _, err := wav.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := wav.writeHeader(); err != nil {
+		return err
+	}
+	_, err := wav.w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,64 @@
+package sound
+
+// volume code -> right shift of the 4 bit sample
+// 0 = mute, 1 = 100%, 2 = 50%, 3 = 25%
+var _WAVE_VOLUME_SHIFT = [4]uint{4, 0, 1, 2}
+
+const _WAVE_SAMPLES = 32
+
+type wave_t struct {
+	enabled     bool
+	dac_enabled bool
+
+	freq       uint
+	freq_timer uint
+	position   uint
+	sample     uint
+
+	volume_code uint
+
+	length         uint
+	length_enabled bool
+}
+
+func (w *wave_t) trigger() {
+	w.enabled = w.dac_enabled
+	if w.length == 0 {
+		w.length = 256
+	}
+	w.freq_timer = (2048 - w.freq) * 2
+	w.position = 0
+}
+
+func (w *wave_t) clockLength() {
+	if w.length_enabled && w.length > 0 {
+		w.length--
+		if w.length == 0 {
+			w.enabled = false
+		}
+	}
+}
+
+func (w *wave_t) tick(wave_ram *[_WAVE_RAM_END - _WAVE_RAM_START + 1]uint8) {
+	if w.freq_timer > 0 {
+		w.freq_timer--
+	}
+	if w.freq_timer == 0 {
+		w.freq_timer = (2048 - w.freq) * 2
+		w.position = (w.position + 1) % _WAVE_SAMPLES
+		// every byte of wave RAM holds two samples, upper nibble first
+		b := uint(wave_ram[w.position/2])
+		if w.position%2 == 0 {
+			w.sample = b >> 4
+		} else {
+			w.sample = b & 0xF
+		}
+	}
+}
+
+func (w *wave_t) output() uint {
+	if !w.enabled {
+		return 0
+	}
+	return w.sample >> _WAVE_VOLUME_SHIFT[w.volume_code]
+}
@@ -0,0 +1,153 @@
+// Package symbols reads the .sym files written by RGBDS and WLA,
+// every line is "bank:address label"
+package symbols
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Table maps a bank and an address to a label
+type Table struct {
+	labels map[uint]string
+	names  map[string]uint
+	// keys sorted by address, to find the label before an address
+	sorted []uint
+}
+
+func key(bank uint, addr uint) uint {
+	return bank<<16 | addr&0xFFFF
+}
+
+// New creates an empty table
+func New() *Table {
+	return &Table{labels: map[uint]string{}, names: map[string]uint{}}
+}
+
+// Load reads the symbol file at path
+func Load(path string) (*Table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+// Parse reads a symbol file, the lines that are not symbols (comments,
+// sections of WLA as [definitions]) are skipped
+func Parse(r io.Reader) (*Table, error) {
+	t := New()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		location := strings.SplitN(fields[0], ":", 2)
+		if len(location) != 2 {
+			continue
+		}
+		bank, err := strconv.ParseUint(location[0], 16, 16)
+		if err != nil {
+			continue
+		}
+		addr, err := strconv.ParseUint(location[1], 16, 16)
+		if err != nil {
+			continue
+		}
+		t.Add(uint(bank), uint(addr), fields[1])
+	}
+	return t, scanner.Err()
+}
+
+// Add sets the label of bank:addr, the first one wins
+func (t *Table) Add(bank uint, addr uint, label string) {
+	if _, ok := t.labels[key(bank, addr)]; !ok {
+		t.labels[key(bank, addr)] = label
+		t.sorted = nil
+	}
+	if _, ok := t.names[label]; !ok {
+		t.names[label] = key(bank, addr)
+	}
+}
+
+// Label is the label exactly at bank:addr
+func (t *Table) Label(bank uint, addr uint) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	label, ok := t.labels[key(bank, addr)]
+	return label, ok
+}
+
+// Find is the location of a label
+func (t *Table) Find(label string) (uint, uint, bool) {
+	if t == nil {
+		return 0, 0, false
+	}
+	k, ok := t.names[label]
+	return k >> 16, k & 0xFFFF, ok
+}
+
+// labels farther than this from an address don't describe it
+const _MAX_OFFSET = 0x1000
+
+// Format describes bank:addr as the closest label before it in the
+// same bank (Label+$offset), or as the bare address
+func (t *Table) Format(bank uint, addr uint) string {
+	if t.Len() == 0 {
+		return fmt.Sprintf("$%04X", addr)
+	}
+	if t.sorted == nil {
+		t.sort()
+	}
+	k := key(bank, addr)
+	i := sort.Search(len(t.sorted), func(i int) bool { return t.sorted[i] > k }) - 1
+	if i < 0 || t.sorted[i]>>16 != bank || k-t.sorted[i] >= _MAX_OFFSET {
+		return fmt.Sprintf("$%04X", addr)
+	}
+	label := t.labels[t.sorted[i]]
+	if t.sorted[i] == k {
+		return label
+	}
+	return fmt.Sprintf("%s+$%X", label, k-t.sorted[i])
+}
+
+func (t *Table) sort() {
+	t.sorted = make([]uint, 0, len(t.labels))
+	for k := range t.labels {
+		t.sorted = append(t.sorted, k)
+	}
+	sort.Slice(t.sorted, func(i, j int) bool { return t.sorted[i] < t.sorted[j] })
+}
+
+// Each calls f for every label, sorted by bank and address
+func (t *Table) Each(f func(bank uint, addr uint, label string)) {
+	if t.Len() == 0 {
+		return
+	}
+	if t.sorted == nil {
+		t.sort()
+	}
+	for _, k := range t.sorted {
+		f(k>>16, k&0xFFFF, t.labels[k])
+	}
+}
+
+// Len is the number of labels
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.labels)
+}
@@ -0,0 +1,117 @@
+package symbols
+
+import (
+	"strings"
+	"testing"
+)
+
+const _SYM = `; File generated by rgblink
+00:0150 Main
+00:0158 Main.loop
+00:0160 Main.loop ; a local with the name of another
+01:4000 Bank1Start
+; 02:4000 Commented
+02:4A10 UpdateScore
+02:4A18 .skip
+C0:D000 wScore
+[definitions]
+0000002a Answer
+zz:4000 NotABank
+03:zzzz NotAnAddress
+04:4000
+`
+
+func TestParse(t *testing.T) {
+	table, err := Parse(strings.NewReader(_SYM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Len() != 7 {
+		t.Errorf("%d labels, expected 7", table.Len())
+	}
+	labels := []struct {
+		bank  uint
+		addr  uint
+		label string
+		ok    bool
+	}{
+		{0x00, 0x0150, "Main", true},
+		{0x00, 0x0158, "Main.loop", true},
+		{0x00, 0x0160, "Main.loop", true},
+		{0x01, 0x4000, "Bank1Start", true},
+		{0x02, 0x4000, "", false},
+		{0x02, 0x4A10, "UpdateScore", true},
+		{0x02, 0x4A18, ".skip", true},
+		{0xC0, 0xD000, "wScore", true},
+		{0x03, 0x4000, "", false},
+		{0x00, 0x0151, "", false},
+	}
+	for _, l := range labels {
+		label, ok := table.Label(l.bank, l.addr)
+		if label != l.label || ok != l.ok {
+			t.Errorf("%02X:%04X is %q %t, expected %q %t", l.bank, l.addr, label, ok, l.label, l.ok)
+		}
+	}
+	// the first location of a label wins
+	finds := []struct {
+		label string
+		bank  uint
+		addr  uint
+		ok    bool
+	}{
+		{"Main.loop", 0x00, 0x0158, true},
+		{"UpdateScore", 0x02, 0x4A10, true},
+		{"wScore", 0xC0, 0xD000, true},
+		{"Commented", 0, 0, false},
+		{"Answer", 0, 0, false},
+	}
+	for _, f := range finds {
+		bank, addr, ok := table.Find(f.label)
+		if bank != f.bank || addr != f.addr || ok != f.ok {
+			t.Errorf("%s at %02X:%04X %t, expected %02X:%04X %t", f.label, bank, addr, ok, f.bank, f.addr, f.ok)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	table, err := Parse(strings.NewReader(_SYM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		bank uint
+		addr uint
+		want string
+	}{
+		{0x00, 0x0150, "Main"},
+		{0x00, 0x0153, "Main+$3"},
+		{0x00, 0x015F, "Main.loop+$7"},
+		{0x00, 0x0160, "Main.loop"},
+		// before the first label
+		{0x00, 0x0100, "$0100"},
+		// too far from the label
+		{0x00, 0x1160, "$1160"},
+		{0x00, 0x115F, "Main.loop+$FFF"},
+		{0x02, 0x4A1F, ".skip+$7"},
+		// the labels of another bank don't count
+		{0x01, 0x4A12, "Bank1Start+$A12"},
+		{0x03, 0x4A12, "$4A12"},
+		{0x02, 0x4000, "$4000"},
+	}
+	for _, test := range tests {
+		if got := table.Format(test.bank, test.addr); got != test.want {
+			t.Errorf("%02X:%04X is %q, expected %q", test.bank, test.addr, got, test.want)
+		}
+	}
+
+	// labels added later are sorted again
+	table.Add(0x02, 0x4000, "Bank2Start")
+	if got := table.Format(0x02, 0x4001); got != "Bank2Start+$1" {
+		t.Errorf("02:4001 is %q after Add", got)
+	}
+	// no table, just the address
+	var empty *Table
+	if got := empty.Format(0x01, 0x4A12); got != "$4A12" {
+		t.Errorf("01:4A12 is %q without symbols", got)
+	}
+}
@@ -0,0 +1,197 @@
+package testroms
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+	"github.com/giammirove/gampboy_emulator/internal/headless"
+)
+
+// frames before a test is considered stuck (2 minutes)
+var MAX_FRAMES = 60 * 120
+
+// blargg writes the result in the cartridge ram:
+// 0xA000 status (0x80 while running, 0 when passed),
+// 0xA001 - 0xA003 signature, 0xA004 zero terminated text
+const _BLARGG_STATUS_ADDR = 0xA000
+const _BLARGG_SIGNATURE_ADDR = 0xA001
+const _BLARGG_TEXT_ADDR = 0xA004
+const _BLARGG_RUNNING = 0x80
+
+var _BLARGG_SIGNATURE = [3]uint{0xDE, 0xB0, 0x61}
+
+// mooneye loads the fibonacci numbers before LD B,B when the test passed
+var _MOONEYE_PASS = [6]uint{3, 5, 8, 13, 21, 34}
+
+type Result_t struct {
+	Path    string
+	Passed  bool
+	Message string
+	Frames  int
+}
+
+// RunROM loads a fresh machine and runs the rom until it reports a result
+func RunROM(path string) Result_t {
+	result := Result_t{Path: path}
+	rom, err := ioutil.ReadFile(path)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	// the battery ram of the previous run would change the result
+	gb, err := emulator.New(rom, emulator.Options{Path: path, NoSaves: true})
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	defer gb.Close()
+	var serial_output strings.Builder
+	breakpoint := false
+	gb.Serial.Output = &serial_output
+	gb.CPU.DebugBreak = func() {
+		breakpoint = true
+	}
+
+	for result.Frames < MAX_FRAMES {
+		headless.Run(gb, 1)
+		result.Frames++
+		if (breakpoint && checkMooneye(gb, &result)) || checkBlarggMemory(gb, &result) || checkBlarggSerial(serial_output.String(), &result) {
+			return result
+		}
+	}
+	result.Message = "timeout"
+	if serial_output.Len() > 0 {
+		result.Message += ": " + lastLine(serial_output.String())
+	}
+	return result
+}
+
+// called after LD B,B
+func checkMooneye(gb *emulator.GameBoy, result *Result_t) bool {
+	r := gb.Registers
+	values := [6]uint{r.B(), r.C(), r.D(), r.E(), r.H(), r.L()}
+	result.Passed = values == _MOONEYE_PASS
+	if result.Passed {
+		result.Message = "Passed"
+	} else {
+		result.Message = fmt.Sprintf("Failed (B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X)", values[0], values[1], values[2], values[3], values[4], values[5])
+	}
+	return true
+}
+
+func checkBlarggMemory(gb *emulator.GameBoy, result *Result_t) bool {
+	for i, b := range _BLARGG_SIGNATURE {
+		if gb.MMU.ReadFromMemory(uint(_BLARGG_SIGNATURE_ADDR+i)) != b {
+			return false
+		}
+	}
+	status := gb.MMU.ReadFromMemory(_BLARGG_STATUS_ADDR)
+	if status == _BLARGG_RUNNING {
+		return false
+	}
+	var text strings.Builder
+	for addr := uint(_BLARGG_TEXT_ADDR); addr <= 0xBFFF; addr++ {
+		c := gb.MMU.ReadFromMemory(addr)
+		if c == 0 {
+			break
+		}
+		text.WriteByte(byte(c))
+	}
+	result.Passed = status == 0
+	result.Message = fmt.Sprintf("%s (%02X)", lastLine(text.String()), status)
+	return true
+}
+
+func checkBlarggSerial(output string, result *Result_t) bool {
+	if strings.Contains(output, "Passed") {
+		result.Passed = true
+	} else if !strings.Contains(output, "Failed") {
+		return false
+	}
+	result.Message = lastLine(output)
+	return true
+}
+
+func lastLine(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// FindROMs returns every rom under dir grouped by suite,
+// the suite is the directory containing the rom
+func FindROMs(dir string) (map[string][]string, error) {
+	suites := map[string][]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if info.IsDir() || (ext != ".gb" && ext != ".gbc") {
+			return nil
+		}
+		suite, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		suites[suite] = append(suites[suite], path)
+		return nil
+	})
+	return suites, err
+}
+
+// RunDir runs every rom under dir and writes a table per suite to w.
+// It returns the number of roms that failed
+func RunDir(dir string, w io.Writer) (int, error) {
+	suites, err := FindROMs(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(suites) == 0 {
+		return 0, fmt.Errorf("no roms found in %s", dir)
+	}
+	names := make([]string, 0, len(suites))
+	for name := range suites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// the tables are written at the end, the roms may print while loading
+	results := map[string][]Result_t{}
+	for _, name := range names {
+		roms := suites[name]
+		sort.Strings(roms)
+		for _, rom := range roms {
+			results[name] = append(results[name], RunROM(rom))
+		}
+	}
+
+	failed := 0
+	total := 0
+	for _, name := range names {
+		passed := 0
+		for _, r := range results[name] {
+			if r.Passed {
+				passed++
+			}
+		}
+		fmt.Fprintf(w, "\n%s (%d/%d)\n", name, passed, len(results[name]))
+		for _, r := range results[name] {
+			status := "PASS"
+			if !r.Passed {
+				status = "FAIL"
+			}
+			fmt.Fprintf(w, "  %s  %-40s %6d frames  %s\n", status, filepath.Base(r.Path), r.Frames, r.Message)
+		}
+		failed += len(results[name]) - passed
+		total += len(results[name])
+	}
+	fmt.Fprintf(w, "\n%d/%d passed\n", total-failed, total)
+	return failed, nil
+}
@@ -0,0 +1,118 @@
+package testroms
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/giammirove/gampboy_emulator/internal/testutil"
+)
+
+// the directory with the suites, e.g. a clone of gb-test-roms
+const _ROMS_ENV = "GAMPBOY_TEST_ROMS"
+
+func TestROMs(t *testing.T) {
+	dir := os.Getenv(_ROMS_ENV)
+	if dir == "" {
+		t.Skipf("%s not set", _ROMS_ENV)
+	}
+	suites, err := FindROMs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suites) == 0 {
+		t.Fatalf("no roms found in %s", dir)
+	}
+	names := make([]string, 0, len(suites))
+	for name := range suites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		roms := suites[name]
+		sort.Strings(roms)
+		t.Run(name, func(t *testing.T) {
+			for _, rom := range roms {
+				rom := rom
+				t.Run(filepath.Base(rom), func(t *testing.T) {
+					result := RunROM(rom)
+					if !result.Passed {
+						t.Errorf("%s after %d frames", result.Message, result.Frames)
+					}
+				})
+			}
+		})
+	}
+}
+
+// LD A,value ; LD (addr),A
+func store(addr uint16, values ...byte) []byte {
+	var code []byte
+	for i, v := range values {
+		a := addr + uint16(i)
+		code = append(code, 0x3E, v, 0xEA, byte(a), byte(a>>8))
+	}
+	return code
+}
+
+// a cartridge with ram that reports the result as blargg's tests do
+func blarggROM(status byte, text string) []byte {
+	// enable the ram, the status goes last
+	program := store(0x0000, 0x0A)
+	program = append(program, store(_BLARGG_STATUS_ADDR, _BLARGG_RUNNING)...)
+	program = append(program, store(_BLARGG_SIGNATURE_ADDR, 0xDE, 0xB0, 0x61)...)
+	program = append(program, store(_BLARGG_TEXT_ADDR, append([]byte(text), 0)...)...)
+	program = append(program, store(_BLARGG_STATUS_ADDR, status)...)
+	// JR -2
+	program = append(program, 0x18, 0xFE)
+	rom := testutil.ROM(program)
+	// MBC1+RAM+BATTERY, 8 KiB of ram
+	rom[0x147] = 0x03
+	rom[0x149] = 0x02
+	testutil.Checksum(rom)
+	return rom
+}
+
+// loads B, C, D, E, H, L and breaks with LD B,B as mooneye's tests do
+func mooneyeROM(values [6]byte) []byte {
+	program := []byte{}
+	for i, v := range values {
+		// LD B,n ; LD C,n ; ... ; LD L,n
+		program = append(program, 0x06+byte(i)*8, v)
+	}
+	// LD B,B ; JR -2
+	program = append(program, 0x40, 0x18, 0xFE)
+	return testutil.ROM(program)
+}
+
+func TestResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		rom     []byte
+		passed  bool
+		message string
+	}{
+		{"blargg passed", blarggROM(0, "cpu_instrs\n\nPassed\n"), true, "Passed (00)"},
+		{"blargg failed", blarggROM(3, "01-special\n\nFailed #3\n"), false, "Failed #3 (03)"},
+		{"mooneye passed", mooneyeROM([6]byte{3, 5, 8, 13, 21, 34}), true, "Passed"},
+		{"mooneye failed", mooneyeROM([6]byte{0x42, 0x42, 0x42, 0x42, 0x42, 0x42}), false, "Failed (B:42 C:42 D:42 E:42 H:42 L:42)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.gb")
+			if err := ioutil.WriteFile(path, test.rom, 0644); err != nil {
+				t.Fatal(err)
+			}
+			result := RunROM(path)
+			if result.Passed != test.passed || result.Message != test.message {
+				t.Errorf("passed %t with %q, expected %t with %q", result.Passed, result.Message, test.passed, test.message)
+			}
+			if result.Frames != 1 {
+				t.Errorf("result after %d frames", result.Frames)
+			}
+		})
+	}
+}
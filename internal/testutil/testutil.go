@@ -0,0 +1,27 @@
+// Package testutil builds the tiny cartridges used by the tests
+package testutil
+
+const _ROM_SIZE = 0x8000
+const _ENTRY_POINT = 0x0100
+const _HEADER_CHECKSUM = 0x014D
+const _PROGRAM_START = 0x0150
+
+// ROM returns a 32 KiB cartridge without mapper, the entry point jumps
+// to the program after the header and the header checksum is valid
+func ROM(program []byte) []byte {
+	rom := make([]byte, _ROM_SIZE)
+	// NOP ; JP $0150
+	copy(rom[_ENTRY_POINT:], []byte{0x00, 0xC3, _PROGRAM_START & 0xFF, _PROGRAM_START >> 8})
+	copy(rom[_PROGRAM_START:], program)
+	Checksum(rom)
+	return rom
+}
+
+// Checksum writes the header checksum, to call after changing the header
+func Checksum(rom []byte) {
+	check := uint8(0)
+	for a := 0x134; a < _HEADER_CHECKSUM; a++ {
+		check = check - rom[a] - 1
+	}
+	rom[_HEADER_CHECKSUM] = check
+}
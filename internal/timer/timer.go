@@ -1,6 +1,7 @@
 package timer
 
 import (
+	"encoding/gob"
 	"log"
 
 	"github.com/giammirove/gampboy_emulator/internal/headers"
@@ -8,7 +9,25 @@ import (
 	"github.com/giammirove/gampboy_emulator/internal/utility"
 )
 
-var registers []uint
+// Timer is DIV, TIMA, TMA and TAC
+type Timer struct {
+	headers    *headers.Header
+	interrupts *interrupts.Interrupts
+
+	registers            []uint
+	div_internal         uint
+	div_clock            uint
+	tima_clock           int
+	resetting_tima       bool
+	resetting_tima_ticks int
+	old_state            bool
+	Cycle                func(val uint)
+}
+
+// New creates the timer connected to the other components
+func New(headers *headers.Header, interrupts *interrupts.Interrupts) *Timer {
+	return &Timer{headers: headers, interrupts: interrupts}
+}
 
 const _START_ADDR = 0xFF04
 const _END_ADDR = 0xFF07
@@ -25,61 +44,67 @@ const _TAC_I = 3
 
 const _RESET_TIME_CLOCK = 4
 
-var div_internal = uint(0)
-var div_clock = uint(0)
-var tima_clock = 0
-
-var resetting_tima = false
-var resetting_tima_ticks = 0
-var old_state = false
-
 // timer enable bit of TAC
 const _TAC_TE_BIT = 2
 
 // TAC = CPU clock / _TAC_IC_SELECT[i]
 var _TAC_IC_SELECT = [4]int{1024, 16, 64, 256}
 
-func Init() {
-	registers = make([]uint, _END_ADDR-_START_ADDR+1)
-	if headers.IsGB() {
-		registers[_DIV_I] = 0x18
-		registers[_TAC_I] = 0xF8
-	}
-	resetting_tima = false
-	resetting_tima_ticks = 0
-	old_state = true
+func (t *Timer) Init() {
+	t.registers = make([]uint, _END_ADDR-_START_ADDR+1)
+	t.div_internal = 0
+	t.div_clock = 0
+	t.resetting_tima = false
+	t.resetting_tima_ticks = 0
+	t.old_state = true
 }
 
-func Tick() {
+// DIV left by the boot rom, it depends on how long the boot took
+var _POST_BOOT_DIV = map[headers.Model]uint{
+	headers.MODEL_DMG0: 0x18,
+	headers.MODEL_DMG:  0xAB,
+	headers.MODEL_MGB:  0xAB,
+	headers.MODEL_SGB:  0xD8,
+	headers.MODEL_CGB:  0x1E,
+	headers.MODEL_AGB:  0x1E,
+}
 
-	div_internal++
+// PostBoot is the state left by the boot rom, DIV has been counting
+func (t *Timer) PostBoot() {
+	t.registers[_DIV_I] = _POST_BOOT_DIV[t.headers.GetModel()]
+	t.registers[_TAC_I] = 0xF8
+}
+
+func (t *Timer) Tick() {
+
+	t.div_internal++
 	// increment div every 64 m-cycles
 	// TODO: why with 63 works???
-	if div_internal >= 0xFF {
-		div_internal -= 0xFF
-		registers[_DIV_I] = (registers[_DIV_I] + 1) & 0xFFFF
+	if t.div_internal >= 0xFF {
+		t.div_internal -= 0xFF
+		t.registers[_DIV_I] = (t.registers[_DIV_I] + 1) & 0xFFFF
 	}
 	// TODO: handle different cpu speed
-	freq := GetClockFreq()
+	freq := t.GetClockFreq()
 
-	if resetting_tima {
-		if resetting_tima_ticks == _RESET_TIME_CLOCK {
-			interrupts.RequestInterruptTimer()
+	if t.resetting_tima {
+		if t.resetting_tima_ticks == _RESET_TIME_CLOCK {
+			t.interrupts.RequestInterruptTimer()
 		}
-		if resetting_tima_ticks == _RESET_TIME_CLOCK+1 {
-			registers[_TIMA_I] = registers[_TMA_I]
+		if t.resetting_tima_ticks == _RESET_TIME_CLOCK+1 {
+			t.registers[_TIMA_I] = t.registers[_TMA_I]
 		}
-		if resetting_tima_ticks == _RESET_TIME_CLOCK+2 {
-			resetting_tima = false
-			registers[_TIMA_I] = registers[_TMA_I]
-			resetting_tima_ticks = 0
+		if t.resetting_tima_ticks == _RESET_TIME_CLOCK+2 {
+			t.resetting_tima = false
+			t.registers[_TIMA_I] = t.registers[_TMA_I]
+			t.resetting_tima_ticks = 0
 		}
-		resetting_tima_ticks++
-	} else if GetTACEnable() {
-		div_clock++
-		if div_clock >= freq {
-			stepTIMA()
-			div_clock -= freq
+		t.resetting_tima_ticks++
+	} else if t.GetTACEnable() {
+		t.div_clock++
+		if t.div_clock >= freq {
+			t.stepTIMA()
+			t.div_clock -= freq
 		}
 	}
 
@@ -89,71 +114,77 @@ func IsTimerAddr(addr uint) bool {
 	return addr >= _START_ADDR && addr <= _END_ADDR
 }
 
-func ReadFromMemory(addr uint) uint {
+func (t *Timer) ReadFromMemory(addr uint) uint {
 	if addr < _START_ADDR || addr > _END_ADDR {
 		log.Fatalf("Invalid timer address (0x%8X)", addr)
 	}
-	ret := registers[addr-_START_ADDR]
+	ret := t.registers[addr-_START_ADDR]
 	if addr == _TAC {
-		prev_freq := GetClockFreq()
+		prev_freq := t.GetClockFreq()
 		ret = ret | 0b11111000
-		if GetClockFreq() != prev_freq {
-			div_clock = 0
+		if t.GetClockFreq() != prev_freq {
+			t.div_clock = 0
 		}
 	}
 	return ret
 }
-func WriteToMemory(addr uint, value uint) {
+func (t *Timer) WriteToMemory(addr uint, value uint) {
 	if addr < _START_ADDR || addr > _END_ADDR {
 		log.Fatalf("Invalid timer address (0x%8X)", addr)
 	}
 	// reset every time
 	if addr == _DIV {
 		// obscure behaviour
-		if registers[_DIV_I]&0b100000000 == 0b100000000 {
-			stepTIMA()
+		if t.registers[_DIV_I]&0b100000000 == 0b100000000 {
+			t.stepTIMA()
 		}
 		value = 0
-		div_internal = 0
+		t.div_internal = 0
 	}
-	registers[addr-_START_ADDR] = value
+	t.registers[addr-_START_ADDR] = value
 }
 
-var Cycle func(val uint)
-
-func stepTIMA() {
+func (t *Timer) stepTIMA() {
 	// not really necessary but lower numbers are easier to manage
 	// registers[_DIV_I] = 0
-	registers[_TIMA_I]++
-	if registers[_TIMA_I] >= 0xFF {
-		resetTIMA()
+	t.registers[_TIMA_I]++
+	if t.registers[_TIMA_I] >= 0xFF {
+		t.resetTIMA()
 	}
 }
 
-func resetTIMA() {
+func (t *Timer) resetTIMA() {
 	// reset time takes 1 cycle (4 clocks)
-	resetting_tima = true
+	t.resetting_tima = true
 }
-func ResetDIV() {
-	div_internal = 0
-	WriteToMemory(_DIV, 0)
+func (t *Timer) ResetDIV() {
+	t.div_internal = 0
+	t.WriteToMemory(_DIV, 0)
 }
-func GetDIV() uint {
-	return ReadFromMemory(_DIV)
+func (t *Timer) GetDIV() uint {
+	return t.ReadFromMemory(_DIV)
 }
-func GetDIVInternal() uint {
-	return div_internal
+func (t *Timer) GetDIVInternal() uint {
+	return t.div_internal
 }
 
-func GetTACEnable() bool {
-	return utility.GetBit(registers[_TAC_I], _TAC_TE_BIT) == 0x1
+func (t *Timer) GetTACEnable() bool {
+	return utility.GetBit(t.registers[_TAC_I], _TAC_TE_BIT) == 0x1
 }
 
-func GetTACSelect() uint {
+func (t *Timer) GetTACSelect() uint {
 	// only 0-1 bits
-	return registers[_TAC_I] & 0x3
+	return t.registers[_TAC_I] & 0x3
+}
+
+func (t *Timer) GetClockFreq() uint {
+	return uint(_TAC_IC_SELECT[t.GetTACSelect()])
+}
+
+func (t *Timer) SaveState(enc *gob.Encoder) error {
+	return utility.EncodeAll(enc, t.registers, t.div_internal, t.div_clock, t.tima_clock, t.resetting_tima, t.resetting_tima_ticks, t.old_state)
 }
 
-func GetClockFreq() uint {
-	return uint(_TAC_IC_SELECT[GetTACSelect()])
+func (t *Timer) LoadState(dec *gob.Decoder) error {
+	return utility.DecodeAll(dec, &t.registers, &t.div_internal, &t.div_clock, &t.tima_clock, &t.resetting_tima, &t.resetting_tima_ticks, &t.old_state)
 }
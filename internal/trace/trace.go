@@ -0,0 +1,72 @@
+// Package trace logs the state of the cpu before every instruction in the
+// format of gameboy-doctor, so it can be diffed with other emulators
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+)
+
+// Options_t tells when the trace starts and stops, -1 = no condition
+type Options_t struct {
+	// pc where the trace starts (included)
+	Start int
+	// pc where the trace stops (excluded)
+	Stop int
+	// lines after which the trace stops, 0 = no limit
+	Lines uint64
+}
+
+// Writer writes a line per instruction to w
+type Writer struct {
+	gb      *emulator.GameBoy
+	w       *bufio.Writer
+	options Options_t
+	active  bool
+	lines   uint64
+}
+
+// New hooks the trace to the cpu
+func New(gb *emulator.GameBoy, w io.Writer, options Options_t) *Writer {
+	t := &Writer{gb: gb, w: bufio.NewWriterSize(w, 1<<16), options: options}
+	t.active = options.Start < 0
+	gb.CPU.Trace = t.trace
+	return t
+}
+
+func (t *Writer) trace() {
+	r := t.gb.Registers
+	pc := r.PC()
+	if !t.active {
+		if uint(t.options.Start) != pc {
+			return
+		}
+		t.active = true
+	}
+	if t.options.Stop >= 0 && uint(t.options.Stop) == pc {
+		t.Close()
+		return
+	}
+	read := t.gb.MMU.ReadFromMemory
+	fmt.Fprintf(t.w, "A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X PCMEM:%02X,%02X,%02X,%02X\n",
+		r.A(), r.F(), r.B(), r.C(), r.D(), r.E(), r.H(), r.L(), r.SP(), pc,
+		read(pc), read((pc+1)&0xFFFF), read((pc+2)&0xFFFF), read((pc+3)&0xFFFF))
+	t.lines++
+	if t.options.Lines > 0 && t.lines >= t.options.Lines {
+		t.Close()
+	}
+}
+
+// Lines is the number of instructions written
+func (t *Writer) Lines() uint64 {
+	return t.lines
+}
+
+// Close removes the hook and writes what is buffered
+func (t *Writer) Close() error {
+	t.gb.CPU.Trace = nil
+	return t.w.Flush()
+}
@@ -2,6 +2,7 @@ package utility
 
 import (
 	"bufio"
+	"encoding/gob"
 	"log"
 	"os"
 )
@@ -95,3 +96,23 @@ func Contains(arr []uint, val uint) bool {
 	}
 	return false
 }
+
+// used by the save states, values are written in order one after the other
+func EncodeAll(enc *gob.Encoder, values ...interface{}) error {
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// values have to be pointers, in the same order used by EncodeAll
+func DecodeAll(dec *gob.Decoder, values ...interface{}) error {
+	for _, v := range values {
+		if err := dec.Decode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
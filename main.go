@@ -1,24 +1,33 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
-	cpu "github.com/giammirove/gampboy_emulator/internal/cpu"
-	decoder "github.com/giammirove/gampboy_emulator/internal/decoder"
+	"github.com/giammirove/gampboy_emulator/gampboy"
+	"github.com/giammirove/gampboy_emulator/internal/debugger"
+	"github.com/giammirove/gampboy_emulator/internal/disasm"
+	"github.com/giammirove/gampboy_emulator/internal/emulator"
+	"github.com/giammirove/gampboy_emulator/internal/gdbstub"
 	"github.com/giammirove/gampboy_emulator/internal/gui"
 	"github.com/giammirove/gampboy_emulator/internal/headers"
-	"github.com/giammirove/gampboy_emulator/internal/interrupts"
-	"github.com/giammirove/gampboy_emulator/internal/joypad"
-	mmu "github.com/giammirove/gampboy_emulator/internal/mmu"
-	"github.com/giammirove/gampboy_emulator/internal/ppu"
-	"github.com/giammirove/gampboy_emulator/internal/serial"
+	"github.com/giammirove/gampboy_emulator/internal/headless"
+	"github.com/giammirove/gampboy_emulator/internal/link"
+	"github.com/giammirove/gampboy_emulator/internal/movie"
+	"github.com/giammirove/gampboy_emulator/internal/printer"
+	"github.com/giammirove/gampboy_emulator/internal/rewind"
+	"github.com/giammirove/gampboy_emulator/internal/savestate"
 	"github.com/giammirove/gampboy_emulator/internal/sound"
-	"github.com/giammirove/gampboy_emulator/internal/timer"
+	"github.com/giammirove/gampboy_emulator/internal/symbols"
+	"github.com/giammirove/gampboy_emulator/internal/testroms"
+	"github.com/giammirove/gampboy_emulator/internal/trace"
 	"github.com/sqweek/dialog"
 )
 
@@ -26,13 +35,55 @@ func Init() {
 	name := flag.String("r", "", "ROM path (relative)")
 	debug := flag.Bool("d", false, "Debug Mode")
 	window_debug := flag.Bool("wd", false, "Window debug enabled")
-	manual := flag.Bool("m", false, "Manual Mode")
+	sym := flag.String("sym", "", "RGBDS symbol file for the trace and the debugger (default: next to the ROM with .sym)")
+	gdb := flag.String("gdb", "", "Wait for gdb on this address (e.g. :2345), the rom starts stopped")
+	manual := flag.Bool("m", false, "Manual Mode, start stopped in the debugger console (M key in the window)")
 	server := flag.Bool("s", false, "Server Mode")
 	scale := flag.Int("sc", 3, "Scale")
+	slow_motion := flag.Float64("slowmo", 0.5, "Speed of the slow motion (O key), 0.5 = half speed")
+	rewind_interval := flag.Int("rewind-interval", 1, "Frames between two snapshots of the rewind (Backspace key)")
+	rewind_budget := flag.Int("rewind-budget", 32, "Memory for the rewind in MiB, 0 disables it")
+	mute := flag.Bool("mute", false, "Disable audio output")
+	wav := flag.String("wav", "", "Record audio to a WAV file")
+	rtc_host := flag.Bool("rtc-host", false, "MBC3 clock follows the host clock")
+	boot_rom := flag.String("bootrom", "", "Run this DMG or CGB boot ROM before the cartridge")
+	model_name := flag.String("model", "", "Console to emulate: dmg0, dmg, mgb, sgb, cgb, agb (default: from the boot ROM or the cartridge)")
+	link_host := flag.String("link-host", "", "Wait for another emulator on this address (e.g. :8765) and connect the link cable")
+	link_join := flag.String("link-join", "", "Connect the link cable to the emulator hosting on this address (e.g. localhost:8765)")
+	serial_out := flag.String("serial-out", "", "Write the bytes sent on the serial port to a file, - for stdout")
+	printer_dir := flag.String("printer", "", "Plug a Game Boy Printer, the prints are saved as PNG in this directory")
+	trace_out := flag.String("trace", "", "Write a line per instruction in the gameboy-doctor format to a file, - for stdout")
+	trace_start := flag.String("trace-start", "", "Start the trace when PC reaches this address (hex or label)")
+	trace_stop := flag.String("trace-stop", "", "Stop the trace when PC reaches this address (hex or label)")
+	trace_lines := flag.Uint64("trace-lines", 0, "Stop the trace after this many instructions")
+	movie_record := flag.String("movie-record", "", "Record the buttons of every frame to a movie file, from power on (or -movie-state)")
+	movie_state := flag.String("movie-state", "", "Save state the recorded movie starts from")
+	movie_play := flag.String("movie-play", "", "Play a movie file, in headless mode exit with 1 when a frame differs from the recording")
+	flag.BoolVar(&headless_mode, "headless", false, "Run without window and audio, see -frames and -out")
+	flag.IntVar(&headless_frames, "frames", 600, "Frames to run in headless mode")
+	flag.StringVar(&headless_out, "out", "", "PNG screenshot of the last frame in headless mode")
+	flag.StringVar(&headless_ref, "ref", "", "Reference PNG, in headless mode run until LD B,B (or -frames) and compare")
+	flag.StringVar(&headless_diff, "diff", "", "PNG with the mismatching pixels when -ref fails")
+	test_roms := flag.String("test-roms", "", "Run every test ROM (blargg, mooneye) in the directory and exit")
+	flag.IntVar(&testroms.MAX_FRAMES, "test-frames", testroms.MAX_FRAMES, "Frames before a test ROM times out")
 	flag.Parse()
 
-	cpu.DEBUG = *debug
-	cpu.MANUAL = *manual
+	if *test_roms != "" {
+		failed, err := testroms.RunDir(*test_roms, os.Stdout)
+		if err != nil {
+			log.Fatalf("Error with test ROMs\n\t%s", err)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *name == "" && headless_mode {
+		fmt.Printf("A ROM path is required in headless mode !!!\n")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
 	if *name == "" {
 		fmt.Printf("!!! ROM not found, opening dialog\n")
 		var err error
@@ -50,43 +101,456 @@ func Init() {
 		log.Fatalf("Error with ROM\n\t%s", err)
 
 	}
-	headers.Init(rom)
-	timer.Init()
-	mmu.InitMMU(rom, path)
-	decoder.InitDecoder()
-	cpu.InitCPU()
-	interrupts.Init()
-	interrupts.StackPush = cpu.StackPush
-	sound.Init()
-	serial.Init()
-	ppu.ReadFromMemory = mmu.ReadFromMemory
-	ppu.Init()
-	decoder.Cycle = cpu.Cycle
-	joypad.Init()
-	joypad.ToggleDebugMode = cpu.ToggleDebugMode
-	joypad.TogglePauseMode = cpu.TogglePauseMode
-	joypad.ToggleManualMode = cpu.ToggleManualMode
-	joypad.SaveGame = mmu.SaveMemory
-
-	ppu.DelayGUI = gui.DelayGUI
-	ppu.TicksGUI = gui.TicksGUI
-
-	timer.Cycle = cpu.Cycle
-	interrupts.Cycle = cpu.Cycle
-	interrupts.MMUWriteToMemory = mmu.WriteToMemory
-	interrupts.GetHalted = cpu.GetHalted
+	model := *model_name
+	if _, err := headers.ParseModel(model); err != nil {
+		log.Fatalf("Error with model\n\t%s", err)
+	}
+	var played *movie.Movie
+	if *movie_play != "" {
+		if played, err = movie.Load(*movie_play); err != nil {
+			log.Fatalf("Error with movie\n\t%s", err)
+		}
+		// on the model it was recorded on
+		if *model_name == "" {
+			model = played.Model
+		}
+	}
+	// the battery ram and the host clock would change the playback
+	movies := *movie_play != "" || *movie_record != ""
+	if movies && *rtc_host {
+		log.Fatalf("Error with movie\n\tthe host clock can't be replayed, remove -rtc-host")
+	}
+	if movies && (*link_host != "" || *link_join != "") {
+		log.Fatalf("Error with movie\n\tthe link cable can't be replayed, remove -link-host and -link-join")
+	}
+	var boot []byte
+	if *boot_rom != "" {
+		if boot, err = ioutil.ReadFile(*boot_rom); err != nil {
+			log.Fatalf("Error with boot ROM\n\t%s", err)
+		}
+	}
+	machine, err = gampboy.New(rom, gampboy.Options{Path: path, RTCHostClock: *rtc_host, BootROM: boot, Model: model, NoSaves: movies})
+	if err != nil {
+		log.Fatalf("Error with ROM\n\t%s", err)
+	}
+	gb = machine.Machine()
+	printHeader(gb.Header)
+	gb.CPU.DEBUG = *debug
+	gb.CPU.Symbols, err = loadSymbols(path, *sym)
+	if err != nil {
+		log.Fatalf("Error with symbols\n\t%s", err)
+	}
+	if gb.CPU.Symbols.Len() > 0 {
+		fmt.Printf("!!! Loaded %d symbols\n", gb.CPU.Symbols.Len())
+	}
+	// in the window the debugger is always ready for the M key
+	if *gdb != "" {
+		connectGDB(*gdb)
+	} else if *manual || !headless_mode {
+		console := debugger.New(gb, os.Stdin, os.Stdout, *manual)
+		gui.Break = console.Break
+	}
+	if *link_host != "" || *link_join != "" {
+		connectLink(*link_host, *link_join)
+	} else if *printer_dir != "" {
+		connectPrinter(*printer_dir)
+	}
+	if *serial_out != "" {
+		openSerialOutput(*serial_out)
+	}
+	if *wav != "" {
+		startRecording(*wav)
+	}
+	if *trace_out != "" {
+		startTrace(*trace_out, *trace_start, *trace_stop, *trace_lines)
+	}
+	gui.ToggleDebugMode = gb.CPU.ToggleDebugMode
+	gb.MMU.RumbleChanged = gui.SetRumble
+	gui.SaveSlot = func(slot int) error {
+		return savestate.SaveSlot(gb, slot)
+	}
+	// going back in time would break the movie
+	var buffer *rewind.Buffer
+	if *rewind_budget > 0 && !movies {
+		buffer = rewind.New(gb, *rewind_interval, *rewind_budget<<20)
+		gui.Rewind = buffer.Rewind
+		gui.RecordFrame = buffer.Record
+	}
+	if !movies {
+		gui.LoadSlot = func(slot int) error {
+			if err := savestate.LoadSlot(gb, slot); err != nil {
+				return err
+			}
+			// the snapshots belong to the timeline left behind
+			if buffer != nil {
+				buffer.Clear()
+			}
+			return nil
+		}
+	}
+	if played != nil {
+		playMovie(played)
+	} else if *movie_record != "" {
+		recordMovie(*movie_record, *movie_state)
+	}
 
 	gui.DEBUG_WINDOW = *window_debug
 	gui.SERVER_MODE = *server
 	gui.SCALE = uint(*scale)
-	gui.Init()
+	if *slow_motion <= 0 {
+		log.Fatalf("Error with slow motion\n\tspeed must be more than 0")
+	}
+	gui.SLOW_MOTION = *slow_motion
+	gui.AUDIO = !*mute
+	gui.Init(machine)
+}
+
+// the machine being emulated
+var gb *emulator.GameBoy
+var machine *gampboy.GameBoy
+
+func printHeader(h *headers.Header) {
+	fmt.Printf("%-18s: %s\n", "TITLE", h.GetTitle())
+	if h.GetCGBFlag() == 0xC0 {
+		fmt.Printf("%-18s: CGB (%02X)\n", "GB TYPE", h.GetCGBFlag())
+	} else if h.GetCGBFlag() == 0x80 {
+		fmt.Printf("%-18s: CGB but backwards compatible with NON-CGB (%02X)\n", "GB TYPE", h.GetCGBFlag())
+	} else {
+		fmt.Printf("%-18s: NON-CGB (%02X)\n", "GB TYPE", h.GetCGBFlag())
+	}
+	fmt.Printf("%-18s: %s (%02X)\n", "NEW LICENSEE CODE", h.GetLicenseeName(), h.GetLicenseeCode())
+	fmt.Printf("%-18s: %02X\n", "SGB Flag", h.GetSGBFlag())
+	fmt.Printf("%-18s: %s (%02X)\n", "CARTBRIDGE TYPE", h.GetCartridgeName(), h.GetCartridgeType())
+	fmt.Printf("%-18s: %d KiB (n. banking %d) (%d)\n", "ROM SIZE", h.GetRomSize()/1024, h.GetRomBankNumber(), h.GetRomSizeCode())
+	fmt.Printf("%-18s: %d KiB (%d)\n", "RAM SIZE", h.GetRamSize()/1024, h.GetRamSizeCode())
+	fmt.Printf("%-18s: %s (%d)\n", "DESTINATION CODE", h.GetDestinationName(), h.GetDestinationCode())
+	fmt.Printf("%-18s: %s\n", "MODEL", h.GetModel())
+	fmt.Printf("---------------------------------------------------------\n")
+}
+
+var headless_mode bool
+var headless_frames int
+var headless_out string
+var headless_ref string
+var headless_diff string
+
+func runHeadless() int {
+	if movie_input != nil {
+		if code := runMovie(); code != 0 {
+			return code
+		}
+	} else if headless_ref != "" {
+		headless.RunUntilBreak(gb, headless_frames)
+	} else {
+		headless.Run(gb, headless_frames)
+	}
+	// quit in the debugger
+	if gb.CPU.QuitRequested() {
+		return 0
+	}
+	if headless_out != "" {
+		if err := headless.WritePNG(gb, headless_out); err != nil {
+			log.Printf("Error with screenshot\n\t%s", err)
+			return 1
+		}
+	}
+	if headless_ref == "" {
+		return 0
+	}
+	mismatches, err := headless.CompareFiles(gb, headless_ref, headless_diff)
+	if err != nil {
+		log.Printf("Error with reference image\n\t%s", err)
+		return 1
+	}
+	if mismatches > 0 {
+		fmt.Printf("%d pixels differ from %s\n", mismatches, headless_ref)
+		return 1
+	}
+	fmt.Printf("Frame matches %s\n", headless_ref)
+	return 0
+}
+
+var wav_file *os.File
+var wav_writer *sound.WAVWriter
+
+func startRecording(path string) {
+	var err error
+	wav_file, err = os.Create(path)
+	if err != nil {
+		log.Fatalf("Error with WAV file\n\t%s", err)
+	}
+	wav_writer, err = sound.NewWAVWriter(wav_file)
+	if err != nil {
+		log.Fatalf("Error with WAV file\n\t%s", err)
+	}
+	gb.APU.SetRecorder(wav_writer)
+}
+
+func stopRecording() {
+	if wav_writer == nil {
+		return
+	}
+	gb.APU.SetRecorder(nil)
+	if err := wav_writer.Close(); err != nil {
+		log.Printf("Error with WAV file\n\t%s", err)
+	}
+	wav_file.Close()
+}
+
+var serial_file *os.File
+
+func openSerialOutput(path string) {
+	if path == "-" {
+		gb.Serial.Output = os.Stdout
+		return
+	}
+	var err error
+	serial_file, err = os.Create(path)
+	if err != nil {
+		log.Fatalf("Error with serial output\n\t%s", err)
+	}
+	gb.Serial.Output = serial_file
+}
+
+func closeSerialOutput() {
+	if serial_file != nil {
+		serial_file.Close()
+	}
+}
+
+var trace_file *os.File
+var trace_writer *trace.Writer
+
+func startTrace(path string, start string, stop string, lines uint64) {
+	options := trace.Options_t{Start: traceAddress(start), Stop: traceAddress(stop), Lines: lines}
+	if path == "-" {
+		trace_writer = trace.New(gb, os.Stdout, options)
+		return
+	}
+	var err error
+	trace_file, err = os.Create(path)
+	if err != nil {
+		log.Fatalf("Error with trace\n\t%s", err)
+	}
+	trace_writer = trace.New(gb, trace_file, options)
+}
+
+// -1 if there is no address, the labels come from the symbols
+func traceAddress(s string) int {
+	if s == "" {
+		return -1
+	}
+	if _, addr, ok := gb.CPU.Symbols.Find(s); ok {
+		return int(addr)
+	}
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "0x"), "$"), 16, 16)
+	if err != nil {
+		log.Fatalf("Error with trace\n\tinvalid address %q", s)
+	}
+	return int(addr)
+}
+
+func stopTrace() {
+	if trace_writer == nil {
+		return
+	}
+	if err := trace_writer.Close(); err != nil {
+		log.Printf("Error with trace\n\t%s", err)
+	}
+	if trace_file != nil {
+		trace_file.Close()
+	}
+}
+
+var movie_recorder *movie.Recorder
+var movie_path string
+
+// set while a movie is played or recorded
+var movie_input func(buttons gampboy.Button) gampboy.Button
+var movie_drawn func() error
+var movie_frames int
+
+func playMovie(m *movie.Movie) {
+	player, err := movie.NewPlayer(machine, m)
+	if err != nil {
+		log.Fatalf("Error with movie\n\t%s", err)
+	}
+	movie_input = player.Input
+	movie_drawn = player.FrameDrawn
+	movie_frames = m.Len()
+	gui.FrameInput = movie_input
+	gui.FrameDrawn = movie_drawn
+	fmt.Printf("!!! Playing movie, %d frames\n", m.Len())
+}
+
+func recordMovie(path string, state string) {
+	if state != "" {
+		file, err := os.Open(state)
+		if err != nil {
+			log.Fatalf("Error with movie state\n\t%s", err)
+		}
+		err = machine.LoadState(bufio.NewReader(file))
+		file.Close()
+		if err != nil {
+			log.Fatalf("Error with movie state\n\t%s", err)
+		}
+	}
+	var err error
+	movie_recorder, err = movie.NewRecorder(machine, state == "")
+	if err != nil {
+		log.Fatalf("Error with movie\n\t%s", err)
+	}
+	movie_path = path
+	movie_input = movie_recorder.Input
+	movie_drawn = movie_recorder.FrameDrawn
+	movie_frames = headless_frames
+	gui.FrameInput = movie_input
+	gui.FrameDrawn = movie_drawn
+	fmt.Printf("!!! Recording movie to %s\n", path)
+}
+
+// headless, the whole movie or -frames frames of recording
+func runMovie() int {
+	for i := 0; i < movie_frames && !gb.CPU.QuitRequested(); i++ {
+		machine.SetButtons(movie_input(0))
+		machine.RunFrame()
+		if err := movie_drawn(); err != nil {
+			log.Printf("Error with movie\n\t%s", err)
+			return 1
+		}
+	}
+	if movie_recorder == nil && !gb.CPU.QuitRequested() {
+		fmt.Printf("Movie matches, %d frames\n", movie_frames)
+	}
+	return 0
+}
+
+func stopMovie() {
+	if movie_recorder == nil {
+		return
+	}
+	m := movie_recorder.Movie()
+	if err := m.Save(movie_path); err != nil {
+		log.Printf("Error with movie\n\t%s", err)
+		return
+	}
+	fmt.Printf("!!! Movie saved, %d frames\n", m.Len())
+}
+
+var link_cable *link.TCP
+
+func connectLink(host string, join string) {
+	var err error
+	if host != "" {
+		link_cable, err = link.Host(host)
+	} else {
+		link_cable, err = link.Join(join)
+	}
+	if err != nil {
+		log.Fatalf("Error with link cable\n\t%s", err)
+	}
+	gb.Serial.Connect(link_cable)
+	fmt.Printf("!!! Link cable connected\n")
+}
+
+func connectGDB(addr string) {
+	server, err := gdbstub.Listen(gb, addr)
+	if err != nil {
+		log.Fatalf("Error with gdb\n\t%s", err)
+	}
+	gui.Break = server.Break
+	fmt.Printf("!!! gdb connected\n")
+}
+
+func connectPrinter(dir string) {
+	p, err := printer.New(dir)
+	if err != nil {
+		log.Fatalf("Error with printer\n\t%s", err)
+	}
+	gb.Serial.Connect(p)
+	fmt.Printf("!!! Printer connected, prints are saved in %s\n", dir)
+}
+
+func disconnectLink() {
+	if link_cable != nil {
+		link_cable.Close()
+	}
+}
+
+// disasm [-sym file] [-o file] rom.gb
+func runDisasm(args []string) int {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	sym := flags.String("sym", "", "RGBDS symbol file (default: next to the ROM with .sym)")
+	out := flags.String("o", "", "Output file (default: stdout)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s disasm [options] rom.gb\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	path := flags.Arg(0)
+	rom, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Error with ROM\n\t%s", err)
+	}
+
+	table, err := loadSymbols(path, *sym)
+	if err != nil {
+		log.Fatalf("Error with symbols\n\t%s", err)
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			log.Fatalf("Error with output\n\t%s", err)
+		}
+		defer w.Close()
+	}
+	if err := disasm.Disassemble(rom, table, w); err != nil {
+		log.Fatalf("Error with output\n\t%s", err)
+	}
+	return 0
+}
+
+// the symbols given by flag, or the ones next to the rom if they exist
+func loadSymbols(rom_path string, path string) (*symbols.Table, error) {
+	if path != "" {
+		return symbols.Load(path)
+	}
+	path = strings.TrimSuffix(rom_path, filepath.Ext(rom_path)) + ".sym"
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil
+	}
+	return symbols.Load(path)
 }
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "disasm" {
+		os.Exit(runDisasm(os.Args[2:]))
+	}
+
 	Init()
 
-	go cpu.Run()
+	if headless_mode {
+		code := runHeadless()
+		cleanup()
+		os.Exit(code)
+	}
 
 	gui.Run()
+
+	cleanup()
+}
+
+// flushes and closes what Init started
+func cleanup() {
+	stopRecording()
+	stopMovie()
+	stopTrace()
+	closeSerialOutput()
+	disconnectLink()
 }